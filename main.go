@@ -22,6 +22,7 @@ func main() {
 	router.POST("/lazy-lagoon/paginate", routes.Paginate)
 
 	router.POST("/lazy-lagoon/transform", routes.Transform)
+	router.POST("/lazy-lagoon/rules/validate", routes.ValidateRules)
 
 	router.GET("/lazy-lagoon/healthz/ready", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "ok"})
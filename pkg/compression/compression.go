@@ -0,0 +1,249 @@
+package compression
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressions of the inputs, GZIP and ZSTD are also written for the outputs
+const (
+	Gzip  = "GZIP"
+	Zstd  = "ZSTD"
+	Bzip2 = "BZIP2"
+	Zip   = "ZIP"
+)
+
+var (
+	magicGzip  = []byte{0x1F, 0x8B}
+	magicZstd  = []byte{0x28, 0xB5, 0x2F, 0xFD}
+	magicBzip2 = []byte("BZh")
+	// Magic of the first block, after the block size of the bzip2 header
+	magicBzip2Block = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	magicZip        = []byte("PK\x03\x04")
+)
+
+/*
+File is a file of a zip archive, the name is empty when the content wasn't an archive
+*/
+type File struct {
+	Name    string
+	Content []byte
+}
+
+/*
+Detect returns the compression of the content from its magic bytes, or from the extension of its name (e.g. .csv.gz).
+Empty when the content isn't compressed.
+*/
+func Detect(content []byte, name string) string {
+	switch {
+	case bytes.HasPrefix(content, magicGzip):
+		return Gzip
+	case bytes.HasPrefix(content, magicZstd):
+		return Zstd
+	case bytes.HasPrefix(content, magicBzip2) && len(content) >= 10 && bytes.Equal(content[4:10], magicBzip2Block):
+		return Bzip2
+	case bytes.HasPrefix(content, magicZip):
+		return Zip
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".gz", ".gzip":
+		return Gzip
+	case ".zst", ".zstd":
+		return Zstd
+	case ".bz2":
+		return Bzip2
+	case ".zip":
+		return Zip
+	}
+	return ""
+}
+
+/*
+Decompress returns the content of the gzip, zstd or bzip2 stream, the content is returned as it is when it isn't compressed (or is a zip archive)
+*/
+func Decompress(content []byte, name string) ([]byte, error) {
+	var reader io.Reader
+	switch compression := Detect(content, name); compression {
+	case Gzip:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress your gzip input: %v", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case Zstd:
+		zstdReader, err := zstd.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress your zstd input: %v", err)
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	case Bzip2:
+		reader = bzip2.NewReader(bytes.NewReader(content))
+	default:
+		return content, nil
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress your input: %v", err)
+	}
+	return decompressed, nil
+}
+
+/*
+NewReader returns a reader decompressing the gzip, zstd or bzip2 stream of the reader as it's read, the content is read as it is when it isn't compressed (or is a zip archive).
+Closing the reader releases the decompressor, it doesn't close the reader it reads.
+*/
+func NewReader(reader io.Reader, name string) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(reader)
+	// The magic bytes of bzip2 end at the 10th byte, the content can be shorter
+	magic, err := buffered.Peek(10)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("could not read your input: %v", err)
+	}
+	switch compression := Detect(magic, name); compression {
+	case Gzip:
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress your gzip input: %v", err)
+		}
+		return gzipReader, nil
+	case Zstd:
+		zstdReader, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress your zstd input: %v", err)
+		}
+		return zstdReader.IOReadCloser(), nil
+	case Bzip2:
+		return io.NopCloser(bzip2.NewReader(buffered)), nil
+	}
+	return io.NopCloser(buffered), nil
+}
+
+/*
+ArchiveFiles returns the files of the zip archive, decompressed when they are compressed themselves.
+Directories and hidden files (e.g. __MACOSX/) are left out. Content that isn't a zip archive is a single file without a name.
+*/
+func ArchiveFiles(content []byte, name string) ([]File, error) {
+	if Detect(content, name) != Zip {
+		return []File{{Content: content}}, nil
+	}
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("could not open your zip input: %v", err)
+	}
+	var files []File
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || isHidden(entry.Name) {
+			continue
+		}
+		fileContent, err := readEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		fileContent, err = Decompress(fileContent, entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: entry.Name, Content: fileContent})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("the zip input has no files")
+	}
+	return files, nil
+}
+
+/*
+NewWriter returns a writer compressing into the writer, the writer itself when there is no compression.
+Closing the compressing writer flushes it, it doesn't close the writer.
+*/
+func NewWriter(writer io.Writer, compression string) (io.WriteCloser, error) {
+	switch strings.ToUpper(compression) {
+	case "":
+		return nopCloser{writer}, nil
+	case Gzip:
+		return gzip.NewWriter(writer), nil
+	case Zstd:
+		return zstd.NewWriter(writer)
+	}
+	return nil, fmt.Errorf("compression %s not supported for outputs, use GZIP or ZSTD", compression)
+}
+
+/*
+Compress returns the content compressed, the content itself when there is no compression
+*/
+func Compress(content []byte, compression string) ([]byte, error) {
+	if compression == "" {
+		return content, nil
+	}
+	buffer := bytes.NewBuffer(nil)
+	writer, err := NewWriter(buffer, compression)
+	if err != nil {
+		return nil, err
+	}
+	_, err = writer.Write(content)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+/*
+ContentEncoding returns the HTTP Content-Encoding of the compression, empty when there is none
+*/
+func ContentEncoding(compression string) string {
+	switch strings.ToUpper(compression) {
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	}
+	return ""
+}
+
+/*
+	Helper functions
+*/
+func readEntry(entry *zip.File) ([]byte, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s of your zip input: %v", entry.Name, err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s of your zip input: %v", entry.Name, err)
+	}
+	return content, nil
+}
+
+// isHidden checks for the files and folders starting with a dot or __MACOSX, added by the archivers
+func isHidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
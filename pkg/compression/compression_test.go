@@ -0,0 +1,89 @@
+package compression
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+const content = "id,name\n1,Ada\n"
+
+func TestDecompress(t *testing.T) {
+	t.Run("gzip and zstd detected from the magic bytes", func(t *testing.T) {
+		for _, compression := range []string{Gzip, Zstd} {
+			compressed, err := Compress([]byte(content), compression)
+			if err != nil {
+				t.Fatalf("Failed to compress %s: %v", compression, err)
+			}
+			assert.Equal(t, Detect(compressed, "data.csv"), compression)
+			decompressed, err := Decompress(compressed, "data.csv")
+			if err != nil {
+				t.Fatalf("Failed to decompress %s: %v", compression, err)
+			}
+			assert.Equal(t, string(decompressed), content)
+		}
+	})
+
+	t.Run("decompressed as it's read", func(t *testing.T) {
+		for _, compression := range []string{Gzip, Zstd, ""} {
+			compressed, _ := Compress([]byte(content), compression)
+			reader, err := NewReader(bytes.NewReader(compressed), "data.csv")
+			if err != nil {
+				t.Fatalf("Failed to open %s: %v", compression, err)
+			}
+			decompressed, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Failed to decompress %s: %v", compression, err)
+			}
+			reader.Close()
+			assert.Equal(t, string(decompressed), content)
+		}
+
+		_, err := NewReader(bytes.NewReader([]byte(content)), "data.csv.gz")
+		assert.NotEqual(t, err, nil)
+	})
+
+	t.Run("plain content returned as it is", func(t *testing.T) {
+		decompressed, err := Decompress([]byte(content), "data.csv")
+		if err != nil {
+			t.Fatalf("Failed to decompress: %v", err)
+		}
+		assert.Equal(t, string(decompressed), content)
+
+		// The extension says it's compressed
+		_, err = Decompress([]byte(content), "data.csv.gz")
+		assert.NotEqual(t, err, nil)
+
+		_, err = Compress([]byte(content), Bzip2)
+		assert.NotEqual(t, err, nil)
+	})
+
+	t.Run("files of a zip archive", func(t *testing.T) {
+		gzipped, _ := Compress([]byte(content), Gzip)
+		buffer := bytes.NewBuffer(nil)
+		archive := zip.NewWriter(buffer)
+		for name, fileContent := range map[string][]byte{"a.csv": []byte(content), "nested/b.csv.gz": gzipped, "__MACOSX/._a.csv": []byte("x")} {
+			writer, _ := archive.Create(name)
+			writer.Write(fileContent)
+		}
+		archive.Close()
+
+		files, err := ArchiveFiles(buffer.Bytes(), "export.zip")
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+		assert.Equal(t, len(files), 2)
+		for _, file := range files {
+			assert.Equal(t, string(file.Content), content)
+		}
+
+		files, err = ArchiveFiles([]byte(content), "data.csv")
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		assert.Equal(t, files, []File{{Content: []byte(content)}})
+	})
+}
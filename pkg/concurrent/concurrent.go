@@ -2,6 +2,7 @@ package concurrent
 
 import (
 	"fmt"
+	"runtime"
 	"sync"
 
 	"lazy-lagoon/pkg/types"
@@ -47,6 +48,57 @@ func ForEach[T any, R any](items []T, fn func(item T, index int) (R, *types.Tran
 	return results, nil
 }
 
+// ForEachOrdered executes the provided function for each item in parallel and passes the results to write in the original order,
+// each one as soon as it and the ones before it are done. Only the items up to GOMAXPROCS ahead of the next result to write are processed,
+// so the results waiting to be written stay few. Write is called from the calling goroutine and stops at the first error.
+func ForEachOrdered[T any, R any](items []T, fn func(item T, index int) (R, *types.TransformError), write func(result R, index int) *types.TransformError) *types.TransformError {
+	type outcome struct {
+		result R
+		err    *types.TransformError
+	}
+	// Every item has its own buffered channel, an item done after an error doesn't block
+	outcomes := make([]chan outcome, len(items))
+	for i := range outcomes {
+		outcomes[i] = make(chan outcome, 1)
+	}
+	slots := make(chan struct{}, runtime.GOMAXPROCS(0))
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// Start the items as the slots are freed by the written results
+	go func() {
+		for i, item := range items {
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+			go func(i int, item T) {
+				defer func() {
+					if r := recover(); r != nil {
+						outcomes[i] <- outcome{err: &types.TransformError{Message: fmt.Sprintf("panic: %v", r)}}
+					}
+				}()
+				result, err := fn(item, i)
+				outcomes[i] <- outcome{result: result, err: err}
+			}(i, item)
+		}
+	}()
+
+	// Write the results in order
+	for i := range items {
+		done := <-outcomes[i]
+		<-slots
+		if done.err != nil {
+			return done.err
+		}
+		if err := write(done.result, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ForEachVoid executes the provided function for each item in the slice in parallel,
 // but does not return any results. This is useful for operations that only have side effects.
 func ForEachVoid[T any](items []T, fn func(item T, index int) *types.TransformError) *types.TransformError {
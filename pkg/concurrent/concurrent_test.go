@@ -0,0 +1,50 @@
+package concurrent
+
+import (
+	"testing"
+	"time"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestForEachOrdered(t *testing.T) {
+	t.Run("results written in order as they are done", func(t *testing.T) {
+		items := []int{5, 1, 4, 2, 3, 0, 6, 7, 9, 8}
+		written := []int{}
+		transformErr := ForEachOrdered(items, func(item int, index int) (int, *types.TransformError) {
+			// The later items are done first
+			time.Sleep(time.Duration(item) * time.Millisecond)
+			return item * 10, nil
+		}, func(result int, index int) *types.TransformError {
+			assert.Equal(t, result, items[index]*10)
+			written = append(written, index)
+			return nil
+		})
+		assert.Equal(t, transformErr, nil)
+		assert.Equal(t, written, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	})
+
+	t.Run("stops at the first error", func(t *testing.T) {
+		written := 0
+		transformErr := ForEachOrdered([]int{0, 1, 2, 3}, func(item int, index int) (int, *types.TransformError) {
+			if item == 1 {
+				return 0, &types.TransformError{Message: "failed"}
+			}
+			return item, nil
+		}, func(result int, index int) *types.TransformError {
+			written++
+			return nil
+		})
+		assert.Equal(t, transformErr.Message, "failed")
+		assert.Equal(t, written, 1)
+
+		transformErr = ForEachOrdered([]int{0, 1}, func(item int, index int) (int, *types.TransformError) {
+			return item, nil
+		}, func(result int, index int) *types.TransformError {
+			return &types.TransformError{Message: "upload failed", Key: "upload"}
+		})
+		assert.Equal(t, transformErr.Key, "upload")
+	})
+}
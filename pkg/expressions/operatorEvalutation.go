@@ -1,12 +1,23 @@
 package expressions
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"regexp"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // ValidOperators contains the allowed operator values
-var ValidOperators = []string{"EQ", "NE", "GT", "GTE", "LT", "LTE", "EXISTS"}
+var ValidOperators = []string{"EQ", "NE", "GT", "GTE", "LT", "LTE", "EXISTS", "SIZE_EQ", "SIZE_NE", "SIZE_GT", "SIZE_GTE", "SIZE_LT", "SIZE_LTE"}
+
+// ValidQuantifiers contains the allowed quantifier values for wildcard expressions
+var ValidQuantifiers = []string{"ANY", "ALL", "NONE", "COUNT"}
+
+// ValidCountOperators contains the allowed operators to compare the number of matches with when using COUNT
+var ValidCountOperators = []string{"EQ", "NE", "GT", "GTE", "LT", "LTE"}
 
 // IsValidOperator checks if the given operator is valid
 func IsValidOperator(operator string) bool {
@@ -18,6 +29,93 @@ func IsValidOperator(operator string) bool {
 	return false
 }
 
+// decimalPattern matches plain decimal numbers, the exponent is bounded so a value can't blow up the arbitrary-precision arithmetic
+var decimalPattern = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]{1,4})?$`)
+
+/*
+	ToDecimal converts the value to an exact decimal, ok is false when the value isn't a number
+*/
+func ToDecimal(value any) (decimal *big.Rat, ok bool) {
+	var text string
+	switch typedValue := value.(type) {
+	case nil, bool:
+		return nil, false
+	case json.Number:
+		text = typedValue.String()
+	case string:
+		text = typedValue
+	case float64:
+		// Shortest representation so 0.1 stays 0.1 and not its binary approximation
+		text = strconv.FormatFloat(typedValue, 'g', -1, 64)
+	case float32:
+		text = strconv.FormatFloat(float64(typedValue), 'g', -1, 32)
+	default:
+		text = fmt.Sprintf("%v", typedValue)
+	}
+	if !decimalPattern.MatchString(text) {
+		return nil, false
+	}
+	return new(big.Rat).SetString(text)
+}
+
+// isNumberType checks if the value was decoded as a number rather than a string
+func isNumberType(value any) bool {
+	switch value.(type) {
+	case json.Number, float64, float32, int, int64, int32:
+		return true
+	}
+	return false
+}
+
+// IsSizeOperator checks if the operator compares the size of the value instead of the value itself
+func IsSizeOperator(operator string) bool {
+	return strings.HasPrefix(operator, "SIZE_") && IsValidOperator(operator)
+}
+
+// IsValidQuantifier checks if the given quantifier is valid, an empty quantifier defaults to ANY
+func IsValidQuantifier(quantifier string) bool {
+	if quantifier == "" {
+		return true
+	}
+	for _, validQuantifier := range ValidQuantifiers {
+		if quantifier == validQuantifier {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidCountOperator checks if the given count operator is valid
+func IsValidCountOperator(operator string) bool {
+	for _, validOp := range ValidCountOperators {
+		if operator == validOp {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Size returns the length of an array or object, or the number of characters of any other value
+*/
+func Size(value any) int {
+	switch typedValue := value.(type) {
+	case nil:
+		return 0
+	case []any:
+		return len(typedValue)
+	case map[string]any:
+		return len(typedValue)
+	// Objects that keep the order of their keys
+	case interface{ Len() int }:
+		return typedValue.Len()
+	case string:
+		return utf8.RuneCountInString(typedValue)
+	default:
+		return utf8.RuneCountInString(fmt.Sprintf("%v", typedValue))
+	}
+}
+
 /*
 	IsOperatorMet checks if the given expression params match the given operator result
 */
@@ -26,18 +124,17 @@ func IsOperatorResultMet(operator string, expectedValue any, actualValue any) (b
 		return false, fmt.Errorf("invalid operator: %s", operator)
 	}
 
-	canConvertToFloat := true
+	// Size operators compare the length of the value with the expected value
+	if IsSizeOperator(operator) {
+		return IsOperatorResultMet(strings.TrimPrefix(operator, "SIZE_"), expectedValue, Size(actualValue))
+	}
 
 	actualString := fmt.Sprintf("%v", actualValue)
 	expectedString := fmt.Sprintf("%v", expectedValue)
-	actualFloat, err := strconv.ParseFloat(actualString, 64)
-	if err != nil {
-		canConvertToFloat = false
-	}
-	expectedFloat, err := strconv.ParseFloat(expectedString, 64)
-	if err != nil {
-		canConvertToFloat = false
-	}
+	// Numbers are compared with exact decimal arithmetic so large ids and high precision decimals are not rounded
+	actualDecimal, actualIsDecimal := ToDecimal(actualValue)
+	expectedDecimal, expectedIsDecimal := ToDecimal(expectedValue)
+	canCompareDecimals := actualIsDecimal && expectedIsDecimal
 
 	switch operator {
 	case "EQ":
@@ -45,6 +142,10 @@ func IsOperatorResultMet(operator string, expectedValue any, actualValue any) (b
 		if expectedValue == "null" && actualValue == nil {
 			return true, nil
 		}
+		// Handle numeric comparison when one of the values is a number (strings like "007" and "7" stay different)
+		if canCompareDecimals && (isNumberType(actualValue) || isNumberType(expectedValue)) {
+			return actualDecimal.Cmp(expectedDecimal) == 0, nil
+		}
 		// Handle string comparison
 		return actualString == expectedString, nil
 	case "NE":
@@ -52,28 +153,32 @@ func IsOperatorResultMet(operator string, expectedValue any, actualValue any) (b
 		if expectedValue == "null" && actualValue != nil {
 			return true, nil
 		}
+		// Handle numeric comparison when one of the values is a number
+		if canCompareDecimals && (isNumberType(actualValue) || isNumberType(expectedValue)) {
+			return actualDecimal.Cmp(expectedDecimal) != 0, nil
+		}
 		// Handle string comparison
 		return actualString != expectedString, nil
 	case "GT":
 		// Handle numeric comparison
-		if canConvertToFloat {
-			return actualFloat > expectedFloat, nil
+		if canCompareDecimals {
+			return actualDecimal.Cmp(expectedDecimal) > 0, nil
 		}
 		// Handle string comparison
 		return actualString > expectedString, nil
 	case "GTE":
-		if canConvertToFloat {
-			return actualFloat >= expectedFloat, nil
+		if canCompareDecimals {
+			return actualDecimal.Cmp(expectedDecimal) >= 0, nil
 		}
 		return actualString >= expectedString, nil
 	case "LT":
-		if canConvertToFloat {
-			return actualFloat < expectedFloat, nil
+		if canCompareDecimals {
+			return actualDecimal.Cmp(expectedDecimal) < 0, nil
 		}
 		return actualString < expectedString, nil
 	case "LTE":
-		if canConvertToFloat {
-			return actualFloat <= expectedFloat, nil
+		if canCompareDecimals {
+			return actualDecimal.Cmp(expectedDecimal) <= 0, nil
 		}
 		return actualString <= expectedString, nil
 	case "EXISTS":
@@ -119,3 +224,45 @@ func IsOperatorArrayResultMet(operator string, expectedValue any, actualValue []
 	return false, nil
 
 }
+
+/*
+	IsQuantifiedArrayResultMet checks how many of the values meet the condition against the quantifier:
+	ANY (default) at least one value, ALL every value, NONE no value and COUNT compares the number of matching values with the count
+*/
+func IsQuantifiedArrayResultMet(quantifier string, operator string, expectedValue any, actualValue []any, countOperator string, count int) (bool, error) {
+	if !IsValidQuantifier(quantifier) {
+		return false, fmt.Errorf("invalid quantifier: %s", quantifier)
+	}
+	if quantifier == "" || quantifier == "ANY" {
+		return IsOperatorArrayResultMet(operator, expectedValue, actualValue)
+	}
+	if !IsValidOperator(operator) {
+		return false, fmt.Errorf("invalid operator: %s", operator)
+	}
+	if quantifier == "COUNT" && !IsValidCountOperator(countOperator) {
+		return false, fmt.Errorf("invalid count operator: %s", countOperator)
+	}
+
+	matches := 0
+	for _, value := range actualValue {
+		result, err := IsOperatorResultMet(operator, expectedValue, value)
+		if err != nil {
+			return false, err
+		}
+		if result {
+			matches++
+		}
+	}
+
+	switch quantifier {
+	case "ALL":
+		// An empty array has no values that meet the condition
+		return len(actualValue) > 0 && matches == len(actualValue), nil
+	case "NONE":
+		return matches == 0, nil
+	case "COUNT":
+		return IsOperatorResultMet(countOperator, count, matches)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,49 @@
+package expressions
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestIsOperatorResultMet(t *testing.T) {
+	t.Run("EQ compares numerically when one of the values is a number", func(t *testing.T) {
+		cases := []struct {
+			expected any
+			actual   any
+			isMet    bool
+		}{
+			{json.Number("7"), "007", true},
+			{7, "007", true},
+			{json.Number("150.5"), "150.50", true},
+			{json.Number("12345678901234567890"), json.Number("12345678901234567891"), false},
+			{"7", "007", false},
+			{json.Number("7"), "seven", false},
+		}
+		for _, c := range cases {
+			isMet, err := IsOperatorResultMet("EQ", c.expected, c.actual)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, isMet, c.isMet)
+
+			isMet, err = IsOperatorResultMet("NE", c.expected, c.actual)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, isMet, !c.isMet)
+		}
+	})
+
+	t.Run("null values", func(t *testing.T) {
+		isMet, err := IsOperatorResultMet("EQ", "null", nil)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, isMet, true)
+
+		isMet, err = IsOperatorResultMet("NE", "null", "value")
+		assert.Equal(t, err, nil)
+		assert.Equal(t, isMet, true)
+	})
+
+	t.Run("invalid operator", func(t *testing.T) {
+		_, err := IsOperatorResultMet("LIKE", "a", "a")
+		assert.NotEqual(t, err, nil)
+	})
+}
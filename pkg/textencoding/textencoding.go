@@ -0,0 +1,295 @@
+package textencoding
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Encodings of the text inputs and outputs
+const (
+	UTF8        = "UTF-8"
+	UTF8BOM     = "UTF-8-BOM"
+	UTF16LE     = "UTF-16LE"
+	UTF16BE     = "UTF-16BE"
+	Windows1252 = "WINDOWS-1252"
+	Latin1      = "ISO-8859-1"
+	ShiftJIS    = "SHIFT_JIS"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Bytes looked at to detect UTF-16 without a BOM
+const sampleSize = 4096
+
+/*
+IsText reports the data types decoded to UTF-8 before they are parsed
+*/
+func IsText(dataType string) bool {
+	switch dataType {
+	case "CSV", "SQL", "JSON", "JSONL", "FIXEDWIDTH", "YAML":
+		return true
+	}
+	return false
+}
+
+/*
+Decode converts the content to UTF-8 without a BOM, the encoding is detected when it's empty.
+Returns the encoding of the content, UTF-8-BOM when a UTF-8 content starts with a BOM.
+*/
+func Decode(content []byte, name string) ([]byte, string, error) {
+	if name == "" {
+		name = Detect(content)
+	}
+	name, err := Normalize(name)
+	if err != nil {
+		return nil, "", err
+	}
+	switch name {
+	case UTF8, UTF8BOM:
+		if bytes.HasPrefix(content, bomUTF8) {
+			return content[len(bomUTF8):], UTF8BOM, nil
+		}
+		return content, name, nil
+	case UTF16LE:
+		content = bytes.TrimPrefix(content, bomUTF16LE)
+	case UTF16BE:
+		content = bytes.TrimPrefix(content, bomUTF16BE)
+	}
+	decoded, err := encodingOf(name).NewDecoder().Bytes(content)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not decode your input as %s: %v", name, err)
+	}
+	// A BOM can be written in the encoding itself
+	return bytes.TrimPrefix(decoded, bomUTF8), name, nil
+}
+
+/*
+NewReader decodes the content of the reader to UTF-8 without a BOM as it's read, like Decode.
+The encoding is detected from the first bytes of the content when it's empty.
+*/
+func NewReader(reader io.Reader, name string) (io.Reader, string, error) {
+	buffered := bufio.NewReaderSize(reader, sampleSize)
+	if name == "" {
+		sample, err := buffered.Peek(sampleSize)
+		if err != nil && err != io.EOF {
+			return nil, "", fmt.Errorf("could not read your input: %v", err)
+		}
+		name = detectSample(sample, err == io.EOF)
+	}
+	name, err := Normalize(name)
+	if err != nil {
+		return nil, "", err
+	}
+	var bom []byte
+	switch name {
+	case UTF8, UTF8BOM:
+		if discardPrefix(buffered, bomUTF8) {
+			return buffered, UTF8BOM, nil
+		}
+		return buffered, name, nil
+	case UTF16LE:
+		bom = bomUTF16LE
+	case UTF16BE:
+		bom = bomUTF16BE
+	}
+	if bom != nil {
+		discardPrefix(buffered, bom)
+	}
+	decoded := bufio.NewReader(transform.NewReader(buffered, encodingOf(name).NewDecoder()))
+	// A BOM can be written in the encoding itself
+	discardPrefix(decoded, bomUTF8)
+	return decoded, name, nil
+}
+
+/*
+Encode converts the UTF-8 content to the encoding.
+The BOM of UTF-8-BOM and UTF-16 is only written at the start of the file, when the content is its first part.
+*/
+func Encode(content []byte, name string, start bool) ([]byte, error) {
+	name, err := Normalize(name)
+	if err != nil {
+		return nil, err
+	}
+	var bom []byte
+	switch name {
+	case UTF8:
+		return content, nil
+	case UTF8BOM:
+		bom = bomUTF8
+	case UTF16LE:
+		bom = bomUTF16LE
+	case UTF16BE:
+		bom = bomUTF16BE
+	}
+	encoded := content
+	if name != UTF8BOM {
+		// Characters the encoding doesn't have are replaced (e.g. ? or \x1a)
+		encoded, err = encoding.ReplaceUnsupported(encodingOf(name).NewEncoder()).Bytes(content)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode the output as %s: %v", name, err)
+		}
+	}
+	if start && bom != nil {
+		encoded = append(append([]byte{}, bom...), encoded...)
+	}
+	return encoded, nil
+}
+
+/*
+Detect returns the encoding of the content: from its BOM, UTF-16 from the zero bytes of ASCII characters,
+UTF-8 when it's valid, then Shift_JIS when its double byte characters are valid and Windows-1252 otherwise.
+*/
+func Detect(content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, bomUTF8):
+		return UTF8BOM
+	case bytes.HasPrefix(content, bomUTF16LE):
+		return UTF16LE
+	case bytes.HasPrefix(content, bomUTF16BE):
+		return UTF16BE
+	}
+	if name := detectUTF16(content); name != "" {
+		return name
+	}
+	if utf8.Valid(content) {
+		return UTF8
+	}
+	if isShiftJIS(content) {
+		return ShiftJIS
+	}
+	return Windows1252
+}
+
+/*
+Normalize returns the name of the encoding from its name or alias (e.g. latin1, cp1252, sjis), case insensitive
+*/
+func Normalize(name string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "", "UTF-8", "UTF8":
+		return UTF8, nil
+	case "UTF-8-BOM", "UTF8-BOM", "UTF-8-SIG":
+		return UTF8BOM, nil
+	case "UTF-16LE", "UTF16LE", "UTF-16":
+		return UTF16LE, nil
+	case "UTF-16BE", "UTF16BE":
+		return UTF16BE, nil
+	case "WINDOWS-1252", "CP1252":
+		return Windows1252, nil
+	case "ISO-8859-1", "LATIN-1", "LATIN1":
+		return Latin1, nil
+	case "SHIFT_JIS", "SHIFT-JIS", "SJIS":
+		return ShiftJIS, nil
+	}
+	return "", fmt.Errorf("encoding %s not found", name)
+}
+
+/*
+	Helper functions
+*/
+func encodingOf(name string) encoding.Encoding {
+	switch name {
+	case UTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case UTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case Windows1252:
+		return charmap.Windows1252
+	case Latin1:
+		return charmap.ISO8859_1
+	case ShiftJIS:
+		return japanese.ShiftJIS
+	}
+	return unicode.UTF8
+}
+
+// detectSample detects the encoding from the first bytes of the content, the last character of the sample can be cut when it isn't the whole content
+func detectSample(sample []byte, isComplete bool) string {
+	name := Detect(sample)
+	if isComplete || (name != ShiftJIS && name != Windows1252) {
+		return name
+	}
+	// UTF-8 is checked first, its characters can also be read as Shift_JIS
+	for cut := 1; cut < utf8.UTFMax && cut < len(sample); cut++ {
+		if utf8.Valid(sample[:len(sample)-cut]) {
+			return UTF8
+		}
+	}
+	if name == Windows1252 && len(sample) > 0 && isShiftJIS(sample[:len(sample)-1]) {
+		return ShiftJIS
+	}
+	return name
+}
+
+// discardPrefix skips the prefix when the reader starts with it
+func discardPrefix(reader *bufio.Reader, prefix []byte) bool {
+	start, _ := reader.Peek(len(prefix))
+	if !bytes.Equal(start, prefix) {
+		return false
+	}
+	_, err := reader.Discard(len(prefix))
+	return err == nil
+}
+
+// detectUTF16 looks for the zero byte of ASCII characters, on the odd bytes for little endian and the even bytes for big endian
+func detectUTF16(content []byte) string {
+	sample := content[:min(len(content), sampleSize)]
+	pairs := len(sample) / 2
+	if pairs == 0 {
+		return ""
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	switch {
+	case oddZeros*10 >= pairs*3 && evenZeros*10 < pairs:
+		return UTF16LE
+	case evenZeros*10 >= pairs*3 && oddZeros*10 < pairs:
+		return UTF16BE
+	}
+	return ""
+}
+
+// isShiftJIS checks the lead and trail bytes of the double byte characters, there must be at least one
+func isShiftJIS(content []byte) bool {
+	doubleBytes := 0
+	for i := 0; i < len(content); i++ {
+		lead := content[i]
+		switch {
+		case lead < 0x80 || (lead >= 0xA1 && lead <= 0xDF):
+			// ASCII and half width katakana
+		case (lead >= 0x81 && lead <= 0x9F) || (lead >= 0xE0 && lead <= 0xFC):
+			if i+1 >= len(content) {
+				return false
+			}
+			trail := content[i+1]
+			if trail < 0x40 || trail == 0x7F || trail > 0xFC {
+				return false
+			}
+			doubleBytes++
+			i++
+		default:
+			return false
+		}
+	}
+	return doubleBytes > 0
+}
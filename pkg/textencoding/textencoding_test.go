@@ -0,0 +1,96 @@
+package textencoding
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestDecode(t *testing.T) {
+	t.Run("encodings detected and decoded to UTF-8", func(t *testing.T) {
+		cases := []struct {
+			content  []byte
+			encoding string
+		}{
+			{[]byte("\xEF\xBB\xBFid,name\n1,Zoë\n"), UTF8BOM},
+			{[]byte("id,name\n1,Zoë\n"), UTF8},
+			{[]byte("\xFF\xFEi\x00d\x00,\x00n\x00a\x00m\x00e\x00\n\x001\x00,\x00Z\x00o\x00\xEB\x00\n\x00"), UTF16LE},
+			{[]byte("\x00i\x00d\x00,\x00n\x00a\x00m\x00e\x00\n\x001\x00,\x00Z\x00o\x00\xEB\x00\n"), UTF16BE},
+			{[]byte("id,name\n1,Zo\xEB\n"), Windows1252},
+		}
+		for _, testCase := range cases {
+			decoded, encoding, err := Decode(testCase.content, "")
+			if err != nil {
+				t.Fatalf("Failed to decode %s: %v", testCase.encoding, err)
+			}
+			assert.Equal(t, encoding, testCase.encoding)
+			assert.Equal(t, string(decoded), "id,name\n1,Zoë\n")
+		}
+
+		decoded, encoding, err := Decode([]byte("id,name\n1,\x93\xFA\x96\x7B\n"), "")
+		if err != nil {
+			t.Fatalf("Failed to decode Shift_JIS: %v", err)
+		}
+		assert.Equal(t, encoding, ShiftJIS)
+		assert.Equal(t, string(decoded), "id,name\n1,日本\n")
+
+		// Latin-1 is only used when it's set, it's detected as Windows-1252
+		decoded, encoding, err = Decode([]byte("1,Zo\xEB"), "latin1")
+		if err != nil {
+			t.Fatalf("Failed to decode Latin-1: %v", err)
+		}
+		assert.Equal(t, encoding, Latin1)
+		assert.Equal(t, string(decoded), "1,Zoë")
+
+		_, _, err = Decode([]byte("1"), "EBCDIC")
+		assert.NotEqual(t, err, nil)
+	})
+
+	t.Run("decoded as it's read", func(t *testing.T) {
+		for content, expected := range map[string]string{
+			"\xEF\xBB\xBFid,name\n1,Zoë\n": UTF8BOM,
+			"\xFF\xFEi\x00d\x00,\x00n\x00a\x00m\x00e\x00\n\x001\x00,\x00Z\x00o\x00\xEB\x00\n\x00": UTF16LE,
+			"id,name\n1,Zo\xEB\n": Windows1252,
+		} {
+			reader, encoding, err := NewReader(strings.NewReader(content), "")
+			if err != nil {
+				t.Fatalf("Failed to open %s: %v", expected, err)
+			}
+			decoded, _ := io.ReadAll(reader)
+			assert.Equal(t, encoding, expected)
+			assert.Equal(t, string(decoded), "id,name\n1,Zoë\n")
+		}
+
+		// The first bytes end in the middle of a character
+		content := strings.Repeat("a", sampleSize-1) + "ë"
+		reader, encoding, err := NewReader(strings.NewReader(content), "")
+		if err != nil {
+			t.Fatalf("Failed to open UTF-8: %v", err)
+		}
+		decoded, _ := io.ReadAll(reader)
+		assert.Equal(t, encoding, UTF8)
+		assert.Equal(t, string(decoded), content)
+	})
+
+	t.Run("BOM only written at the start of the output", func(t *testing.T) {
+		encoded, err := Encode([]byte("1,Zoë\n"), UTF8BOM, true)
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		assert.Equal(t, encoded, []byte("\xEF\xBB\xBF1,Zoë\n"))
+
+		encoded, err = Encode([]byte("ë"), UTF16LE, false)
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		assert.Equal(t, encoded, []byte("\xEB\x00"))
+
+		encoded, err = Encode([]byte("Zoë 日本"), Windows1252, true)
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		assert.Equal(t, encoded, []byte("Zo\xEB \x1A\x1A"))
+	})
+}
@@ -3,6 +3,8 @@ package types
 type RequestBodyPaginate struct {
 	Input  Input  `json:"input" validate:"required"`
 	Output Output `json:"output" validate:"required"`
+	// XML: name of the repeating element the pages are split on, defaults to the first repeated child of the root
+	RecordElement string `json:"recordElement,omitempty"`
 }
 
 type Attributes struct {
@@ -20,4 +22,26 @@ type RequestBodyTransform struct {
 	Output  Output   `json:"output" validate:"required"`
 	Rules   []Rule   `json:"rules" validate:"required"`
 	Webhook *Webhook `json:"webhook,omitempty"`
+	// Stop processing a record after the first rule that matches it (same as stopProcessing on every rule)
+	StopAfterFirstMatch bool `json:"stopAfterFirstMatch,omitempty"`
+}
+
+type RequestBodyValidateRules struct {
+	Rules []Rule `json:"rules" validate:"required"`
+	// Optional, the field names are checked against the paths of the input document
+	Input *Input `json:"input,omitempty"`
+	// Optional, the attribute paths returned by paginate (used instead of the input)
+	Paths []string `json:"paths,omitempty"`
+	// CSV, JSON, JSONL, SQL, PARQUET, AVRO, XML, XLSX, FIXEDWIDTH, YAML, ARROW, ARROWSTREAM, PROTOBUF - defaults to the input data type
+	DataType string `json:"dataType,omitempty"`
+	// Same as the transform option, used to find unreachable rules
+	StopAfterFirstMatch bool `json:"stopAfterFirstMatch,omitempty"`
+}
+
+type ValidationResult struct {
+	Valid bool `json:"valid"`
+	// Problems that make the transform fail or silently skip a rule
+	Errors []TransformError `json:"errors"`
+	// Rules that are valid but most likely not what was intended (duplicates, unreachable)
+	Warnings []TransformError `json:"warnings"`
 }
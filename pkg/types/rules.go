@@ -5,6 +5,7 @@ type TransformError struct {
 	RuleIndex       *int   `json:"ruleIndex,omitempty"`
 	ActionIndex     *int   `json:"actionIndex,omitempty"`
 	ExpressionIndex *int   `json:"expressionIndex,omitempty"`
+	ElseActionIndex *int   `json:"elseActionIndex,omitempty"`
 	Key             string `json:"key,omitempty"`
 }
 
@@ -22,9 +23,20 @@ type Expressions struct {
 	FieldName string      `json:"fieldName"`
 	Operator  string      `json:"operator"`
 	Value     any 				`json:"value"`
+	// ANY (default), ALL, NONE or COUNT, applied to the values matched by a wildcard (*) field name
+	Quantifier    string `json:"quantifier,omitempty"`
+	// Used by the COUNT quantifier to compare the number of matching values with count
+	CountOperator string `json:"countOperator,omitempty"`
+	Count         int    `json:"count,omitempty"`
 }
 
 type Rule struct {
 	Expression Expression `json:"expression,omitempty"`
 	Actions    []Action   `json:"actions"`
+	// Run when the expression is not met
+	ElseActions []Action `json:"elseActions,omitempty"`
+	// Rules with a higher priority run first, rules with the same priority keep their order
+	Priority int `json:"priority,omitempty"`
+	// No further rules are applied to the record once this rule's expression is met
+	StopProcessing bool `json:"stopProcessing,omitempty"`
 }
@@ -40,16 +40,116 @@ type SourceCredential struct {
 	Resources Resources `json:"resources"`
 }
 
+type XlsxOptions struct {
+	// Name of the sheet, used instead of the index when set
+	Sheet string `json:"sheet,omitempty"`
+	// 0 based index of the sheet, defaults to the first sheet
+	SheetIndex int `json:"sheetIndex,omitempty"`
+	// 1 based number of the header row, the rows above it are left untouched - defaults to 1
+	HeaderRow int `json:"headerRow,omitempty"`
+}
+
+type FlattenOptions struct {
+	// JOIN, INDEX or EXPLODE: arrays written in one column, a column per element (items[0].sku) or a row per element - defaults to INDEX
+	Arrays string `json:"arrays,omitempty"`
+	// Between the joined values of an array, and split on when unflattening [*] columns - defaults to |
+	Separator string `json:"separator,omitempty"`
+}
+
+type FixedWidthField struct {
+	Name string `json:"name"`
+	// 1 based position of the first character of the field on the line
+	Start int `json:"start"`
+	// Number of characters of the field
+	Length int `json:"length"`
+	// LEFT or RIGHT: the side of the field the value is written on, the padding fills the other side - defaults to LEFT
+	Alignment string `json:"alignment,omitempty"`
+	// Single character filling the field around the value, e.g. "0" for numbers - defaults to a space
+	Padding string `json:"padding,omitempty"`
+}
+
+type FixedWidthLayout struct {
+	Fields []FixedWidthField `json:"fields"`
+	// Lines at the start of the file that aren't records (e.g. a header record), they are left untouched
+	HeaderLines int `json:"headerLines,omitempty"`
+}
+
+type JsonFormat struct {
+	// SOURCE, COMPACT or INDENT: the layout of the input, on one line, or indented with indent - defaults to SOURCE
+	Style string `json:"style,omitempty"`
+	// Spaces or tabs written per level with INDENT - defaults to a tab
+	Indent string `json:"indent,omitempty"`
+}
+
+type SqlScript struct {
+	// CSV or INSERT: the rows as CSV, or a script creating the table and inserting the rows - defaults to CSV
+	Format string `json:"format,omitempty"`
+	// POSTGRES or MYSQL: how the names and strings are quoted and the column types written - defaults to POSTGRES
+	Dialect string `json:"dialect,omitempty"`
+	// Name of the created table, "schema.table" is quoted as two names - defaults to the table of the input reference, or "data"
+	Table string `json:"table,omitempty"`
+	// Rows inserted per INSERT statement - defaults to 100
+	BatchSize int `json:"batchSize,omitempty"`
+}
+
+type ProtobufOptions struct {
+	// Fully qualified name of the message of the stream, e.g. "events.v1.Event"
+	Message string `json:"message"`
+	// Base64 of a serialized FileDescriptorSet with the file of the message and its imports (protoc --include_imports --descriptor_set_out)
+	DescriptorSet string `json:"descriptorSet,omitempty"`
+	// The descriptor set file in the storage of the input, read with its credential - used when descriptorSet is empty
+	DescriptorSetReference *SourceReference `json:"descriptorSetReference,omitempty"`
+}
+
+type CsvDialect struct {
+	// Single character between the fields, e.g. "," ";" "|" or "\t" - sniffed from the input when empty, the output defaults to the input
+	Delimiter string `json:"delimiter,omitempty"`
+	// Quote character - defaults to "
+	Quote string `json:"quote,omitempty"`
+	// Character escaping a quote in a quoted field, e.g. "\\" - quotes are escaped by doubling them when empty
+	Escape string `json:"escape,omitempty"`
+	// false when the file has no header row, the columns are then addressed by position: "1", "2", ... - defaults to true
+	HasHeader *bool `json:"hasHeader,omitempty"`
+	// CRLF or LF - sniffed from the input when empty, the output defaults to the input
+	LineTerminator string `json:"lineTerminator,omitempty"`
+}
+
 type Input struct {
 	StorageType string           `json:"storageType"`
-	DataType    string           `json:"dataType"` // CSV, JSON, JSONL, SQL
+	DataType    string           `json:"dataType"` // CSV, JSON, JSONL, SQL, PARQUET, AVRO, XML, XLSX, FIXEDWIDTH, YAML, ARROW, ARROWSTREAM, PROTOBUF
 	Reference   SourceReference  `json:"reference"`
 	Credential  SourceCredential `json:"credential"`
+	// CSV, SQL, JSON, JSONL, FIXEDWIDTH, YAML: UTF-8, UTF-8-BOM, UTF-16LE, UTF-16BE, WINDOWS-1252, ISO-8859-1, SHIFT_JIS - detected when empty
+	Encoding string `json:"encoding,omitempty"`
+	// CSV
+	Csv *CsvDialect `json:"csv,omitempty"`
+	// XLSX
+	Xlsx *XlsxOptions `json:"xlsx,omitempty"`
+	// FIXEDWIDTH
+	FixedWidth *FixedWidthLayout `json:"fixedWidth,omitempty"`
+	// PROTOBUF
+	Protobuf *ProtobufOptions `json:"protobuf,omitempty"`
+	// Content that was already downloaded, e.g. a file of a zip archive - not part of the request
+	Content []byte `json:"-"`
 }
 
 type Output struct {
 	StorageType string           `json:"storageType"`
-	DataType    string           `json:"dataType"` // CSV, JSON, JSONL, SQL
+	// CSV, JSON, JSONL, SQL, PARQUET, AVRO, XML, XLSX, FIXEDWIDTH, YAML, ARROW, ARROWSTREAM, PROTOBUF - the input data type when empty.
+	// CSV, SQL, JSON and JSONL inputs are converted when it's CSV, JSON or JSONL
+	DataType    string           `json:"dataType"`
 	Reference   SourceReference  `json:"reference"`
 	Credential  SourceCredential `json:"credential"`
+	// CSV, SQL, JSON, JSONL, FIXEDWIDTH, YAML: same values as the input encoding - defaults to the input encoding
+	Encoding string `json:"encoding,omitempty"`
+	// CSV
+	Csv *CsvDialect `json:"csv,omitempty"`
+	// SQL
+	Sql *SqlScript `json:"sql,omitempty"`
+	// GZIP, ZSTD - not compressed when empty
+	Compression string `json:"compression,omitempty"`
+	// JSON
+	Json *JsonFormat `json:"json,omitempty"`
+	// JSON, JSONL to CSV: nested values are flattened into dot-path columns. CSV, SQL to JSON, JSONL: the dot-path headers are unflattened
+	Flatten *FlattenOptions `json:"flatten,omitempty"`
 }
@@ -2,14 +2,26 @@ package routes
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"lazy-lagoon/pkg/compression"
 	"lazy-lagoon/pkg/httphelper"
+	"lazy-lagoon/pkg/textencoding"
 	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"lazy-lagoon/transformjson"
 	"lazy-lagoon/transformcsv"
+	"lazy-lagoon/transformparquet"
+	"lazy-lagoon/transformavro"
+	"lazy-lagoon/transformxml"
+	"lazy-lagoon/transformxlsx"
+	"lazy-lagoon/transformfixedwidth"
+	"lazy-lagoon/transformyaml"
+	"lazy-lagoon/transformarrow"
+	"lazy-lagoon/transformprotobuf"
 )
 
 func sendError(c *gin.Context, status int, err error, webhook *types.Webhook) {
@@ -45,7 +57,10 @@ func sendTransformError(c *gin.Context, status int, transformErr *types.Transfor
 
 func bindAndValidate(c *gin.Context, requestData any) error {
 	validate := validator.New()
-	err := c.ShouldBindJSON(requestData)
+	// Numbers in the request body (rule values) are decoded as json.Number so large ids and decimals are compared exactly
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	err := decoder.Decode(requestData)
 	if err != nil {
 		return err
 	}
@@ -56,6 +71,28 @@ func bindAndValidate(c *gin.Context, requestData any) error {
 	return nil
 }
 
+// S3 objects are streamed unless they are zip archives (from the extension of the key), the other storage types are downloaded once
+func needsDownload(input types.Input) bool {
+	if input.Content == nil && (input.StorageType == "S3" || input.StorageType == "FILE") {
+		return compression.Detect(nil, input.Reference.Prefix) == compression.Zip
+	}
+	return true
+}
+
+// Downloads the input, the first file of a zip archive, and decodes the text data types to UTF-8
+func getInputBytes(input types.Input) ([]byte, error) {
+	files, err := storage.GetFiles(input)
+	if err != nil {
+		return nil, err
+	}
+	input.Content = files[0].Content
+	if textencoding.IsText(input.DataType) {
+		bytesContent, _, err := storage.GetText(input)
+		return bytesContent, err
+	}
+	return input.Content, nil
+}
+
 // Extracts the paths of the fields in the document
 func extractPaths(byteContent []byte, dataType string) ([]string, error) {
 	switch dataType {
@@ -66,11 +103,7 @@ func extractPaths(byteContent []byte, dataType string) ([]string, error) {
 		}
 		return extractJsonPaths(jsonDocument, "", []string{}), nil
 	case "CSV":
-		csvDocument, err := transformcsv.ToCsv(byteContent)
-		if err != nil {
-			return nil, err
-		}
-		return extractCsvHeaders(csvDocument), nil
+		return extractCsvPaths(byteContent, nil)
 	case "JSONL":
 		paths := []string{}
 		lines := bytes.Split(byteContent, []byte("\n"))
@@ -88,24 +121,102 @@ func extractPaths(byteContent []byte, dataType string) ([]string, error) {
 			}
 		}
 		return paths, nil
+	case "PARQUET":
+		return transformparquet.Paths(byteContent)
+	case "AVRO":
+		return transformavro.Paths(byteContent)
+	case "XML":
+		xmlDocument, err := transformxml.ToDocument(byteContent)
+		if err != nil {
+			return nil, err
+		}
+		return extractJsonPaths(xmlDocument, "", []string{}), nil
+	case "XLSX":
+		return transformxlsx.Paths(byteContent, nil)
+	case "ARROW", "ARROWSTREAM":
+		return transformarrow.Paths(byteContent)
+	case "YAML":
+		documents, err := transformyaml.ToDocuments(byteContent)
+		if err != nil {
+			return nil, err
+		}
+		paths := []string{}
+		for _, document := range documents {
+			paths = extractJsonPaths(document, "", paths)
+		}
+		return paths, nil
 	}
 
 	return nil, nil
 }
 
+// Extracts the paths of the fields in the input, with the dialect of the input for CSV, the sheet options for XLSX, the layout for FIXEDWIDTH
+// and the message of the descriptor set for PROTOBUF
+func extractInputPaths(byteContent []byte, input types.Input) ([]string, error) {
+	switch input.DataType {
+	case "CSV":
+		return extractCsvPaths(byteContent, input.Csv)
+	case "XLSX":
+		return transformxlsx.Paths(byteContent, input.Xlsx)
+	case "FIXEDWIDTH":
+		return transformfixedwidth.Paths(input.FixedWidth)
+	case "PROTOBUF":
+		descriptor, err := transformprotobuf.MessageDescriptor(input)
+		if err != nil {
+			return nil, err
+		}
+		documents, err := transformprotobuf.ToDocuments(byteContent, descriptor)
+		if err != nil {
+			return nil, err
+		}
+		paths := []string{}
+		for _, document := range documents {
+			paths = extractJsonPaths(document, "", paths)
+		}
+		return paths, nil
+	}
+	return extractPaths(byteContent, input.DataType)
+}
+
+// Extracts the header of the CSV content read with its dialect
+func extractCsvPaths(byteContent []byte, settings *types.CsvDialect) ([]string, error) {
+	dialect, err := transformcsv.InputDialect(settings, byteContent)
+	if err != nil {
+		return nil, err
+	}
+	header, err := transformcsv.ReadHeader(byteContent, dialect)
+	if err != nil {
+		return nil, err
+	}
+	return extractCsvHeaders([][]string{header}), nil
+}
+
 // extractJSONPaths extracts all paths from a JSON document
 func extractJsonPaths(jsonObj any, currentPath string, paths []string) []string {
 	if jsonObj == nil {
 		return paths
 	}
 
+	// Handle objects, the paths are in the order of the keys
+	if object, ok := jsonObj.(*transformjson.Object); ok {
+		for _, key := range object.Keys() {
+			value, _ := object.Get(key)
+			// Keys with dots or brackets are quoted so the path reads back as a rule field name
+			newPath := transformjson.KeyPath(currentPath, key)
+			if !contains(paths, newPath) {
+				paths = append(paths, newPath)
+			}
+			if value != nil {
+				paths = extractJsonPaths(value, newPath, paths)
+			}
+		}
+		return paths
+	}
+
 	// Handle maps (JSON objects)
 	if m, ok := jsonObj.(map[string]any); ok {
 		for key, value := range m {
-			newPath := key
-			if currentPath != "" {
-				newPath = currentPath + "." + key
-			}
+			newPath := transformjson.KeyPath(currentPath, key)
 
 			// Add the current path
 			if !contains(paths, newPath) {
@@ -176,3 +287,13 @@ func contains(slice []string, item string) bool {
 	}
 	return false
 }
+
+// stopAfterFirstMatch returns a copy of the rules with stopProcessing set on every rule
+func stopAfterFirstMatch(rules []types.Rule) []types.Rule {
+	stopped := make([]types.Rule, len(rules))
+	for i, rule := range rules {
+		rule.StopProcessing = true
+		stopped[i] = rule
+	}
+	return stopped
+}
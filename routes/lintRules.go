@@ -0,0 +1,298 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lazy-lagoon/pkg/expressions"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/transformjson"
+)
+
+// validActionTypes contains the action types the transforms understand
+var validActionTypes = []string{"REDACT", "EXCLUDE"}
+
+/*
+lintRules checks the rules without running them. Field names are only checked against the paths when paths are given.
+*/
+func lintRules(rules []types.Rule, dataType string, paths []string) types.ValidationResult {
+	result := types.ValidationResult{
+		Errors:   []types.TransformError{},
+		Warnings: []types.TransformError{},
+	}
+	isTabular := dataType == "CSV" || dataType == "SQL" || dataType == "XLSX" || dataType == "FIXEDWIDTH" || dataType == "ARROW" || dataType == "ARROWSTREAM"
+
+	for ruleIndex, rule := range rules {
+		/*
+			Duplicate and unreachable rules
+		*/
+		for previousIndex := 0; previousIndex < ruleIndex; previousIndex++ {
+			if reflect.DeepEqual(rules[previousIndex], rule) {
+				result.Warnings = append(result.Warnings, types.TransformError{
+					Message:   fmt.Sprintf("duplicate of rule %d", previousIndex),
+					RuleIndex: &ruleIndex,
+				})
+				break
+			}
+		}
+		if len(rule.Actions) == 0 && len(rule.ElseActions) == 0 && !rule.StopProcessing {
+			result.Warnings = append(result.Warnings, types.TransformError{
+				Message:   "rule has no actions",
+				RuleIndex: &ruleIndex,
+				Key:       "actions",
+			})
+		}
+		if reason := unreachableReason(rule.Expression); reason != "" {
+			result.Warnings = append(result.Warnings, types.TransformError{
+				Message:   "rule can never match: " + reason,
+				RuleIndex: &ruleIndex,
+				Key:       "expression",
+			})
+		}
+
+		/*
+			Expressions
+		*/
+		for expressionIndex, exp := range rule.Expression.Expressions {
+			issue := func(message string, key string) types.TransformError {
+				return types.TransformError{
+					Message:         message,
+					RuleIndex:       &ruleIndex,
+					ExpressionIndex: &expressionIndex,
+					Key:             key,
+				}
+			}
+			if exp.FieldName == "" {
+				// Reported as unreachable
+				continue
+			}
+			if message := checkFieldName(exp.FieldName, isTabular, paths); message != "" {
+				result.Errors = append(result.Errors, issue(message, "fieldName"))
+			}
+			if !expressions.IsValidOperator(exp.Operator) {
+				result.Errors = append(result.Errors, issue("invalid operator: "+exp.Operator, "operator"))
+			} else if message := checkValueType(exp.Operator, exp.Value); message != "" {
+				result.Errors = append(result.Errors, issue(message, "value"))
+			}
+			if !expressions.IsValidQuantifier(exp.Quantifier) {
+				result.Errors = append(result.Errors, issue("invalid quantifier: "+exp.Quantifier, "quantifier"))
+			} else if exp.Quantifier == "COUNT" && !expressions.IsValidCountOperator(exp.CountOperator) {
+				result.Errors = append(result.Errors, issue("invalid count operator: "+exp.CountOperator, "countOperator"))
+			} else if exp.Quantifier != "" && !isTabular && exp.Quantifier != "ANY" && !hasSelector(exp.FieldName) {
+				// Rejected by the transform, the quantifier has no array to apply to
+				result.Errors = append(result.Errors, issue("quantifier "+exp.Quantifier+" needs a *, slice, filter or recursive descent in the field name", "quantifier"))
+			} else if exp.Quantifier != "" && (isTabular || !hasSelector(exp.FieldName)) {
+				result.Warnings = append(result.Warnings, issue("quantifier has no effect without a wildcard (*) in the field name", "quantifier"))
+			}
+		}
+
+		/*
+			Actions
+		*/
+		lintActions(&result, rule.Actions, ruleIndex, false, isTabular, paths)
+		lintActions(&result, rule.ElseActions, ruleIndex, true, isTabular, paths)
+	}
+
+	/*
+		Rules that are never evaluated because an earlier rule (by priority) always matches and stops processing
+	*/
+	order := make([]int, len(rules))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return rules[order[i]].Priority > rules[order[j]].Priority
+	})
+	for position, ruleIndex := range order {
+		rule := rules[ruleIndex]
+		if !rule.StopProcessing || rule.Expression.Expressions != nil {
+			continue
+		}
+		for _, skippedIndex := range order[position+1:] {
+			result.Warnings = append(result.Warnings, types.TransformError{
+				Message:   fmt.Sprintf("rule is never evaluated, rule %d always matches and stops processing", ruleIndex),
+				RuleIndex: &skippedIndex,
+			})
+		}
+		break
+	}
+
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// lintActions checks the action types and field names, else actions are reported with elseActionIndex
+func lintActions(result *types.ValidationResult, actions []types.Action, ruleIndex int, isElse bool, isTabular bool, paths []string) {
+	for actionIndex, action := range actions {
+		issue := func(message string, key string) types.TransformError {
+			transformErr := types.TransformError{
+				Message:   message,
+				RuleIndex: &ruleIndex,
+				Key:       key,
+			}
+			if isElse {
+				transformErr.ElseActionIndex = &actionIndex
+			} else {
+				transformErr.ActionIndex = &actionIndex
+			}
+			return transformErr
+		}
+		if !slices.Contains(validActionTypes, action.ActionType) {
+			result.Errors = append(result.Errors, issue("invalid action type: "+action.ActionType, "actionType"))
+		}
+		if action.FieldName == "" {
+			result.Warnings = append(result.Warnings, issue("action has no field name and is skipped", "fieldName"))
+			continue
+		}
+		if message := checkFieldName(action.FieldName, isTabular, paths); message != "" {
+			result.Errors = append(result.Errors, issue(message, "fieldName"))
+		}
+		for previousIndex := 0; previousIndex < actionIndex; previousIndex++ {
+			if actions[previousIndex] == action {
+				result.Warnings = append(result.Warnings, issue(fmt.Sprintf("duplicate of action %d", previousIndex), "fieldName"))
+				break
+			}
+		}
+	}
+}
+
+// checkFieldName checks the field name is a valid path and, when paths are given, that it exists in the data
+func checkFieldName(fieldName string, isTabular bool, paths []string) string {
+	if isTabular {
+		// CSV headers are used as is
+		if paths != nil && !slices.Contains(paths, fieldName) {
+			return fmt.Sprintf("column %s not found", fieldName)
+		}
+		return ""
+	}
+	pointer, err := transformjson.MakePointer(fieldName)
+	if err != nil {
+		return fmt.Sprintf("malformed path %s: %s", fieldName, err.Error())
+	}
+	if paths != nil && !pathExists(fieldName, pointer, paths) {
+		return fmt.Sprintf("path %s not found", fieldName)
+	}
+	return ""
+}
+
+// pathExists checks the pointer is one of the paths, they are compared token by token so quoted keys and JSON Pointers match the paths.
+// The tokens after the last recursive descent (.. or **) may be at any depth
+func pathExists(fieldName string, pointer []string, paths []string) bool {
+	descent := -1
+	for i, token := range pointer {
+		if transformjson.IsDescent(token) {
+			descent = i
+		}
+	}
+	return slices.ContainsFunc(paths, func(path string) bool {
+		pathPointer, err := transformjson.MakePointer(path)
+		if err != nil {
+			return path == fieldName
+		}
+		if descent < 0 {
+			return tokensMatch(pathPointer, pointer)
+		}
+		tail := pointer[descent+1:]
+		return len(pathPointer) >= len(tail) && tokensMatch(pathPointer[len(pathPointer)-len(tail):], tail)
+	})
+}
+
+// tokensMatch compares the tokens of a field name with the tokens of a path, the arrays of the paths are [*]
+// and match any index, slice or filter of the field name
+func tokensMatch(pathTokens []string, tokens []string) bool {
+	if len(pathTokens) != len(tokens) {
+		return false
+	}
+	for i, token := range tokens {
+		if token == pathTokens[i] {
+			continue
+		}
+		_, err := strconv.Atoi(token)
+		if pathTokens[i] != "*" || (err != nil && !transformjson.IsSelector(token)) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasSelector checks the path goes through an array with a *, slice, filter or recursive descent, malformed paths are reported on their own
+func hasSelector(fieldName string) bool {
+	pointer, err := transformjson.MakePointer(fieldName)
+	if err != nil {
+		return true
+	}
+	return slices.ContainsFunc(pointer, func(token string) bool {
+		return transformjson.IsSelector(token) || transformjson.IsDescent(token)
+	})
+}
+
+// checkValueType checks the expression value can be compared with the operator
+func checkValueType(operator string, value any) string {
+	switch value.(type) {
+	case map[string]any, []any:
+		return fmt.Sprintf("operator %s can't be used with an object or array value", operator)
+	}
+	switch {
+	case operator == "EXISTS":
+		if _, ok := value.(bool); !ok {
+			return "operator EXISTS expects a boolean value"
+		}
+	case expressions.IsSizeOperator(operator):
+		if !isNumber(value) {
+			return fmt.Sprintf("operator %s expects a number value", operator)
+		}
+	case operator == "GT" || operator == "GTE" || operator == "LT" || operator == "LTE":
+		switch value.(type) {
+		case json.Number, float64, int, string:
+		default:
+			return fmt.Sprintf("operator %s expects a number or string value", operator)
+		}
+	}
+	return ""
+}
+
+// isNumber checks the value is a number or a string holding a number
+func isNumber(value any) bool {
+	switch typedValue := value.(type) {
+	case json.Number, float64, int:
+		return true
+	case string:
+		_, ok := expressions.ToDecimal(typedValue)
+		return ok
+	}
+	return false
+}
+
+// unreachableReason explains why an expression can never be met, empty when it can
+func unreachableReason(expression types.Expression) string {
+	if expression.Expressions == nil {
+		return ""
+	}
+	if len(expression.Expressions) == 0 {
+		return "expressions is empty"
+	}
+	for _, exp := range expression.Expressions {
+		if exp.FieldName == "" {
+			return "an expression has no field name"
+		}
+	}
+	if expression.LogicalOperator == "AND" {
+		// The same field can't be equal to two different values
+		equals := map[string]any{}
+		for _, exp := range expression.Expressions {
+			if exp.Operator != "EQ" || strings.Contains(exp.FieldName, "*") {
+				continue
+			}
+			if previous, exists := equals[exp.FieldName]; exists && fmt.Sprintf("%v", previous) != fmt.Sprintf("%v", exp.Value) {
+				return fmt.Sprintf("%s can't equal both %v and %v", exp.FieldName, previous, exp.Value)
+			}
+			equals[exp.FieldName] = exp.Value
+		}
+	}
+	return ""
+}
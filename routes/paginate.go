@@ -6,10 +6,18 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
 
 	"lazy-lagoon/pkg/types"
 	"lazy-lagoon/storage"
+	"lazy-lagoon/transformavro"
+	"lazy-lagoon/transformcsv"
+	"lazy-lagoon/transformparquet"
+	"lazy-lagoon/transformxml"
+	"lazy-lagoon/transformxlsx"
+	"lazy-lagoon/transformfixedwidth"
+	"lazy-lagoon/transformyaml"
+	"lazy-lagoon/transformarrow"
+	"lazy-lagoon/transformprotobuf"
 
 	"github.com/gin-gonic/gin"
 )
@@ -35,16 +43,16 @@ func Paginate(c *gin.Context) {
 	totalPages := 0
 
 	/*
-		Downloading the file from the input storage type
+		Downloading the file from the input storage type, decoded to UTF-8 for the text data types
 	*/
-	bytesContent, err := storage.GetBytes(input)
+	bytesContent, err := getInputBytes(input)
 	if err != nil {
 		sendError(c, http.StatusBadRequest, err, nil)
 		return
 	}
 
 	// Get paths of the fields from the unMutated byte content to send as attributes
-	paths, err := extractPaths(bytesContent, input.DataType)
+	paths, err := extractInputPaths(bytesContent, input)
 	if err != nil {
 		sendError(c, http.StatusInternalServerError, err, nil)
 		return
@@ -54,7 +62,7 @@ func Paginate(c *gin.Context) {
 		Paginating the file based on the data type
 	*/
 	if input.DataType == "CSV" || input.DataType == "SQL" {
-		totalPages, err = PaginateCSV(bytesContent, chunkSize, output, storage.StoreBytes)
+		totalPages, err = PaginateCSV(bytesContent, chunkSize, input.Csv, output, storage.StoreBytes)
 		if err != nil {
 			sendError(c, http.StatusBadRequest, err, nil)
 			return
@@ -65,6 +73,54 @@ func Paginate(c *gin.Context) {
 			sendError(c, http.StatusBadRequest, err, nil)
 			return
 		}
+	} else if input.DataType == "PARQUET" {
+		totalPages, err = PaginateParquet(bytesContent, chunkSize, output, storage.StoreBytes)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err, nil)
+			return
+		}
+	} else if input.DataType == "AVRO" {
+		totalPages, err = PaginateAvro(bytesContent, chunkSize, output, storage.StoreBytes)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err, nil)
+			return
+		}
+	} else if input.DataType == "XML" {
+		totalPages, err = PaginateXML(bytesContent, chunkSize, requestData.RecordElement, output, storage.StoreBytes)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err, nil)
+			return
+		}
+	} else if input.DataType == "XLSX" {
+		totalPages, err = PaginateXLSX(bytesContent, chunkSize, input.Xlsx, output, storage.StoreBytes)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err, nil)
+			return
+		}
+	} else if input.DataType == "FIXEDWIDTH" {
+		totalPages, err = PaginateFixedWidth(bytesContent, chunkSize, input.FixedWidth, output, storage.StoreBytes)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err, nil)
+			return
+		}
+	} else if input.DataType == "YAML" {
+		totalPages, err = PaginateYAML(bytesContent, chunkSize, output, storage.StoreBytes)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err, nil)
+			return
+		}
+	} else if input.DataType == "ARROW" || input.DataType == "ARROWSTREAM" {
+		totalPages, err = PaginateArrow(bytesContent, chunkSize, input.DataType, output, storage.StoreBytes)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err, nil)
+			return
+		}
+	} else if input.DataType == "PROTOBUF" {
+		totalPages, err = PaginateProtobuf(bytesContent, chunkSize, output, storage.StoreBytes)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err, nil)
+			return
+		}
 	} else if input.DataType == "JSON" {
 		log.Println("JSON is not supported for pagination, but we still return the attributes")
 	}
@@ -84,16 +140,15 @@ func Paginate(c *gin.Context) {
 }
 
 /*
-Paginate the CSV file into chunks - used for preview
+Paginate the CSV file into chunks - used for preview.
+The input is read with its dialect and the pages are comma separated, files without a header get the column positions as header.
 */
-func PaginateCSV(bytesContent []byte, chunkSize int, output types.Output, storeBytes func(output types.Output, content []byte) error) (totalPages int, err error) {
-	reader := csv.NewReader(strings.NewReader(string(bytesContent)))
-	reader.Comma = ','
-	reader.LazyQuotes = true
-	reader.FieldsPerRecord = -1
-	reader.TrimLeadingSpace = true
-
-	lines, err := reader.ReadAll()
+func PaginateCSV(bytesContent []byte, chunkSize int, settings *types.CsvDialect, output types.Output, storeBytes func(output types.Output, content []byte) error) (totalPages int, err error) {
+	dialect, err := transformcsv.InputDialect(settings, bytesContent)
+	if err != nil {
+		return 0, err
+	}
+	lines, err := transformcsv.ReadCsv(bytesContent, dialect)
 	if err != nil {
 		return 0, fmt.Errorf("file was not able to process, please use a different file")
 	}
@@ -101,6 +156,9 @@ func PaginateCSV(bytesContent []byte, chunkSize int, output types.Output, storeB
 	if len(lines) == 0 {
 		return 0, nil
 	}
+	if !dialect.HasHeader {
+		lines = append([][]string{dialect.Header(lines)}, lines...)
+	}
 
 	totalPages = 0
 	position := 0
@@ -196,3 +254,167 @@ func PaginateJSONL(byteContent []byte, chunkSize int, output types.Output, store
 
 	return totalPages, nil
 }
+
+/*
+Paginate the Parquet file into Parquet pages with the same schema - used for preview
+*/
+func PaginateParquet(byteContent []byte, chunkSize int, output types.Output, storeBytes func(output types.Output, content []byte) error) (totalPages int, err error) {
+	pages, err := transformparquet.Pages(byteContent, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, page := range pages {
+		totalPages++
+		outputCopy := output
+		outputCopy.Reference.Prefix = fmt.Sprintf("%s/pages/%d.parquet", output.Reference.Prefix, totalPages)
+		err = storeBytes(outputCopy, page)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return totalPages, nil
+}
+
+/*
+Paginate the Avro file into Avro pages with the same schema - used for preview
+*/
+func PaginateAvro(byteContent []byte, chunkSize int, output types.Output, storeBytes func(output types.Output, content []byte) error) (totalPages int, err error) {
+	pages, err := transformavro.Pages(byteContent, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, page := range pages {
+		totalPages++
+		outputCopy := output
+		outputCopy.Reference.Prefix = fmt.Sprintf("%s/pages/%d.avro", output.Reference.Prefix, totalPages)
+		err = storeBytes(outputCopy, page)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return totalPages, nil
+}
+
+/*
+Paginate the XML file on the repeating record element - used for preview
+*/
+func PaginateXML(byteContent []byte, chunkSize int, recordElement string, output types.Output, storeBytes func(output types.Output, content []byte) error) (totalPages int, err error) {
+	pages, err := transformxml.Pages(byteContent, recordElement, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, page := range pages {
+		totalPages++
+		outputCopy := output
+		outputCopy.Reference.Prefix = fmt.Sprintf("%s/pages/%d.xml", output.Reference.Prefix, totalPages)
+		err = storeBytes(outputCopy, page)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return totalPages, nil
+}
+
+/*
+Paginate the sheet of the XLSX file into workbooks with the header row - used for preview
+*/
+func PaginateXLSX(byteContent []byte, chunkSize int, options *types.XlsxOptions, output types.Output, storeBytes func(output types.Output, content []byte) error) (totalPages int, err error) {
+	pages, err := transformxlsx.Pages(byteContent, options, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, page := range pages {
+		totalPages++
+		outputCopy := output
+		outputCopy.Reference.Prefix = fmt.Sprintf("%s/pages/%d.xlsx", output.Reference.Prefix, totalPages)
+		err = storeBytes(outputCopy, page)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return totalPages, nil
+}
+
+/*
+Paginate the FIXEDWIDTH file into files of the header lines and the record lines - used for preview
+*/
+func PaginateFixedWidth(byteContent []byte, chunkSize int, settings *types.FixedWidthLayout, output types.Output, storeBytes func(output types.Output, content []byte) error) (totalPages int, err error) {
+	pages, err := transformfixedwidth.Pages(byteContent, settings, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, page := range pages {
+		totalPages++
+		outputCopy := output
+		outputCopy.Reference.Prefix = fmt.Sprintf("%s/pages/%d.txt", output.Reference.Prefix, totalPages)
+		err = storeBytes(outputCopy, page)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return totalPages, nil
+}
+
+/*
+Paginate the YAML stream into streams of documents like JSONL lines - used for preview
+*/
+func PaginateYAML(byteContent []byte, chunkSize int, output types.Output, storeBytes func(output types.Output, content []byte) error) (totalPages int, err error) {
+	pages, err := transformyaml.Pages(byteContent, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, page := range pages {
+		totalPages++
+		outputCopy := output
+		outputCopy.Reference.Prefix = fmt.Sprintf("%s/pages/%d.yaml", output.Reference.Prefix, totalPages)
+		err = storeBytes(outputCopy, page)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return totalPages, nil
+}
+
+/*
+Paginate the Arrow file or stream into Arrow pages with the same schema and format - used for preview
+*/
+func PaginateArrow(byteContent []byte, chunkSize int, dataType string, output types.Output, storeBytes func(output types.Output, content []byte) error) (totalPages int, err error) {
+	pages, err := transformarrow.Pages(byteContent, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+	extension := "arrow"
+	if transformarrow.IsStream(dataType) {
+		extension = "arrows"
+	}
+	for _, page := range pages {
+		totalPages++
+		outputCopy := output
+		outputCopy.Reference.Prefix = fmt.Sprintf("%s/pages/%d.%s", output.Reference.Prefix, totalPages, extension)
+		err = storeBytes(outputCopy, page)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return totalPages, nil
+}
+
+/*
+Paginate the length-delimited protobuf stream into streams of messages - used for preview
+*/
+func PaginateProtobuf(byteContent []byte, chunkSize int, output types.Output, storeBytes func(output types.Output, content []byte) error) (totalPages int, err error) {
+	pages, err := transformprotobuf.Pages(byteContent, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, page := range pages {
+		totalPages++
+		outputCopy := output
+		outputCopy.Reference.Prefix = fmt.Sprintf("%s/pages/%d.pb", output.Reference.Prefix, totalPages)
+		err = storeBytes(outputCopy, page)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return totalPages, nil
+}
@@ -130,7 +130,7 @@ func TestPaginateCSV(t *testing.T) {
 		mockStoredPages = make(map[string][]byte)
 
 		// Create a custom version of PaginateCSV that uses our mock
-		totalPages, err := PaginateCSV([]byte(csvData), 50, output, mockStoreBytes)
+		totalPages, err := PaginateCSV([]byte(csvData), 50, nil, output, mockStoreBytes)
 		assert.Equal(t, nil, err)
 		assert.Equal(t, 3, totalPages) // 100 data rows with chunk size 50 (including header) = 3 pages
 
@@ -188,7 +188,7 @@ func TestPaginateCSV(t *testing.T) {
 
 		mockStoredPages = make(map[string][]byte)
 
-		totalPages, err := PaginateCSV([]byte(csvData), 50, output, mockStoreBytes)
+		totalPages, err := PaginateCSV([]byte(csvData), 50, nil, output, mockStoreBytes)
 		assert.Equal(t, nil, err)
 		assert.Equal(t, 1, totalPages)
 
@@ -213,7 +213,7 @@ func TestPaginateCSV(t *testing.T) {
 			},
 		}
 
-		totalPages, err := PaginateCSV([]byte(""), 50, output, mockStoreBytes)
+		totalPages, err := PaginateCSV([]byte(""), 50, nil, output, mockStoreBytes)
 		assert.Equal(t, nil, err)
 		assert.Equal(t, 0, totalPages)
 	})
@@ -2,15 +2,30 @@ package routes
 
 import (
 	"fmt"
+	"lazy-lagoon/pkg/compression"
 	"lazy-lagoon/pkg/httphelper"
 	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+	"lazy-lagoon/transformarrow"
+	"lazy-lagoon/transformavro"
+	"lazy-lagoon/transformconvert"
 	"lazy-lagoon/transformcsv"
+	"lazy-lagoon/transformfixedwidth"
 	"lazy-lagoon/transformjson"
+	"lazy-lagoon/transformparquet"
+	"lazy-lagoon/transformprotobuf"
+	"lazy-lagoon/transformxml"
+	"lazy-lagoon/transformxlsx"
+	"lazy-lagoon/transformyaml"
 	"net/http"
+	"path"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Downloads the files of a zip archive, replaced in the tests
+var getFiles = storage.GetFiles
+
 /*
 Transform the file - used for preview and snapshot mutations
 */
@@ -28,37 +43,41 @@ func Transform(c *gin.Context) {
 	}
 
 	input := requestData.Input
-	dataType := input.DataType
 	rules := requestData.Rules
 	output := requestData.Output
 	webhook := requestData.Webhook
+	if requestData.StopAfterFirstMatch {
+		rules = stopAfterFirstMatch(rules)
+	}
 
 	/*
-		Split the process into different data types
+		Every file of a zip archive is transformed into the output prefix with its name,
+		the other S3 objects are read by the transform as they are downloaded
 	*/
-	var transformErr *types.TransformError
-	switch dataType {
-	case "CSV", "SQL":
-		transformErr = transformcsv.ExecuteTransform(input, rules, output)
-		if transformErr != nil {
-			sendTransformError(c, http.StatusInternalServerError, transformErr, webhook)
+	files := []compression.File{{Content: input.Content}}
+	if needsDownload(input) {
+		files, err = getFiles(input)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err, webhook)
 			return
 		}
-	case "JSON":
-		transformErr = transformjson.ExecuteTransform(input, rules, output)
-		if transformErr != nil {
-			sendTransformError(c, http.StatusInternalServerError, transformErr, webhook)
+	}
+	for _, file := range files {
+		fileInput := input
+		fileInput.Content = file.Content
+		fileOutput := output
+		if file.Name != "" {
+			fileOutput.Reference.Prefix = path.Join(output.Reference.Prefix, file.Name)
+		}
+		transformErr, err := executeTransform(fileInput, rules, fileOutput)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, err, webhook)
 			return
 		}
-	case "JSONL":
-		transformErr = transformjson.ExecuteTransformJsonl(input, rules, output)
 		if transformErr != nil {
 			sendTransformError(c, http.StatusInternalServerError, transformErr, webhook)
 			return
 		}
-	default:
-		sendError(c, http.StatusBadRequest, fmt.Errorf("data type %s not found", dataType), webhook)
-		return
 	}
 
 	// Request is async
@@ -76,3 +95,40 @@ func Transform(c *gin.Context) {
 	c.JSON(http.StatusOK, "Completed transformation")
 	return
 }
+
+/*
+Split the process into different data types, converted when the output has another data type than the input
+*/
+func executeTransform(input types.Input, rules []types.Rule, output types.Output) (*types.TransformError, error) {
+	if transformconvert.IsConversion(input.DataType, output.DataType) {
+		if !transformconvert.IsSupported(input.DataType, output.DataType) {
+			return nil, fmt.Errorf("conversion from %s to %s not supported", input.DataType, output.DataType)
+		}
+		return transformconvert.ExecuteTransform(input, rules, output), nil
+	}
+	switch input.DataType {
+	case "CSV", "SQL":
+		return transformcsv.ExecuteTransform(input, rules, output), nil
+	case "JSON":
+		return transformjson.ExecuteTransform(input, rules, output), nil
+	case "JSONL":
+		return transformjson.ExecuteTransformJsonl(input, rules, output), nil
+	case "PARQUET":
+		return transformparquet.ExecuteTransform(input, rules, output), nil
+	case "AVRO":
+		return transformavro.ExecuteTransform(input, rules, output), nil
+	case "XML":
+		return transformxml.ExecuteTransform(input, rules, output), nil
+	case "XLSX":
+		return transformxlsx.ExecuteTransform(input, rules, output), nil
+	case "FIXEDWIDTH":
+		return transformfixedwidth.ExecuteTransform(input, rules, output), nil
+	case "YAML":
+		return transformyaml.ExecuteTransform(input, rules, output), nil
+	case "ARROW", "ARROWSTREAM":
+		return transformarrow.ExecuteTransform(input, rules, output), nil
+	case "PROTOBUF":
+		return transformprotobuf.ExecuteTransform(input, rules, output), nil
+	}
+	return nil, fmt.Errorf("data type %s not found", input.DataType)
+}
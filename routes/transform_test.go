@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lazy-lagoon/pkg/compression"
+	"lazy-lagoon/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestTransformDownload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/transform", Transform)
+
+	// Counts the objects read before the transform
+	downloads := 0
+	defer func(original func(input types.Input) ([]compression.File, error)) { getFiles = original }(getFiles)
+	getFiles = func(input types.Input) ([]compression.File, error) {
+		downloads++
+		return nil, fmt.Errorf("download of %s", input.Reference.Prefix)
+	}
+
+	transform := func(prefix string) *httptest.ResponseRecorder {
+		// Without a region the S3 request fails before reaching the network
+		body, _ := json.Marshal(types.RequestBodyTransform{
+			Input: types.Input{
+				StorageType: "S3",
+				DataType:    "JSON",
+				Reference:   types.SourceReference{Bucket: "test-bucket", Prefix: prefix},
+			},
+			Output: types.Output{
+				StorageType: "S3",
+				Reference:   types.SourceReference{Bucket: "test-bucket", Prefix: "output"},
+			},
+			Rules: []types.Rule{{
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "[*].ssn"}},
+			}},
+		})
+		req, _ := http.NewRequest("POST", "/transform", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("S3 objects are streamed by the transform", func(t *testing.T) {
+		downloads = 0
+		w := transform("customers.json.gz")
+		assert.Equal(t, downloads, 0)
+		assert.NotEqual(t, w.Code, http.StatusOK)
+	})
+
+	t.Run("zip archives are downloaded to read their files", func(t *testing.T) {
+		downloads = 0
+		w := transform("customers.zip")
+		assert.Equal(t, downloads, 1)
+		assert.Equal(t, w.Code, http.StatusBadRequest)
+		assert.Equal(t, w.Body.String(), `{"message":"download of customers.zip"}`)
+	})
+}
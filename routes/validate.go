@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"net/http"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+Validate the rules without running a transform - used to lint rules before submitting a job
+*/
+func ValidateRules(c *gin.Context) {
+	/*
+		Request body
+	*/
+	var requestData types.RequestBodyValidateRules
+	err := bindAndValidate(c, &requestData)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, err, nil)
+		return
+	}
+	dataType := requestData.DataType
+	paths := requestData.Paths
+	rules := requestData.Rules
+	if requestData.StopAfterFirstMatch {
+		rules = stopAfterFirstMatch(rules)
+	}
+
+	/*
+		Getting the paths of the fields from the input when no paths were given
+	*/
+	if requestData.Input != nil {
+		if dataType == "" {
+			dataType = requestData.Input.DataType
+		}
+		if paths == nil {
+			bytesContent, err := getInputBytes(*requestData.Input)
+			if err != nil {
+				sendError(c, http.StatusBadRequest, err, nil)
+				return
+			}
+			paths, err = extractInputPaths(bytesContent, *requestData.Input)
+			if err != nil {
+				sendError(c, http.StatusBadRequest, err, nil)
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, lintRules(rules, dataType, paths))
+}
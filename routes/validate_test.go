@@ -0,0 +1,213 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestLintRules(t *testing.T) {
+	jsonPaths := []string{"name", "friends", "friends[*]", "friends[*].name", "friends[*].age"}
+
+	t.Run("valid rules", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions: []types.Expressions{
+					{FieldName: "friends[*].age", Operator: "GT", Value: 30.0, Quantifier: "ALL"},
+				},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "friends[1].name"}},
+		}}
+		result := lintRules(rules, "JSON", jsonPaths)
+		assert.Equal(t, result.Valid, true)
+		assert.Equal(t, len(result.Errors), 0)
+		assert.Equal(t, len(result.Warnings), 0)
+	})
+
+	t.Run("unknown operator, action type and field", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions: []types.Expressions{
+					{FieldName: "name", Operator: "LIKE", Value: "J%"},
+				},
+			},
+			Actions: []types.Action{
+				{ActionType: "HIDE", FieldName: "name"},
+				{ActionType: "REDACT", FieldName: "friends[*].email"},
+			},
+		}}
+		result := lintRules(rules, "JSON", jsonPaths)
+		assert.Equal(t, result.Valid, false)
+		assert.Equal(t, len(result.Errors), 3)
+		assert.Equal(t, result.Errors[0].Key, "operator")
+		assert.Equal(t, *result.Errors[0].ExpressionIndex, 0)
+		assert.Equal(t, result.Errors[1].Key, "actionType")
+		assert.Equal(t, *result.Errors[1].ActionIndex, 0)
+		assert.Equal(t, result.Errors[2].Key, "fieldName")
+		assert.Equal(t, *result.Errors[2].ActionIndex, 1)
+	})
+
+	t.Run("type mismatches and malformed paths", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "OR",
+				Expressions: []types.Expressions{
+					{FieldName: "name", Operator: "EXISTS", Value: "yes"},
+					{FieldName: "friends", Operator: "SIZE_GT", Value: "many"},
+					{FieldName: "friends[", Operator: "EQ", Value: "Bob"},
+				},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "name"}},
+		}}
+		result := lintRules(rules, "JSON", nil)
+		assert.Equal(t, len(result.Errors), 3)
+		assert.Equal(t, result.Errors[0].Key, "value")
+		assert.Equal(t, result.Errors[1].Key, "value")
+		assert.Equal(t, result.Errors[2].Key, "fieldName")
+		assert.Equal(t, *result.Errors[2].ExpressionIndex, 2)
+	})
+
+	t.Run("quantifiers without an array", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions: []types.Expressions{
+					{FieldName: "name", Operator: "EQ", Value: "Bob", Quantifier: "ALL"},
+					{FieldName: "name", Operator: "EQ", Value: "Bob", Quantifier: "ANY"},
+					{FieldName: "..name", Operator: "EQ", Value: "Bob", Quantifier: "NONE"},
+				},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "name"}},
+		}}
+		result := lintRules(rules, "JSON", nil)
+		assert.Equal(t, len(result.Errors), 1)
+		assert.Equal(t, result.Errors[0].Key, "quantifier")
+		assert.Equal(t, *result.Errors[0].ExpressionIndex, 0)
+		assert.Equal(t, len(result.Warnings), 1)
+		assert.Equal(t, *result.Warnings[0].ExpressionIndex, 1)
+	})
+
+	t.Run("duplicate and unreachable rules", func(t *testing.T) {
+		rule := types.Rule{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions: []types.Expressions{
+					{FieldName: "type", Operator: "EQ", Value: "PAYMENT"},
+					{FieldName: "type", Operator: "EQ", Value: "TRANSFER"},
+				},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "amount"}},
+		}
+		result := lintRules([]types.Rule{rule, rule}, "CSV", []string{"type", "amount"})
+		assert.Equal(t, result.Valid, true)
+		assert.Equal(t, len(result.Warnings), 3)
+		assert.Equal(t, result.Warnings[0].Key, "expression")
+		assert.Equal(t, result.Warnings[1].Message, "duplicate of rule 0")
+		assert.Equal(t, *result.Warnings[1].RuleIndex, 1)
+	})
+
+	t.Run("CSV columns are not parsed as paths", func(t *testing.T) {
+		rules := []types.Rule{{
+			Actions: []types.Action{
+				{ActionType: "REDACT", FieldName: "First name"},
+				{ActionType: "EXCLUDE", FieldName: "Email"},
+			},
+		}}
+		result := lintRules(rules, "CSV", []string{"First name", "Last name"})
+		assert.Equal(t, len(result.Errors), 1)
+		assert.Equal(t, result.Errors[0].Message, "column Email not found")
+	})
+
+	t.Run("selectors and recursive descent are found in the paths", func(t *testing.T) {
+		rules := []types.Rule{{
+			Actions: []types.Action{
+				{ActionType: "REDACT", FieldName: "..ssn"},
+				{ActionType: "REDACT", FieldName: "items[?(@.type=='card')].number"},
+				{ActionType: "EXCLUDE", FieldName: "items[-1]"},
+				{ActionType: "EXCLUDE", FieldName: "**.email"},
+			},
+		}}
+		result := lintRules(rules, "JSON", []string{"customer", "customer.ssn", "items", "items[*]", "items[*].number"})
+		assert.Equal(t, len(result.Errors), 1)
+		assert.Equal(t, result.Errors[0].Message, "path **.email not found")
+		assert.Equal(t, *result.Errors[0].ActionIndex, 3)
+	})
+
+	t.Run("quoted keys and JSON Pointers are found in the paths", func(t *testing.T) {
+		rules := []types.Rule{{
+			Actions: []types.Action{
+				{ActionType: "REDACT", FieldName: "/user.name"},
+				{ActionType: "REDACT", FieldName: "/friends/1/name"},
+				{ActionType: "REDACT", FieldName: `["user.name"]`},
+				{ActionType: "REDACT", FieldName: "['user.name']"},
+				{ActionType: "REDACT", FieldName: "/friends/1/email"},
+			},
+		}}
+		result := lintRules(rules, "JSON", []string{"['user.name']", "friends", "friends[*]", "friends[*].name"})
+		assert.Equal(t, len(result.Errors), 1)
+		assert.Equal(t, result.Errors[0].Message, "path /friends/1/email not found")
+		assert.Equal(t, *result.Errors[0].ActionIndex, 4)
+	})
+
+	t.Run("rules after an always matching stop rule", func(t *testing.T) {
+		rules := []types.Rule{
+			{Actions: []types.Action{{ActionType: "REDACT", FieldName: "amount"}}},
+			{
+				ElseActions: []types.Action{{ActionType: "EXCLUDE", FieldName: "Email"}},
+				Priority:    5,
+			},
+		}
+		result := lintRules(stopAfterFirstMatch(rules), "CSV", []string{"amount"})
+		assert.Equal(t, len(result.Errors), 1)
+		assert.Equal(t, *result.Errors[0].ElseActionIndex, 0)
+		assert.Equal(t, len(result.Warnings), 1)
+		assert.Equal(t, result.Warnings[0].Message, "rule is never evaluated, rule 1 always matches and stops processing")
+		assert.Equal(t, *result.Warnings[0].RuleIndex, 0)
+	})
+}
+
+func TestValidateRulesEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/rules/validate", ValidateRules)
+
+	t.Run("paths from the request body", func(t *testing.T) {
+		body, _ := json.Marshal(types.RequestBodyValidateRules{
+			DataType: "CSV",
+			Paths:    []string{"id", "email"},
+			Rules: []types.Rule{{
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "phone"}},
+			}},
+		})
+		req, _ := http.NewRequest("POST", "/rules/validate", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var result types.ValidationResult
+		err := json.Unmarshal(w.Body.Bytes(), &result)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, result.Valid, false)
+		assert.Equal(t, len(result.Errors), 1)
+		assert.Equal(t, *result.Errors[0].RuleIndex, 0)
+		assert.Equal(t, *result.Errors[0].ActionIndex, 0)
+	})
+
+	t.Run("missing rules", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/rules/validate", bytes.NewBuffer([]byte(`{"dataType":"CSV"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
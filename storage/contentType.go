@@ -1,5 +1,21 @@
 package storage
 
+import (
+	"lazy-lagoon/pkg/compression"
+	"lazy-lagoon/pkg/types"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// getContentType returns the content type of the output, SQL outputs written as INSERT statements are SQL scripts
+func getContentType(output types.Output) string {
+	if output.Sql != nil && strings.ToUpper(output.Sql.Format) == "INSERT" {
+		return "application/sql"
+	}
+	return getContentTypeForDataType(output.DataType)
+}
+
 func getContentTypeForDataType(dataType string) string {
 	switch dataType {
 	case "CSV":
@@ -10,6 +26,33 @@ func getContentTypeForDataType(dataType string) string {
 		return "application/jsonl"
 	case "SQL":
 		return "text/csv"
+	case "PARQUET":
+		return "application/vnd.apache.parquet"
+	case "AVRO":
+		return "application/avro"
+	case "XML":
+		return "application/xml"
+	case "XLSX":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case "FIXEDWIDTH":
+		return "text/plain"
+	case "YAML":
+		return "application/yaml"
+	case "ARROW":
+		return "application/vnd.apache.arrow.file"
+	case "ARROWSTREAM":
+		return "application/vnd.apache.arrow.stream"
+	case "PROTOBUF":
+		return "application/x-protobuf"
 	}
 	return "application/octet-stream"
 }
+
+// getContentEncoding returns the Content-Encoding of the compressed outputs, nil when the output isn't compressed
+func getContentEncoding(outputCompression string) *string {
+	contentEncoding := compression.ContentEncoding(outputCompression)
+	if contentEncoding == "" {
+		return nil
+	}
+	return aws.String(contentEncoding)
+}
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"lazy-lagoon/pkg/compression"
 	"lazy-lagoon/pkg/httphelper"
+	"lazy-lagoon/pkg/textencoding"
 	"lazy-lagoon/pkg/types"
 )
 
@@ -14,6 +18,11 @@ func GetBytes(input types.Input) ([]byte, error) {
 	var content []byte
 	var err error
 
+	// Already downloaded
+	if input.Content != nil {
+		return input.Content, nil
+	}
+
 	if storageType == "S3" || storageType == "FILE" {
 		content, err = DownloadFromS3(input)
 		if err != nil {
@@ -46,5 +55,91 @@ func GetBytes(input types.Input) ([]byte, error) {
 	} else {
 		return nil, fmt.Errorf("storage type not found")
 	}
-	return content, nil
+	// gzip, zstd and bzip2 files are decompressed, zip archives are read with ArchiveFiles
+	return compression.Decompress(content, input.Reference.Prefix)
+}
+
+/*
+	Download the text file from the input storage type, decoded to UTF-8 without a BOM.
+	Returns the encoding of the file, which is the default encoding of the output
+*/
+func GetText(input types.Input) ([]byte, string, error) {
+	content, err := GetBytes(input)
+	if err != nil {
+		return nil, "", err
+	}
+	return textencoding.Decode(content, input.Encoding)
+}
+
+/*
+	Open the file of the input storage type, decompressed as it's read. S3 objects are read as they are downloaded,
+	the other storage types are downloaded first. The reader must be closed
+*/
+func GetReader(input types.Input) (io.ReadCloser, error) {
+	if input.Content != nil || (input.StorageType != "S3" && input.StorageType != "FILE") {
+		content, err := GetBytes(input)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+	body, err := OpenFromS3(input)
+	if err != nil {
+		return nil, err
+	}
+	// gzip, zstd and bzip2 files are decompressed like GetBytes
+	decompressed, err := compression.NewReader(body, input.Reference.Prefix)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return readCloser{Reader: decompressed, close: func() error {
+		decompressed.Close()
+		return body.Close()
+	}}, nil
+}
+
+/*
+	Open the text file of the input storage type, decoded to UTF-8 without a BOM as it's read.
+	Returns the encoding of the file like GetText, the reader must be closed
+*/
+func GetTextReader(input types.Input) (io.ReadCloser, string, error) {
+	reader, err := GetReader(input)
+	if err != nil {
+		return nil, "", err
+	}
+	decoded, encoding, err := textencoding.NewReader(reader, input.Encoding)
+	if err != nil {
+		reader.Close()
+		return nil, "", err
+	}
+	return readCloser{Reader: decoded, close: reader.Close}, encoding, nil
+}
+
+/*
+	Download the files from the input storage type, the files of a zip archive or the file itself.
+	XLSX files are zip files, they are never read as archives
+*/
+func GetFiles(input types.Input) ([]compression.File, error) {
+	content, err := GetBytes(input)
+	if err != nil {
+		return nil, err
+	}
+	if input.DataType == "XLSX" {
+		return []compression.File{{Content: content}}, nil
+	}
+	return compression.ArchiveFiles(content, input.Reference.Prefix)
+}
+
+/*
+	Helper functions
+*/
+// readCloser reads the decoded content and closes the reader of the storage
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (reader readCloser) Close() error {
+	return reader.close()
 }
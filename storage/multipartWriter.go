@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"io"
+	"lazy-lagoon/pkg/compression"
+	"lazy-lagoon/pkg/types"
+)
+
+// Parts must be at least 5MB (except the last one), 8MB keeps 10000 parts above 80GB
+const partSize = 8 * 1024 * 1024
+
+/*
+MultipartWriter is an io.Writer that uploads the written bytes as parts of a multipart upload, the last part is uploaded and the upload completed on Close.
+The bytes are compressed with the compression of the output before they are split into parts.
+*/
+type MultipartWriter struct {
+	output        types.Output
+	client        any
+	uploadId      string
+	uploadedParts any
+	partNumber    int64
+	buffer        []byte
+	compressor    io.WriteCloser
+}
+
+// partWriter receives the compressed bytes
+type partWriter struct {
+	upload *MultipartWriter
+}
+
+func NewMultipartWriter(output types.Output) (*MultipartWriter, error) {
+	upload := &MultipartWriter{output: output}
+	compressor, err := compression.NewWriter(partWriter{upload}, output.Compression)
+	if err != nil {
+		return nil, err
+	}
+	// Create a client for multipart uploads
+	client, uploadId, err := CreateMultiPartClient(output)
+	if err != nil {
+		return nil, err
+	}
+	// Initialize uploadedParts based on storage type
+	uploadedParts, err := InitializeUploadedParts(output)
+	if err != nil {
+		return nil, err
+	}
+	upload.compressor, upload.client, upload.uploadId, upload.uploadedParts = compressor, client, uploadId, uploadedParts
+	return upload, nil
+}
+
+func (upload *MultipartWriter) Write(content []byte) (int, error) {
+	return upload.compressor.Write(content)
+}
+
+func (upload *MultipartWriter) Close() error {
+	// Flushing the end of the compressed stream
+	if err := upload.compressor.Close(); err != nil {
+		return err
+	}
+	return upload.uploadPart(upload.buffer, true)
+}
+
+func (writer partWriter) Write(content []byte) (int, error) {
+	upload := writer.upload
+	upload.buffer = append(upload.buffer, content...)
+	// Always keep some bytes back for the last part
+	for len(upload.buffer) > partSize {
+		if err := upload.uploadPart(upload.buffer[:partSize], false); err != nil {
+			return 0, err
+		}
+		upload.buffer = append([]byte(nil), upload.buffer[partSize:]...)
+	}
+	return len(content), nil
+}
+
+func (upload *MultipartWriter) uploadPart(chunk []byte, isLastChunk bool) error {
+	upload.partNumber++
+	uploadedPart, err := UploadAndCompleteChunk(upload.client, upload.output, upload.partNumber, upload.uploadId, chunk, isLastChunk, upload.uploadedParts)
+	if err != nil {
+		return err
+	}
+	// Update uploadedParts with the new part
+	upload.uploadedParts, err = UpdateUploadedParts(upload.output, upload.uploadedParts, uploadedPart, upload.partNumber)
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"lazy-lagoon/pkg/types"
+	"strings"
 
 	_ "github.com/lib/pq"
 )
@@ -12,25 +13,12 @@ import (
 Download the content from rdb
 */
 func DownloadFromRDB(input types.Input) ([]byte, error) {
-	var connectionStr string
-	if input.Reference.Server == "postgres" {
-		connectionStr = fmt.Sprintf("postgresql://%s:%s@%s/%s",
-			input.Credential.Resources.Username,
-			input.Credential.Secrets.Password,
-			input.Reference.Host,
-			input.Reference.Database)
-	}
-	db, err := sql.Open(input.Reference.Server, connectionStr)
+	db, err := openRDB(input)
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
 
-	err = db.Ping()
-	if err != nil {
-		return nil, err
-	}
-
 	rows, err := db.Query(input.Reference.Query)
 	if err != nil {
 		return nil, err
@@ -81,6 +69,61 @@ func DownloadFromRDB(input types.Input) ([]byte, error) {
 	return csvData, nil
 }
 
+/*
+Get the database types of the columns of the query (e.g. INT4, NUMERIC, VARCHAR), in the order of the downloaded columns.
+Nil for the other storage types, the types are then inferred from the values
+*/
+func GetColumnTypes(input types.Input) ([]string, error) {
+	if input.StorageType != "RDB" {
+		return nil, nil
+	}
+	db, err := openRDB(input)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// Only the description of the columns is read, not the rows
+	query := strings.TrimSuffix(strings.TrimSpace(input.Reference.Query), ";")
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM (%s) AS source LIMIT 0", query))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(columnTypes))
+	for i, columnType := range columnTypes {
+		names[i] = columnType.DatabaseTypeName()
+	}
+	return names, nil
+}
+
+// openRDB connects to the database of the input
+func openRDB(input types.Input) (*sql.DB, error) {
+	var connectionStr string
+	if input.Reference.Server == "postgres" {
+		connectionStr = fmt.Sprintf("postgresql://%s:%s@%s/%s",
+			input.Credential.Resources.Username,
+			input.Credential.Secrets.Password,
+			input.Reference.Host,
+			input.Reference.Database)
+	}
+	db, err := sql.Open(input.Reference.Server, connectionStr)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
 type Test_Input struct {
 	Server        string
 	ConnectionStr string
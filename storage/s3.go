@@ -17,6 +17,24 @@ import (
 Download the content from the s3 bucket
 */
 func DownloadFromS3(input types.Input) ([]byte, error) {
+	body, err := OpenFromS3(input)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	fileContents, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileContents, nil
+}
+
+/*
+Open the object of the s3 bucket, the content is read from the body as it's downloaded. The body must be closed
+*/
+func OpenFromS3(input types.Input) (io.ReadCloser, error) {
 	var reference types.SourceReference = input.Reference
 	var credential types.SourceCredential = input.Credential
 
@@ -43,14 +61,8 @@ func DownloadFromS3(input types.Input) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer downloadResult.Body.Close()
 
-	fileContents, err := io.ReadAll(downloadResult.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return fileContents, nil
+	return downloadResult.Body, nil
 }
 
 /*
@@ -78,7 +90,9 @@ func UploadToS3(output types.Output, content []byte) error {
 		Bucket:      aws.String(reference.Bucket),
 		Key:         aws.String(reference.Prefix),
 		Body:        bytes.NewReader(content),
-		ContentType: aws.String(getContentTypeForDataType(output.DataType)),
+		ContentType: aws.String(getContentType(output)),
+		// Set when the content is compressed
+		ContentEncoding: getContentEncoding(output.Compression),
 	}
 
 	_, err = s3Client.PutObject(uploadInput)
@@ -114,7 +128,9 @@ func CreateS3MultiPartClient(output types.Output) (*s3.S3, string, error) {
 	createOutput, err := s3Client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
 		Bucket:      aws.String(reference.Bucket),
 		Key:         aws.String(reference.Prefix),
-		ContentType: aws.String(getContentTypeForDataType(output.DataType)),
+		ContentType: aws.String(getContentType(output)),
+		// Set when the content is compressed
+		ContentEncoding: getContentEncoding(output.Compression),
 	})
 	if err != nil {
 		return nil, "", err
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"lazy-lagoon/pkg/compression"
 	"lazy-lagoon/pkg/types"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,6 +13,10 @@ import (
 Store the content in the output storage type
 */
 func StoreBytes(output types.Output, content []byte) error {
+	content, err := compression.Compress(content, output.Compression)
+	if err != nil {
+		return err
+	}
 	switch output.StorageType {
 	case "S3":
 		return UploadToS3(output, content)
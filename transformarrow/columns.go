@@ -0,0 +1,135 @@
+package transformarrow
+
+import (
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/bitutil"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+const redactedValue = "**redacted**"
+
+/*
+batchChanges are the fields of a record batch changed by the rules, by column then by row.
+A column is nil when none of its fields are changed in the batch
+*/
+type batchChanges struct {
+	redacted [][]bool
+	excluded [][]bool
+}
+
+/*
+columnChanges is what the actions did to a column in every record batch, it decides the field of the output schema
+*/
+type columnChanges struct {
+	rows         int64
+	redactedRows int64
+	excludedRows int64
+}
+
+// isRemoved is true when the column is excluded from every row, it's left out of the output
+func (changes columnChanges) isRemoved() bool {
+	return changes.rows > 0 && changes.excludedRows == changes.rows
+}
+
+// isString is true when the column is written as strings: redacted fields don't fit the other types,
+// and the excluded fields of the types without a validity bitmap can't be set to null
+func (changes columnChanges) isString(dataType arrow.DataType) bool {
+	if isStringType(dataType) {
+		return false
+	}
+	return changes.redactedRows > 0 || (changes.excludedRows > 0 && !hasValidity(dataType))
+}
+
+// outputField returns the field of the column in the output schema
+func (changes columnChanges) outputField(field arrow.Field) arrow.Field {
+	if changes.isString(field.Type) {
+		field.Type = arrow.BinaryTypes.String
+		field.Nullable = true
+	} else if changes.excludedRows > 0 {
+		field.Nullable = true
+	}
+	return field
+}
+
+/*
+	Helper functions
+*/
+// buildColumn returns the column of the output batch, the input column is shared when none of its fields changed
+func buildColumn(column arrow.Array, field arrow.Field, redacted []bool, excluded []bool) arrow.Array {
+	switch {
+	case field.Type.ID() != column.DataType().ID() || (redacted != nil && isStringType(field.Type)):
+		return stringColumn(column, field.Type, redacted, excluded)
+	case excluded != nil:
+		return nullColumn(column, excluded)
+	}
+	column.Retain()
+	return column
+}
+
+// stringColumn builds the column as strings of the data type: redacted fields are **redacted**, excluded fields and nulls are null
+func stringColumn(column arrow.Array, dataType arrow.DataType, redacted []bool, excluded []bool) arrow.Array {
+	builder := array.NewBuilder(memory.DefaultAllocator, dataType)
+	defer builder.Release()
+	for row := 0; row < column.Len(); row++ {
+		switch {
+		case isSet(excluded, row) || column.IsNull(row):
+			builder.AppendNull()
+		case isSet(redacted, row):
+			appendString(builder, redactedValue)
+		default:
+			appendString(builder, column.ValueStr(row))
+		}
+	}
+	return builder.NewArray()
+}
+
+// nullColumn returns the column with the excluded fields set to null, the values and children are shared with the input column
+func nullColumn(column arrow.Array, excluded []bool) arrow.Array {
+	data := column.Data()
+	if data.DataType().ID() == arrow.NULL {
+		column.Retain()
+		return column
+	}
+	offset := data.Offset()
+	bitmap := make([]byte, bitutil.BytesForBits(int64(offset+data.Len())))
+	for row := 0; row < data.Len(); row++ {
+		bitutil.SetBitTo(bitmap, offset+row, column.IsValid(row) && !isSet(excluded, row))
+	}
+	buffers := append([]*memory.Buffer{memory.NewBufferBytes(bitmap)}, data.Buffers()[1:]...)
+	var nullData *array.Data
+	if dictionary, isDictionary := data.Dictionary().(*array.Data); isDictionary && dictionary != nil {
+		nullData = array.NewDataWithDictionary(data.DataType(), data.Len(), buffers, array.UnknownNullCount, offset, dictionary)
+	} else {
+		nullData = array.NewData(data.DataType(), data.Len(), buffers, data.Children(), array.UnknownNullCount, offset)
+	}
+	defer nullData.Release()
+	return array.MakeFromData(nullData)
+}
+
+func appendString(builder array.Builder, value string) {
+	switch typedBuilder := builder.(type) {
+	case *array.StringBuilder:
+		typedBuilder.Append(value)
+	case *array.LargeStringBuilder:
+		typedBuilder.Append(value)
+	}
+}
+
+// isStringType is true for the columns that can hold **redacted**
+func isStringType(dataType arrow.DataType) bool {
+	return dataType.ID() == arrow.STRING || dataType.ID() == arrow.LARGE_STRING
+}
+
+// hasValidity is true for the types with a validity bitmap, the excluded fields are then set to null
+func hasValidity(dataType arrow.DataType) bool {
+	switch dataType.ID() {
+	case arrow.SPARSE_UNION, arrow.DENSE_UNION, arrow.RUN_END_ENCODED:
+		return false
+	}
+	return true
+}
+
+func isSet(flags []bool, row int) bool {
+	return row < len(flags) && flags[row]
+}
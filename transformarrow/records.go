@@ -0,0 +1,94 @@
+package transformarrow
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// The IPC file format starts with the magic bytes, the stream format starts with the schema message
+var fileMagic = []byte("ARROW1")
+
+/*
+IsStream reports whether the data type is written in the IPC stream format, ARROW is the IPC file format
+*/
+func IsStream(dataType string) bool {
+	return dataType == "ARROWSTREAM"
+}
+
+/*
+	Helper functions
+*/
+// readRecords reads the record batches of the IPC file or stream, isStream is the format of the content
+func readRecords(byteContent []byte) (schema *arrow.Schema, records []arrow.Record, isStream bool, err error) {
+	if bytes.HasPrefix(byteContent, fileMagic) {
+		fileReader, err := ipc.NewFileReader(bytes.NewReader(byteContent), ipc.WithAllocator(memory.DefaultAllocator))
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("file is not a valid arrow file: %v", err)
+		}
+		defer fileReader.Close()
+		for index := 0; index < fileReader.NumRecords(); index++ {
+			record, err := fileReader.RecordAt(index)
+			if err != nil {
+				releaseRecords(records)
+				return nil, nil, false, fmt.Errorf("error reading arrow record batch %d: %v", index, err)
+			}
+			records = append(records, record)
+		}
+		return fileReader.Schema(), records, false, nil
+	}
+
+	streamReader, err := ipc.NewReader(bytes.NewReader(byteContent), ipc.WithAllocator(memory.DefaultAllocator))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("file is not a valid arrow file or stream: %v", err)
+	}
+	defer streamReader.Release()
+	for streamReader.Next() {
+		// The reader releases its record on the next call
+		record := streamReader.Record()
+		record.Retain()
+		records = append(records, record)
+	}
+	if err := streamReader.Err(); err != nil && err != io.EOF {
+		releaseRecords(records)
+		return nil, nil, false, fmt.Errorf("error reading arrow stream: %v", err)
+	}
+	return streamReader.Schema(), records, true, nil
+}
+
+// writeRecords writes the record batches with the schema, in the IPC stream format or the IPC file format
+func writeRecords(output io.Writer, schema *arrow.Schema, records []arrow.Record, isStream bool) error {
+	var writer interface {
+		Write(record arrow.Record) error
+		Close() error
+	}
+	if isStream {
+		writer = ipc.NewWriter(output, ipc.WithSchema(schema), ipc.WithAllocator(memory.DefaultAllocator))
+	} else {
+		fileWriter, err := ipc.NewFileWriter(output, ipc.WithSchema(schema), ipc.WithAllocator(memory.DefaultAllocator))
+		if err != nil {
+			return err
+		}
+		writer = fileWriter
+	}
+	for _, record := range records {
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("error writing arrow record batch: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error writing arrow footer: %v", err)
+	}
+	return nil
+}
+
+// releaseRecords releases the record batches that were read or built
+func releaseRecords(records []arrow.Record) {
+	for _, record := range records {
+		record.Release()
+	}
+}
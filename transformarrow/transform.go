@@ -0,0 +1,234 @@
+package transformarrow
+
+import (
+	"bytes"
+	"io"
+	"lazy-lagoon/pkg/concurrent"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+	"lazy-lagoon/transformcsv"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+/*
+Step 1: execute transform, and store in output storage
+*/
+func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
+	/*
+		Downloading the file from the input storage type
+	*/
+	byteContent, err := storage.GetBytes(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	// The output is written in the IPC format of its data type, the format of the input when empty
+	dataType := output.DataType
+	if dataType == "" {
+		dataType = input.DataType
+	}
+	/*
+		Writing the record batches into a multipart upload
+	*/
+	upload, err := storage.NewMultipartWriter(output)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	transformErr := ExecuteRules(byteContent, rules, IsStream(dataType), upload)
+	if transformErr != nil {
+		return transformErr
+	}
+	err = upload.Close()
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
+	return nil
+}
+
+/*
+Step 2: Transform the record batches column-wise and write them to the writer, without converting them to rows of another data type.
+The rules are the CSV rules on the column names: every batch is evaluated concurrently, then only the changed columns are rebuilt,
+the other columns are written as they were read.
+*/
+func ExecuteRules(byteContent []byte, rules []types.Rule, isStream bool, output io.Writer) *types.TransformError {
+	schema, records, _, err := readRecords(byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	defer releaseRecords(records)
+	plan, transformErr := transformcsv.Compile(Columns(schema), rules)
+	if transformErr != nil {
+		return transformErr
+	}
+
+	// Applying the rules to the rows of every batch, the fields that changed are kept by column
+	changes, transformErr := concurrent.ForEach(records, func(record arrow.Record, index int) (batchChanges, *types.TransformError) {
+		return evaluateBatch(plan, record)
+	})
+	if transformErr != nil {
+		return transformErr
+	}
+
+	/*
+		The output schema is adjusted to the actions of every batch
+	*/
+	columns := make([]columnChanges, len(schema.Fields()))
+	for batchIndex, record := range records {
+		for column := range columns {
+			columns[column].rows += record.NumRows()
+			columns[column].redactedRows += countSet(changes[batchIndex].redacted[column])
+			columns[column].excludedRows += countSet(changes[batchIndex].excluded[column])
+		}
+	}
+	var keptColumns []int
+	var fields []arrow.Field
+	for column, field := range schema.Fields() {
+		if columns[column].isRemoved() {
+			continue
+		}
+		keptColumns = append(keptColumns, column)
+		fields = append(fields, columns[column].outputField(field))
+	}
+	metadata := schema.Metadata()
+	outputSchema := arrow.NewSchema(fields, &metadata)
+
+	// Rebuilding the changed columns of every batch
+	transformedRecords, transformErr := concurrent.ForEach(records, func(record arrow.Record, index int) (arrow.Record, *types.TransformError) {
+		arrays := make([]arrow.Array, len(keptColumns))
+		for position, column := range keptColumns {
+			arrays[position] = buildColumn(record.Column(column), fields[position], changes[index].redacted[column], changes[index].excluded[column])
+		}
+		transformed := array.NewRecord(outputSchema, arrays, record.NumRows())
+		for _, built := range arrays {
+			built.Release()
+		}
+		return transformed, nil
+	})
+	if transformErr != nil {
+		return transformErr
+	}
+	defer releaseRecords(transformedRecords)
+
+	err = writeRecords(output, outputSchema, transformedRecords, isStream)
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
+	return nil
+}
+
+/*
+Paths returns the names of the columns of the Arrow content
+*/
+func Paths(byteContent []byte) ([]string, error) {
+	schema, records, _, err := readRecords(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	releaseRecords(records)
+	return Columns(schema), nil
+}
+
+/*
+Columns returns the names of the columns of the schema, used as the fields of the rules
+*/
+func Columns(schema *arrow.Schema) []string {
+	columns := make([]string, len(schema.Fields()))
+	for index, field := range schema.Fields() {
+		columns[index] = field.Name
+	}
+	return columns
+}
+
+/*
+Pages splits the Arrow content into Arrow files or streams (the format of the input) of rowsPerPage rows - used for preview
+*/
+func Pages(byteContent []byte, rowsPerPage int) ([][]byte, error) {
+	schema, records, isStream, err := readRecords(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseRecords(records)
+
+	var pages [][]byte
+	var slices []arrow.Record
+	pageRows := int64(0)
+	flush := func() error {
+		defer releaseRecords(slices)
+		page := bytes.NewBuffer(nil)
+		if err := writeRecords(page, schema, slices, isStream); err != nil {
+			return err
+		}
+		pages = append(pages, page.Bytes())
+		slices, pageRows = nil, 0
+		return nil
+	}
+	for _, record := range records {
+		for start := int64(0); start < record.NumRows(); {
+			end := min(record.NumRows(), start+int64(rowsPerPage)-pageRows)
+			slices = append(slices, record.NewSlice(start, end))
+			pageRows += end - start
+			start = end
+			if pageRows == int64(rowsPerPage) {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if pageRows > 0 {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+/*
+	Helper functions
+*/
+// evaluateBatch applies the plan to the fields of every row of the batch, formatted like CSV fields (nulls are empty)
+func evaluateBatch(plan *transformcsv.Plan, record arrow.Record) (batchChanges, *types.TransformError) {
+	numColumns := int(record.NumCols())
+	changes := batchChanges{redacted: make([][]bool, numColumns), excluded: make([][]bool, numColumns)}
+	numRows := int(record.NumRows())
+	for row := 0; row < numRows; row++ {
+		fields := make([]string, numColumns)
+		for column := range fields {
+			if values := record.Column(column); values.IsValid(row) {
+				fields[column] = values.ValueStr(row)
+			}
+		}
+		original := append([]string{}, fields...)
+		transformed, excluded, transformErr := plan.ExecuteFields(fields)
+		if transformErr != nil {
+			return batchChanges{}, transformErr
+		}
+		for column := range original {
+			if excluded[column] {
+				setChanged(changes.excluded, column, row, numRows)
+			} else if transformed[column] != original[column] {
+				setChanged(changes.redacted, column, row, numRows)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// setChanged marks the field, the flags of the column are allocated on its first change
+func setChanged(flags [][]bool, column int, row int, numRows int) {
+	if flags[column] == nil {
+		flags[column] = make([]bool, numRows)
+	}
+	flags[column][row] = true
+}
+
+func countSet(flags []bool) int64 {
+	count := int64(0)
+	for _, flag := range flags {
+		if flag {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,115 @@
+package transformarrow
+
+import (
+	"bytes"
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/go-playground/assert/v2"
+)
+
+var accounts = arrow.NewSchema([]arrow.Field{
+	{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	{Name: "email", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "balance", Type: arrow.PrimitiveTypes.Float64},
+}, nil)
+
+// writeAccounts writes two record batches of the accounts
+func writeAccounts(t *testing.T, isStream bool) []byte {
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, accounts)
+	defer builder.Release()
+	builder.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+	builder.Field(1).(*array.StringBuilder).AppendValues([]string{"ada@example.com", ""}, []bool{true, false})
+	builder.Field(2).(*array.Float64Builder).AppendValues([]float64{10.5, 99}, nil)
+	first := builder.NewRecord()
+	builder.Field(0).(*array.Int64Builder).AppendValues([]int64{3}, nil)
+	builder.Field(1).(*array.StringBuilder).AppendValues([]string{"grace@example.com"}, nil)
+	builder.Field(2).(*array.Float64Builder).AppendValues([]float64{250}, nil)
+	second := builder.NewRecord()
+	records := []arrow.Record{first, second}
+	defer releaseRecords(records)
+
+	content := bytes.NewBuffer(nil)
+	if err := writeRecords(content, accounts, records, isStream); err != nil {
+		t.Fatalf("Failed to write arrow: %v", err)
+	}
+	return content.Bytes()
+}
+
+// readColumns reads the columns of every batch as strings, nulls are (null)
+func readColumns(t *testing.T, content []byte) (*arrow.Schema, map[string][]string) {
+	schema, records, _, err := readRecords(content)
+	if err != nil {
+		t.Fatalf("Failed to read arrow: %v", err)
+	}
+	defer releaseRecords(records)
+	columns := map[string][]string{}
+	for _, record := range records {
+		for index, field := range schema.Fields() {
+			for row := 0; row < int(record.NumRows()); row++ {
+				columns[field.Name] = append(columns[field.Name], record.Column(index).ValueStr(row))
+			}
+		}
+	}
+	return schema, columns
+}
+
+func TestExecuteRules(t *testing.T) {
+	t.Run("changed columns rebuilt in every batch", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "balance", Operator: "GT", Value: 50}},
+				},
+				Actions: []types.Action{
+					{ActionType: "REDACT", FieldName: "email"},
+					{ActionType: "EXCLUDE", FieldName: "id"},
+				},
+			},
+		}
+		output := bytes.NewBuffer(nil)
+		transformErr := ExecuteRules(writeAccounts(t, false), rules, false, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform arrow: %v", transformErr.Message)
+		}
+		schema, columns := readColumns(t, output.Bytes())
+		assert.Equal(t, schema.Field(0).Type, arrow.DataType(arrow.PrimitiveTypes.Int64))
+		assert.Equal(t, schema.Field(0).Nullable, true)
+		assert.Equal(t, columns["id"], []string{"1", "(null)", "(null)"})
+		// The null email isn't redacted
+		assert.Equal(t, columns["email"], []string{"ada@example.com", "(null)", "**redacted**"})
+		assert.Equal(t, columns["balance"], []string{"10.5", "99", "250"})
+	})
+
+	t.Run("schema adjusted to the actions", func(t *testing.T) {
+		rules := []types.Rule{{Actions: []types.Action{
+			{ActionType: "EXCLUDE", FieldName: "email"},
+			{ActionType: "REDACT", FieldName: "balance"},
+		}}}
+		output := bytes.NewBuffer(nil)
+		transformErr := ExecuteRules(writeAccounts(t, true), rules, true, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform arrow: %v", transformErr.Message)
+		}
+		assert.Equal(t, bytes.HasPrefix(output.Bytes(), fileMagic), false)
+		schema, columns := readColumns(t, output.Bytes())
+		assert.Equal(t, Columns(schema), []string{"id", "balance"})
+		assert.Equal(t, schema.Field(1).Type, arrow.DataType(arrow.BinaryTypes.String))
+		assert.Equal(t, columns["balance"], []string{"**redacted**", "**redacted**", "**redacted**"})
+	})
+
+	t.Run("pages of rows across the batches", func(t *testing.T) {
+		pages, err := Pages(writeAccounts(t, false), 2)
+		if err != nil {
+			t.Fatalf("Failed to paginate: %v", err)
+		}
+		assert.Equal(t, len(pages), 2)
+		_, columns := readColumns(t, pages[1])
+		assert.Equal(t, columns["id"], []string{"3"})
+	})
+}
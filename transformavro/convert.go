@@ -0,0 +1,413 @@
+package transformavro
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+/*
+toDocument converts a record decoded by goavro into a JSON like document so the JSON rules can be applied.
+Unions are unwrapped, numbers become json.Number (decimals are scaled), dates and timestamps become RFC 3339 strings.
+*/
+func toDocument(native any, node *schema) any {
+	if native == nil {
+		return nil
+	}
+	switch node.kind {
+	case "union":
+		// goavro wraps the union values with the name of the branch
+		wrapped, ok := native.(map[string]any)
+		if !ok {
+			return native
+		}
+		for name, value := range wrapped {
+			for _, branch := range node.branches {
+				if branch.unionName() == name {
+					return toDocument(value, branch)
+				}
+			}
+		}
+		return nil
+	case "record":
+		record, _ := native.(map[string]any)
+		document := make(map[string]any, len(node.fields))
+		for _, field := range node.fields {
+			document[field.name] = toDocument(record[field.name], field.schema)
+		}
+		return document
+	case "array":
+		array, _ := native.([]any)
+		document := make([]any, len(array))
+		for i, item := range array {
+			document[i] = toDocument(item, node.items)
+		}
+		return document
+	case "map":
+		object, _ := native.(map[string]any)
+		document := make(map[string]any, len(object))
+		for key, value := range object {
+			document[key] = toDocument(value, node.items)
+		}
+		return document
+	}
+
+	switch value := native.(type) {
+	case int32:
+		return json.Number(strconv.FormatInt(int64(value), 10))
+	case int64:
+		return json.Number(strconv.FormatInt(value, 10))
+	case float32:
+		return json.Number(strconv.FormatFloat(float64(value), 'g', -1, 32))
+	case float64:
+		return json.Number(strconv.FormatFloat(value, 'g', -1, 64))
+	case []byte:
+		return string(value)
+	case *big.Rat:
+		return json.Number(value.FloatString(int(node.scale)))
+	case time.Duration:
+		if node.logicalType == "time-millis" {
+			return json.Number(strconv.FormatInt(value.Milliseconds(), 10))
+		}
+		return json.Number(strconv.FormatInt(value.Microseconds(), 10))
+	case time.Time:
+		if node.logicalType == "date" {
+			return value.UTC().Format(dateLayout)
+		}
+		return value.UTC().Format(time.RFC3339Nano)
+	}
+	return native
+}
+
+/*
+fromDocument converts the transformed document back into the goavro representation of the schema.
+It returns false when the document doesn't fit the schema.
+*/
+func fromDocument(document any, node *schema) (any, bool) {
+	switch node.kind {
+	case "union":
+		if document == nil {
+			return nil, node.branch("null") != nil
+		}
+		// The first branch that can hold the value is used
+		for _, branch := range node.branches {
+			if branch.kind == "null" {
+				continue
+			}
+			if value, ok := fromDocument(document, branch); ok {
+				return map[string]any{branch.unionName(): value}, true
+			}
+		}
+		return nil, false
+	case "null":
+		return nil, document == nil
+	case "record":
+		object, ok := document.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		record := make(map[string]any, len(node.fields))
+		for _, field := range node.fields {
+			value, ok := fromDocument(object[field.name], field.schema)
+			if !ok {
+				return nil, false
+			}
+			record[field.name] = value
+		}
+		return record, true
+	case "array":
+		array, ok := document.([]any)
+		if !ok {
+			return nil, false
+		}
+		values := make([]any, 0, len(array))
+		for _, item := range array {
+			if isExcluded(item, node.items) {
+				continue
+			}
+			value, ok := fromDocument(item, node.items)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, value)
+		}
+		return values, true
+	case "map":
+		object, ok := document.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		values := make(map[string]any, len(object))
+		for key, item := range object {
+			value, ok := fromDocument(item, node.items)
+			if !ok {
+				return nil, false
+			}
+			values[key] = value
+		}
+		return values, true
+	case "boolean":
+		boolean, ok := document.(bool)
+		return boolean, ok
+	case "string":
+		text, ok := document.(string)
+		return text, ok
+	case "enum":
+		text, ok := document.(string)
+		return text, ok && contains(node.symbols, text)
+	case "bytes", "fixed":
+		if node.logicalType == "decimal" {
+			return decimalFromDocument(document, node.scale)
+		}
+		text, ok := document.(string)
+		if !ok || (node.kind == "fixed" && int64(len(text)) != node.size) {
+			return nil, false
+		}
+		return []byte(text), true
+	case "int", "long":
+		return integerFromDocument(document, node)
+	case "float", "double":
+		number, ok := document.(json.Number)
+		if !ok {
+			return nil, false
+		}
+		bitSize := 64
+		if node.kind == "float" {
+			bitSize = 32
+		}
+		float, err := strconv.ParseFloat(number.String(), bitSize)
+		if err != nil {
+			return nil, false
+		}
+		if node.kind == "float" {
+			return float32(float), true
+		}
+		return float, true
+	}
+	return nil, false
+}
+
+func integerFromDocument(document any, node *schema) (any, bool) {
+	// Dates and timestamps are strings in the document
+	if text, ok := document.(string); ok {
+		switch node.logicalType {
+		case "date":
+			date, err := time.Parse(dateLayout, text)
+			return date, err == nil
+		case "timestamp-millis", "timestamp-micros":
+			timestamp, err := time.Parse(time.RFC3339Nano, text)
+			return timestamp, err == nil
+		}
+		return nil, false
+	}
+	number, ok := document.(json.Number)
+	if !ok {
+		return nil, false
+	}
+	bitSize := 64
+	if node.kind == "int" {
+		bitSize = 32
+	}
+	integer, err := strconv.ParseInt(number.String(), 10, bitSize)
+	if err != nil {
+		return nil, false
+	}
+	switch node.logicalType {
+	case "date", "timestamp-millis", "timestamp-micros":
+		return nil, false
+	case "time-millis":
+		return time.Duration(integer) * time.Millisecond, true
+	case "time-micros":
+		return time.Duration(integer) * time.Microsecond, true
+	}
+	if node.kind == "int" {
+		return int32(integer), true
+	}
+	return integer, true
+}
+
+// decimalFromDocument returns the decimal, false when it has more decimals than the scale
+func decimalFromDocument(document any, scale int64) (any, bool) {
+	number, ok := document.(json.Number)
+	if !ok {
+		return nil, false
+	}
+	rat, ok := new(big.Rat).SetString(number.String())
+	if !ok {
+		return nil, false
+	}
+	unscaled := new(big.Rat).Mul(rat, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(scale), nil)))
+	return rat, unscaled.IsInt()
+}
+
+/*
+adjust records how the transformed document differs from the schema, and returns the schema widened with the types of the values it can't hold.
+Redacted values add a string branch, excluded fields are counted to become optional or removed by finish.
+*/
+func (node *schema) adjust(document any) *schema {
+	switch node.kind {
+	case "union":
+		// Objects and arrays are adjusted in their branch, other values must fit one of the branches
+		for i, branch := range node.branches {
+			if (branch.kind == "record" && isObject(document)) || (branch.kind == "array" && isArray(document)) {
+				node.branches[i] = branch.adjust(document)
+				return node
+			}
+		}
+		for i, branch := range node.branches {
+			if branch.kind == "map" && isObject(document) {
+				node.branches[i] = branch.adjust(document)
+				return node
+			}
+		}
+	case "record":
+		object, ok := document.(map[string]any)
+		if !ok {
+			break
+		}
+		node.records++
+		for _, field := range node.fields {
+			if value, present := object[field.name]; present {
+				field.present++
+				field.schema = field.schema.adjust(value)
+			}
+		}
+		return node
+	case "array":
+		array, ok := document.([]any)
+		if !ok {
+			break
+		}
+		for _, item := range array {
+			if !isExcluded(item, node.items) {
+				node.items = node.items.adjust(item)
+			}
+		}
+		return node
+	case "map":
+		object, ok := document.(map[string]any)
+		if !ok {
+			break
+		}
+		for _, item := range object {
+			node.items = node.items.adjust(item)
+		}
+		return node
+	}
+	if _, ok := fromDocument(document, node); ok {
+		return node
+	}
+	return node.widen(document)
+}
+
+// widen adds the type of the value as a branch of the union, null is added first
+func (node *schema) widen(document any) *schema {
+	var kind string
+	switch typedDocument := document.(type) {
+	case nil:
+		kind = "null"
+	case string:
+		kind = "string"
+	case bool:
+		kind = "boolean"
+	case json.Number:
+		kind = "double"
+		if _, err := typedDocument.Int64(); err == nil {
+			kind = "long"
+		}
+	default:
+		// Objects and arrays are only changed by the actions inside them
+		return node
+	}
+	union := node
+	if node.kind != "union" {
+		union = &schema{kind: "union", branches: []*schema{node}}
+	}
+	if union.branch(kind) != nil {
+		return union
+	}
+	if kind == "null" {
+		union.branches = append([]*schema{{kind: kind}}, union.branches...)
+	} else {
+		union.branches = append(union.branches, &schema{kind: kind})
+	}
+	return union
+}
+
+/*
+finish removes the fields excluded from every record, and makes the fields excluded from some records optional
+*/
+func (node *schema) finish(finished map[*schema]bool) {
+	if finished[node] {
+		return
+	}
+	finished[node] = true
+	switch node.kind {
+	case "union":
+		for _, branch := range node.branches {
+			branch.finish(finished)
+		}
+	case "array", "map":
+		node.items.finish(finished)
+	case "record":
+		fields := []*recordField{}
+		for _, field := range node.fields {
+			if node.records > 0 && field.present == 0 {
+				continue
+			}
+			if field.present < node.records {
+				field.schema = field.schema.widen(nil)
+			}
+			// The default must match the first branch
+			if field.schema.kind == "union" && field.schema.branches[0].kind == "null" && field.attributes["default"] != nil {
+				field.attributes["default"] = nil
+			}
+			field.schema.finish(finished)
+			fields = append(fields, field)
+		}
+		node.fields = fields
+	}
+}
+
+/*
+	Helper functions
+*/
+// branch returns the unnamed branch of the union with the kind
+func (node *schema) branch(kind string) *schema {
+	for _, branch := range node.branches {
+		if branch.kind == kind && branch.name == "" && branch.logicalType == "" {
+			return branch
+		}
+	}
+	return nil
+}
+
+// isExcluded checks for the empty array EXCLUDE puts in place of array elements
+func isExcluded(item any, items *schema) bool {
+	array, ok := item.([]any)
+	if !ok || len(array) > 0 {
+		return false
+	}
+	if items.kind == "union" {
+		for _, branch := range items.branches {
+			if branch.kind == "array" {
+				return false
+			}
+		}
+		return true
+	}
+	return items.kind != "array"
+}
+
+func isObject(document any) bool {
+	_, ok := document.(map[string]any)
+	return ok
+}
+
+func isArray(document any) bool {
+	_, ok := document.([]any)
+	return ok
+}
@@ -0,0 +1,264 @@
+package transformavro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/*
+schema is a node of the Avro schema. Named types (records, enums and fixed) are shared by every reference to their name.
+*/
+type schema struct {
+	// null, boolean, int, long, float, double, bytes, string, record, enum, array, map, fixed or union
+	kind        string
+	name        string
+	logicalType string
+	scale       int64
+	// Definition as written in the file, written back with the adjusted children
+	attributes map[string]any
+	fields     []*recordField
+	symbols    []string
+	size       int64
+	// Items of arrays and values of maps
+	items    *schema
+	branches []*schema
+	// Number of documents decoded as this record, used to adjust the fields
+	records int
+}
+
+type recordField struct {
+	name       string
+	attributes map[string]any
+	schema     *schema
+	// Number of records the field was kept in
+	present int
+}
+
+var primitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true, "float": true, "double": true, "bytes": true, "string": true,
+}
+
+// parseSchema parses the schema embedded in the file
+func parseSchema(specification string) (*schema, error) {
+	decoder := json.NewDecoder(strings.NewReader(specification))
+	decoder.UseNumber()
+	var definition any
+	if err := decoder.Decode(&definition); err != nil {
+		return nil, fmt.Errorf("file is not a valid avro file: %v", err)
+	}
+	return buildSchema(definition, "", map[string]*schema{})
+}
+
+func buildSchema(definition any, namespace string, named map[string]*schema) (*schema, error) {
+	switch typedDefinition := definition.(type) {
+	case string:
+		if primitives[typedDefinition] {
+			return &schema{kind: typedDefinition}, nil
+		}
+		// Reference to a named type, short names are resolved in the enclosing namespace
+		if node, ok := named[fullName(typedDefinition, "", namespace)]; ok {
+			return node, nil
+		}
+		if node, ok := named[typedDefinition]; ok {
+			return node, nil
+		}
+		return nil, fmt.Errorf("unknown avro type %s", typedDefinition)
+	case []any:
+		node := &schema{kind: "union"}
+		for _, branchDefinition := range typedDefinition {
+			branch, err := buildSchema(branchDefinition, namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			node.branches = append(node.branches, branch)
+		}
+		return node, nil
+	case map[string]any:
+		kind, ok := typedDefinition["type"].(string)
+		if !ok {
+			// {"type": {...}} wraps another definition
+			return buildSchema(typedDefinition["type"], namespace, named)
+		}
+		node := &schema{kind: kind, attributes: typedDefinition}
+		node.logicalType, _ = typedDefinition["logicalType"].(string)
+		if scale, ok := typedDefinition["scale"].(json.Number); ok {
+			node.scale, _ = scale.Int64()
+		}
+		switch kind {
+		case "record", "error", "enum", "fixed":
+			name, _ := typedDefinition["name"].(string)
+			childNamespace, _ := typedDefinition["namespace"].(string)
+			node.name = fullName(name, childNamespace, namespace)
+			// Registered before the fields, records can reference themselves
+			named[node.name] = node
+			if index := strings.LastIndex(node.name, "."); index > -1 {
+				namespace = node.name[:index]
+			}
+		}
+		switch kind {
+		case "record", "error":
+			node.kind = "record"
+			fieldDefinitions, _ := typedDefinition["fields"].([]any)
+			for _, fieldDefinition := range fieldDefinitions {
+				attributes, ok := fieldDefinition.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("invalid field in avro record %s", node.name)
+				}
+				fieldSchema, err := buildSchema(attributes["type"], namespace, named)
+				if err != nil {
+					return nil, err
+				}
+				name, _ := attributes["name"].(string)
+				node.fields = append(node.fields, &recordField{name: name, attributes: attributes, schema: fieldSchema})
+			}
+		case "enum":
+			symbols, _ := typedDefinition["symbols"].([]any)
+			for _, symbol := range symbols {
+				node.symbols = append(node.symbols, fmt.Sprint(symbol))
+			}
+		case "fixed":
+			if size, ok := typedDefinition["size"].(json.Number); ok {
+				node.size, _ = size.Int64()
+			}
+		case "array", "map":
+			key := "items"
+			if kind == "map" {
+				key = "values"
+			}
+			items, err := buildSchema(typedDefinition[key], namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			node.items = items
+		default:
+			if !primitives[kind] {
+				return buildSchema(kind, namespace, named)
+			}
+		}
+		return node, nil
+	}
+	return nil, fmt.Errorf("invalid avro schema %v", definition)
+}
+
+func fullName(name string, namespace string, enclosingNamespace string) string {
+	if strings.Contains(name, ".") {
+		return name
+	}
+	if namespace == "" {
+		namespace = enclosingNamespace
+	}
+	if namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+/*
+definition writes the schema back as JSON, named types are defined the first time they are written and referenced by name after
+*/
+func (node *schema) definition(defined map[*schema]bool) any {
+	if node.name != "" && defined[node] {
+		return node.name
+	}
+	if node.attributes == nil && node.kind != "union" {
+		return node.kind
+	}
+	if node.kind == "union" {
+		branches := make([]any, len(node.branches))
+		for i, branch := range node.branches {
+			branches[i] = branch.definition(defined)
+		}
+		return branches
+	}
+
+	definition := make(map[string]any, len(node.attributes))
+	for key, value := range node.attributes {
+		definition[key] = value
+	}
+	switch node.kind {
+	case "record":
+		defined[node] = true
+		fields := make([]any, len(node.fields))
+		for i, field := range node.fields {
+			fieldDefinition := make(map[string]any, len(field.attributes))
+			for key, value := range field.attributes {
+				fieldDefinition[key] = value
+			}
+			fieldDefinition["type"] = field.schema.definition(defined)
+			fields[i] = fieldDefinition
+		}
+		definition["fields"] = fields
+	case "enum", "fixed":
+		defined[node] = true
+	case "array":
+		definition["items"] = node.items.definition(defined)
+	case "map":
+		definition["values"] = node.items.definition(defined)
+	}
+	return definition
+}
+
+// unionName is the name of the branch in the unions decoded by goavro
+func (node *schema) unionName() string {
+	switch {
+	case node.name != "":
+		return node.name
+	case node.kind == "bytes" && node.logicalType == "decimal":
+		return "bytes.decimal"
+	}
+	switch node.kind + "." + node.logicalType {
+	case "long.timestamp-millis", "long.timestamp-micros", "int.time-millis", "long.time-micros", "int.date":
+		return node.kind + "." + node.logicalType
+	}
+	return node.kind
+}
+
+/*
+paths lists the paths of the record fields in the same notation as the JSON paths, arrays use [*]
+*/
+func (node *schema) paths(currentPath string, paths []string, visiting map[*schema]bool) []string {
+	switch node.kind {
+	case "union":
+		for _, branch := range node.branches {
+			paths = branch.paths(currentPath, paths, visiting)
+		}
+	case "array":
+		arrayPath := currentPath + "[*]"
+		if !contains(paths, arrayPath) {
+			paths = append(paths, arrayPath)
+		}
+		paths = node.items.paths(arrayPath, paths, visiting)
+	case "record":
+		// Recursive records are listed once
+		if visiting[node] {
+			return paths
+		}
+		visiting[node] = true
+		for _, field := range node.fields {
+			path := field.name
+			if currentPath != "" {
+				path = currentPath + "." + field.name
+			}
+			if !contains(paths, path) {
+				paths = append(paths, path)
+			}
+			paths = field.schema.paths(path, paths, visiting)
+		}
+		delete(visiting, node)
+	}
+	// Map keys are data, only the map itself has a path
+	return paths
+}
+
+/*
+	Helper functions
+*/
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
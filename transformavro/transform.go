@@ -0,0 +1,237 @@
+package transformavro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+	"lazy-lagoon/transformjson"
+	"strings"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Records written in a block of the output
+const blockSize = 1000
+
+/*
+Step 1: execute transform, and store in output storage
+*/
+func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
+	/*
+		Downloading the file from the input storage type
+	*/
+	byteContent, err := storage.GetBytes(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	/*
+		The records are transformed as JSON documents, the rules are compiled once for every record
+	*/
+	plan, transformErr := transformjson.Compile(rules)
+	if transformErr != nil {
+		return transformErr
+	}
+	/*
+		Writing the blocks into a multipart upload
+	*/
+	upload, err := storage.NewMultipartWriter(output)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	transformErr = ExecuteRecords(byteContent, plan, upload)
+	if transformErr != nil {
+		return transformErr
+	}
+	err = upload.Close()
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
+	return nil
+}
+
+/*
+Step 2: Transform every record of the Avro content and write it to the writer with the compression of the input.
+The records are transformed twice, the first pass adjusts the schema to the excluded and redacted fields, the second one writes the records.
+*/
+func ExecuteRecords(byteContent []byte, plan *transformjson.Plan, output io.Writer) *types.TransformError {
+	// The records are decoded with the schema of the file, root is adjusted for the output
+	original, err := readSchema(byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	root, err := readSchema(byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	transformErr := forEachDocument(byteContent, original, plan, func(document any) *types.TransformError {
+		root = root.adjust(document)
+		return nil
+	})
+	if transformErr != nil {
+		return transformErr
+	}
+	root.finish(map[*schema]bool{})
+
+	specification, err := json.Marshal(root.definition(map[*schema]bool{}))
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	avroWriter, err := newWriter(byteContent, output, string(specification))
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+
+	var block []any
+	recordIndex := 0
+	transformErr = forEachDocument(byteContent, original, plan, func(document any) *types.TransformError {
+		record, ok := fromDocument(document, root)
+		if !ok {
+			return &types.TransformError{Message: fmt.Sprintf("error writing avro record %d, it doesn't match the schema", recordIndex)}
+		}
+		recordIndex++
+		block = append(block, record)
+		if len(block) == blockSize {
+			if err := avroWriter.Append(block); err != nil {
+				return &types.TransformError{Message: fmt.Sprintf("error writing avro records: %v", err)}
+			}
+			block = nil
+		}
+		return nil
+	})
+	if transformErr != nil {
+		return transformErr
+	}
+	if len(block) > 0 {
+		if err := avroWriter.Append(block); err != nil {
+			return &types.TransformError{Message: fmt.Sprintf("error writing avro records: %v", err)}
+		}
+	}
+	return nil
+}
+
+/*
+Paths returns the paths of the record fields of the Avro content, nested records included
+*/
+func Paths(byteContent []byte) ([]string, error) {
+	root, err := readSchema(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	return root.paths("", []string{}, map[*schema]bool{}), nil
+}
+
+/*
+Pages splits the Avro content into Avro files of recordsPerPage records with the same schema - used for preview
+*/
+func Pages(byteContent []byte, recordsPerPage int) ([][]byte, error) {
+	avroReader, err := goavro.NewOCFReader(bytes.NewReader(byteContent))
+	if err != nil {
+		return nil, fmt.Errorf("file is not a valid avro file: %v", err)
+	}
+	var pages [][]byte
+	var records []any
+	for avroReader.Scan() {
+		record, err := avroReader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("error reading avro record: %v", err)
+		}
+		records = append(records, record)
+		if len(records) == recordsPerPage {
+			page, err := writePage(byteContent, avroReader, records)
+			if err != nil {
+				return nil, err
+			}
+			pages = append(pages, page)
+			records = nil
+		}
+	}
+	if err := avroReader.Err(); err != nil {
+		return nil, fmt.Errorf("error reading avro record: %v", err)
+	}
+	if len(records) > 0 {
+		page, err := writePage(byteContent, avroReader, records)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+/*
+	Helper functions
+*/
+// readSchema parses the schema embedded in the header of the file
+func readSchema(byteContent []byte) (*schema, error) {
+	avroReader, err := goavro.NewOCFReader(bytes.NewReader(byteContent))
+	if err != nil {
+		return nil, fmt.Errorf("file is not a valid avro file: %v", err)
+	}
+	return parseSchema(avroReader.Codec().Schema())
+}
+
+// forEachDocument decodes every record and calls fn with the record transformed by the plan
+func forEachDocument(byteContent []byte, original *schema, plan *transformjson.Plan, fn func(document any) *types.TransformError) *types.TransformError {
+	avroReader, err := goavro.NewOCFReader(bytes.NewReader(byteContent))
+	if err != nil {
+		return &types.TransformError{Message: fmt.Sprintf("file is not a valid avro file: %v", err)}
+	}
+	for avroReader.Scan() {
+		record, err := avroReader.Read()
+		if err != nil {
+			return &types.TransformError{Message: fmt.Sprintf("error reading avro record: %v", err)}
+		}
+		// The document isn't shared so it's mutated in place
+		document, transformErr := plan.Execute(toDocument(record, original))
+		if transformErr != nil {
+			return transformErr
+		}
+		if transformErr := fn(document); transformErr != nil {
+			return transformErr
+		}
+	}
+	if err := avroReader.Err(); err != nil {
+		return &types.TransformError{Message: fmt.Sprintf("error reading avro record: %v", err)}
+	}
+	return nil
+}
+
+// newWriter writes the header with the schema, and the compression and metadata of the input
+func newWriter(byteContent []byte, output io.Writer, specification string) (*goavro.OCFWriter, error) {
+	avroReader, err := goavro.NewOCFReader(bytes.NewReader(byteContent))
+	if err != nil {
+		return nil, fmt.Errorf("file is not a valid avro file: %v", err)
+	}
+	codec, err := goavro.NewCodec(specification)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the avro schema: %v", err)
+	}
+	// The avro. keys are reserved for the schema and the compression
+	metaData := map[string][]byte{}
+	for key, value := range avroReader.MetaData() {
+		if !strings.HasPrefix(key, "avro.") {
+			metaData[key] = value
+		}
+	}
+	return goavro.NewOCFWriter(goavro.OCFConfig{
+		W:               output,
+		Codec:           codec,
+		CompressionName: avroReader.CompressionName(),
+		MetaData:        metaData,
+	})
+}
+
+func writePage(byteContent []byte, avroReader *goavro.OCFReader, records []any) ([]byte, error) {
+	page := bytes.NewBuffer(nil)
+	avroWriter, err := newWriter(byteContent, page, avroReader.Codec().Schema())
+	if err != nil {
+		return nil, err
+	}
+	if err := avroWriter.Append(records); err != nil {
+		return nil, fmt.Errorf("error writing avro records: %v", err)
+	}
+	return page.Bytes(), nil
+}
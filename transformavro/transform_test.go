@@ -0,0 +1,175 @@
+package transformavro
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/transformjson"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/linkedin/goavro/v2"
+)
+
+const eventSchema = `{
+	"type": "record",
+	"name": "Event",
+	"namespace": "com.example",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "email", "type": ["null", "string"], "default": null},
+		{"name": "amount", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}},
+		{"name": "createdAt", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "address", "type": {"type": "record", "name": "Address", "fields": [
+			{"name": "city", "type": "string"},
+			{"name": "zip", "type": "string"}
+		]}},
+		{"name": "previous", "type": ["null", "Address"], "default": null}
+	]
+}`
+
+func writeEvents(t *testing.T, events []any) []byte {
+	content := bytes.NewBuffer(nil)
+	avroWriter, err := goavro.NewOCFWriter(goavro.OCFConfig{W: content, Schema: eventSchema, CompressionName: "deflate"})
+	if err != nil {
+		t.Fatalf("Failed to create avro writer: %v", err)
+	}
+	if err := avroWriter.Append(events); err != nil {
+		t.Fatalf("Failed to write avro records: %v", err)
+	}
+	return content.Bytes()
+}
+
+func readEvents(t *testing.T, content []byte) (*schema, []any) {
+	avroReader, err := goavro.NewOCFReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to read avro: %v", err)
+	}
+	root, err := parseSchema(avroReader.Codec().Schema())
+	if err != nil {
+		t.Fatalf("Failed to parse avro schema: %v", err)
+	}
+	assert.Equal(t, avroReader.CompressionName(), "deflate")
+	documents := []any{}
+	for avroReader.Scan() {
+		record, err := avroReader.Read()
+		if err != nil {
+			t.Fatalf("Failed to read avro record: %v", err)
+		}
+		documents = append(documents, toDocument(record, root))
+	}
+	return root, documents
+}
+
+func TestExecuteRecords(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	content := writeEvents(t, []any{
+		map[string]any{
+			"id":        int64(1),
+			"email":     goavro.Union("string", "ada@example.com"),
+			"amount":    big.NewRat(1234, 100),
+			"createdAt": createdAt,
+			"tags":      []any{"vip", "beta"},
+			"address":   map[string]any{"city": "London", "zip": "N1"},
+			"previous":  goavro.Union("com.example.Address", map[string]any{"city": "Paris", "zip": "75001"}),
+		},
+		map[string]any{
+			"id":        int64(2),
+			"email":     nil,
+			"amount":    big.NewRat(-5, 100),
+			"createdAt": createdAt,
+			"tags":      []any{},
+			"address":   map[string]any{"city": "Leeds", "zip": "LS1"},
+			"previous":  nil,
+		},
+	})
+
+	t.Run("paths of the fields", func(t *testing.T) {
+		paths, err := Paths(content)
+		if err != nil {
+			t.Fatalf("Failed to get paths: %v", err)
+		}
+		assert.Equal(t, paths, []string{
+			"id", "email", "amount", "createdAt", "tags", "tags[*]", "address", "address.city", "address.zip",
+			"previous", "previous.city", "previous.zip",
+		})
+	})
+
+	t.Run("schema is adjusted to the actions", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				// Decimals are compared with their scale
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "amount", Operator: "LT", Value: "0"}},
+				},
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "id"}},
+			},
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "address.city", Operator: "EQ", Value: "London"}},
+				},
+				Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "address.zip"}},
+			},
+			{Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "email"}}},
+			{Actions: []types.Action{{ActionType: "REDACT", FieldName: "previous"}}},
+			{Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "tags[*]"}}},
+		}
+		plan, transformErr := transformjson.Compile(rules)
+		if transformErr != nil {
+			t.Fatalf("Failed to compile rules: %v", transformErr)
+		}
+		output := bytes.NewBuffer(nil)
+		transformErr = ExecuteRecords(content, plan, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform avro: %v", transformErr)
+		}
+
+		root, documents := readEvents(t, output.Bytes())
+		assert.Equal(t, documents, []any{
+			map[string]any{
+				"id":        json.Number("1"),
+				"amount":    json.Number("12.34"),
+				"createdAt": "2024-05-01T10:30:00Z",
+				"tags":      []any{},
+				"address":   map[string]any{"city": "London", "zip": nil},
+				"previous":  "**redacted**",
+			},
+			map[string]any{
+				"id":        "**redacted**",
+				"amount":    json.Number("-0.05"),
+				"createdAt": "2024-05-01T10:30:00Z",
+				"tags":      []any{},
+				"address":   map[string]any{"city": "Leeds", "zip": "LS1"},
+				"previous":  "**redacted**",
+			},
+		})
+
+		// email is removed, the redacted id gets a string branch and the zip becomes optional
+		fields := map[string]any{}
+		defined := map[*schema]bool{}
+		for _, field := range root.fields {
+			fields[field.name] = field.schema.definition(defined)
+		}
+		assert.Equal(t, len(fields), 6)
+		assert.Equal(t, fields["id"], []any{"long", "string"})
+		assert.Equal(t, fields["previous"], []any{"null", "com.example.Address", "string"})
+		address := root.fields[4].schema
+		assert.Equal(t, address.fields[1].schema.definition(map[*schema]bool{}), []any{"null", "string"})
+	})
+
+	t.Run("pages keep the schema", func(t *testing.T) {
+		pages, err := Pages(content, 1)
+		if err != nil {
+			t.Fatalf("Failed to paginate avro: %v", err)
+		}
+		assert.Equal(t, len(pages), 2)
+		_, documents := readEvents(t, pages[1])
+		assert.Equal(t, documents[0].(map[string]any)["amount"], json.Number("-0.05"))
+	})
+}
@@ -0,0 +1,312 @@
+package transformconvert
+
+import (
+	"fmt"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/transformjson"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// How arrays are flattened into CSV columns
+const (
+	ArraysJoin    = "JOIN"
+	ArraysIndex   = "INDEX"
+	ArraysExplode = "EXPLODE"
+)
+
+const defaultSeparator = "|"
+
+/*
+field is a column of a flattened row, the keys are the paths of extractJsonPaths (e.g. customer.name or items[*].sku)
+*/
+type field struct {
+	key   string
+	value any
+}
+
+/*
+FlattenSettings resolves the flatten options of the output, nil when the values aren't flattened
+*/
+func FlattenSettings(options *types.FlattenOptions) (*types.FlattenOptions, error) {
+	if options == nil {
+		return nil, nil
+	}
+	settings := *options
+	settings.Arrays = strings.ToUpper(settings.Arrays)
+	switch settings.Arrays {
+	case "":
+		settings.Arrays = ArraysIndex
+	case ArraysJoin, ArraysIndex, ArraysExplode:
+	default:
+		return nil, fmt.Errorf("flatten arrays %s not supported, use JOIN, INDEX or EXPLODE", options.Arrays)
+	}
+	if settings.Separator == "" {
+		settings.Separator = defaultSeparator
+	}
+	return &settings, nil
+}
+
+/*
+flatten returns the rows of the value with a column per scalar. Objects add their keys to the path,
+arrays are joined into one column, indexed with a column per element, or exploded into a row per element with the other fields repeated.
+*/
+func flatten(path string, value any, settings *types.FlattenOptions) ([][]field, error) {
+	switch value := value.(type) {
+	case *transformjson.Object:
+		values := make(map[string]any, value.Len())
+		for _, key := range value.Keys() {
+			values[key], _ = value.Get(key)
+		}
+		return flattenObject(path, value.Keys(), values, settings)
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return flattenObject(path, keys, value, settings)
+	case []any:
+		return flattenArray(path, value, settings)
+	}
+	if path == "" {
+		path = "value"
+	}
+	return [][]field{{{key: path, value: value}}}, nil
+}
+
+/*
+unflatten converts the fields of a CSV row into nested objects, the headers are dot paths with [0] indexes or [*] joined values.
+Empty fields are left out, elements without fields are removed from the arrays.
+*/
+func unflatten(header []string, row []string, excluded []bool, separator string) (*transformjson.Object, error) {
+	root := transformjson.NewObject()
+	for column, key := range header {
+		if (column < len(excluded) && excluded[column]) || column >= len(row) || row[column] == "" {
+			continue
+		}
+		tokens := parsePath(key)
+		star := -1
+		for index, token := range tokens {
+			if token == "[*]" {
+				star = index
+				break
+			}
+		}
+		if star < 0 {
+			err := setPath(root, tokens, inferType(row, column), key)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Every joined value is an element of the array
+		for index, part := range strings.Split(row[column], separator) {
+			elementTokens := append(append(append([]string{}, tokens[:star]...), "["+strconv.Itoa(index)+"]"), tokens[star+1:]...)
+			err := setPath(root, elementTokens, inferType([]string{part}, 0), key)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	compact(root)
+	return root, nil
+}
+
+/*
+	Helper functions
+*/
+func flattenObject(path string, keys []string, values map[string]any, settings *types.FlattenOptions) ([][]field, error) {
+	rows := [][]field{{}}
+	for _, key := range keys {
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+		childRows, err := flatten(childPath, values[key], settings)
+		if err != nil {
+			return nil, err
+		}
+		rows = product(rows, childRows)
+	}
+	return rows, nil
+}
+
+func flattenArray(path string, elements []any, settings *types.FlattenOptions) ([][]field, error) {
+	switch settings.Arrays {
+	case ArraysIndex:
+		rows := [][]field{{}}
+		for index, element := range elements {
+			childRows, err := flatten(path+"["+strconv.Itoa(index)+"]", element, settings)
+			if err != nil {
+				return nil, err
+			}
+			rows = product(rows, childRows)
+		}
+		return rows, nil
+	case ArraysExplode:
+		// An empty array keeps the row, its columns are empty
+		if len(elements) == 0 {
+			return [][]field{{}}, nil
+		}
+		rows := [][]field{}
+		for _, element := range elements {
+			childRows, err := flatten(path+"[*]", element, settings)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, childRows...)
+		}
+		return rows, nil
+	}
+	// Joined: the values of every column in the order of the elements, empty when an element doesn't have it
+	keys := []string{}
+	joined := map[string][]string{}
+	for index, element := range elements {
+		childRows, err := flatten(path+"[*]", element, settings)
+		if err != nil {
+			return nil, err
+		}
+		for _, childField := range childRows[0] {
+			if _, exists := joined[childField.key]; !exists {
+				keys = append(keys, childField.key)
+				joined[childField.key] = make([]string, len(elements))
+			}
+			value, err := fieldString(childField.value)
+			if err != nil {
+				return nil, err
+			}
+			joined[childField.key][index] = value
+		}
+	}
+	row := make([]field, 0, len(keys))
+	for _, key := range keys {
+		row = append(row, field{key: key, value: strings.Join(joined[key], settings.Separator)})
+	}
+	return [][]field{row}, nil
+}
+
+// product returns every row combined with every child row, the rows are repeated for every exploded element
+func product(rows [][]field, childRows [][]field) [][]field {
+	if len(childRows) == 1 {
+		for index := range rows {
+			rows[index] = append(rows[index], childRows[0]...)
+		}
+		return rows
+	}
+	combined := make([][]field, 0, len(rows)*len(childRows))
+	for _, row := range rows {
+		for _, childRow := range childRows {
+			combined = append(combined, append(append([]field{}, row...), childRow...))
+		}
+	}
+	return combined
+}
+
+// parsePath splits items[0].sku into items, [0] and sku
+func parsePath(key string) []string {
+	tokens := []string{}
+	for _, part := range strings.Split(key, ".") {
+		for {
+			open := strings.Index(part, "[")
+			closing := strings.Index(part, "]")
+			if open < 0 || closing < open {
+				break
+			}
+			if open > 0 {
+				tokens = append(tokens, part[:open])
+			}
+			tokens = append(tokens, part[open:closing+1])
+			part = part[closing+1:]
+		}
+		if part != "" {
+			tokens = append(tokens, part)
+		}
+	}
+	return tokens
+}
+
+// setPath sets the value at the tokens, creating the objects and arrays on the way
+func setPath(root *transformjson.Object, tokens []string, value any, key string) error {
+	var node any = root
+	for index, token := range tokens {
+		last := index == len(tokens)-1
+		var child any
+		if isIndex(token) {
+			array, isArray := node.(*[]any)
+			if !isArray {
+				return fmt.Errorf("column %s conflicts with another column", key)
+			}
+			position, _ := strconv.Atoi(token[1 : len(token)-1])
+			for len(*array) <= position {
+				*array = append(*array, nil)
+			}
+			if last {
+				(*array)[position] = value
+				return nil
+			}
+			if (*array)[position] == nil {
+				(*array)[position] = newNode(tokens[index+1])
+			}
+			child = (*array)[position]
+		} else {
+			parent, isObject := node.(*transformjson.Object)
+			if !isObject {
+				return fmt.Errorf("column %s conflicts with another column", key)
+			}
+			existing, exists := parent.Get(token)
+			if last {
+				if exists {
+					return fmt.Errorf("column %s conflicts with another column", key)
+				}
+				parent.Set(token, value)
+				return nil
+			}
+			if !exists {
+				existing = newNode(tokens[index+1])
+				parent.Set(token, existing)
+			}
+			child = existing
+		}
+		node = child
+	}
+	return nil
+}
+
+// newNode is the array or object holding the next token, arrays are pointers while they grow
+func newNode(next string) any {
+	if isIndex(next) {
+		return &[]any{}
+	}
+	return transformjson.NewObject()
+}
+
+func isIndex(token string) bool {
+	if len(token) < 3 || token[0] != '[' || token[len(token)-1] != ']' {
+		return false
+	}
+	_, err := strconv.Atoi(token[1 : len(token)-1])
+	return err == nil
+}
+
+// compact replaces the growing arrays with their elements, leaving out the elements without fields
+func compact(node any) any {
+	switch node := node.(type) {
+	case *transformjson.Object:
+		for _, key := range node.Keys() {
+			value, _ := node.Get(key)
+			node.Set(key, compact(value))
+		}
+		return node
+	case *[]any:
+		elements := []any{}
+		for _, element := range *node {
+			if element != nil {
+				elements = append(elements, compact(element))
+			}
+		}
+		return elements
+	}
+	return node
+}
@@ -0,0 +1,255 @@
+package transformconvert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/transformcsv"
+	"lazy-lagoon/transformjson"
+	"regexp"
+	"sort"
+)
+
+// Numbers of the JSON grammar, "007" or "1." stay strings
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+/*
+	Reading the records of the input data types
+*/
+// csvRecords applies the rules to the data rows and returns them as objects keyed by the header, excluded columns are left out
+// When unflattened, the dot-path headers become nested objects
+func csvRecords(byteContent []byte, settings *types.CsvDialect, rules []types.Rule, flattenSettings *types.FlattenOptions) ([]any, *types.TransformError) {
+	dialect, err := transformcsv.InputDialect(settings, byteContent)
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error()}
+	}
+	lines, err := transformcsv.ReadCsv(byteContent, dialect)
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error()}
+	}
+	header := dialect.Header(lines)
+	plan, transformErr := transformcsv.Compile(header, rules)
+	if transformErr != nil {
+		return nil, transformErr
+	}
+	if dialect.HasHeader && len(lines) > 0 {
+		lines = lines[1:]
+	}
+	records := make([]any, 0, len(lines))
+	for _, line := range lines {
+		row, excluded, transformErr := plan.ExecuteFields(line)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		if flattenSettings != nil {
+			record, err := unflatten(header, row, excluded, flattenSettings.Separator)
+			if err != nil {
+				return nil, &types.TransformError{Message: err.Error()}
+			}
+			records = append(records, record)
+			continue
+		}
+		record := transformjson.NewObject()
+		for column, key := range header {
+			if column < len(excluded) && excluded[column] {
+				continue
+			}
+			record.Set(key, inferType(row, column))
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// jsonRecords applies the rules to the document, the elements of an array are the records and any other document is a single record
+func jsonRecords(byteContent []byte, rules []types.Rule) ([]any, *types.TransformError) {
+	jsonDocument, err := transformjson.ToJson(byteContent)
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error()}
+	}
+	plan, transformErr := transformjson.Compile(rules)
+	if transformErr != nil {
+		return nil, transformErr
+	}
+	jsonDocument, transformErr = plan.Execute(jsonDocument)
+	if transformErr != nil {
+		return nil, transformErr
+	}
+	elements, isArray := jsonDocument.([]any)
+	if !isArray {
+		return []any{jsonDocument}, nil
+	}
+	records := make([]any, 0, len(elements))
+	for _, element := range elements {
+		// Excluded elements are left as empty arrays
+		if array, isArray := element.([]any); isArray && len(array) == 0 {
+			continue
+		}
+		records = append(records, element)
+	}
+	return records, nil
+}
+
+// jsonlRecords applies the rules to every line, empty lines are skipped
+func jsonlRecords(byteContent []byte, rules []types.Rule) ([]any, *types.TransformError) {
+	plan, transformErr := transformjson.Compile(rules)
+	if transformErr != nil {
+		return nil, transformErr
+	}
+	records := []any{}
+	for lineIndex, line := range bytes.Split(byteContent, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		jsonDocument, err := transformjson.ToJson(line)
+		if err != nil {
+			return nil, &types.TransformError{Message: fmt.Sprintf("error parsing JSON line %d: %v", lineIndex+1, err)}
+		}
+		jsonDocument, transformErr = plan.Execute(jsonDocument)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		records = append(records, jsonDocument)
+	}
+	return records, nil
+}
+
+/*
+	Writing the records in the output data types
+*/
+// writeJsonl writes a compact JSON document per line
+func writeJsonl(records []any) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+	for _, record := range records {
+		recordBytes, err := transformjson.FromJsonl(record)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(recordBytes)
+		buffer.WriteByte('\n')
+	}
+	return buffer.Bytes(), nil
+}
+
+// writeJson writes the records as an array, indented with tabs unless set
+func writeJson(records []any, format *types.JsonFormat) ([]byte, error) {
+	layout, err := transformjson.OutputLayout(format, nil)
+	if err != nil {
+		return nil, err
+	}
+	return transformjson.Format(records, layout)
+}
+
+// writeCsv writes a column per key, in the order the keys are first seen. Nested values are flattened, or written as compact JSON
+func writeCsv(records []any, settings *types.CsvDialect, flattenSettings *types.FlattenOptions) ([]byte, error) {
+	dialect, err := transformcsv.OutputDialect(settings, transformcsv.DefaultDialect)
+	if err != nil {
+		return nil, err
+	}
+	header := []string{}
+	columns := map[string]int{}
+	rows := make([][]field, 0, len(records))
+	for _, record := range records {
+		if flattenSettings == nil {
+			rows = append(rows, recordFields(record))
+			continue
+		}
+		recordRows, err := flatten("", record, flattenSettings)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, recordRows...)
+	}
+	for _, row := range rows {
+		for _, rowField := range row {
+			if _, exists := columns[rowField.key]; !exists {
+				columns[rowField.key] = len(header)
+				header = append(header, rowField.key)
+			}
+		}
+	}
+	lines := make([][]string, 0, len(rows)+1)
+	if dialect.HasHeader {
+		lines = append(lines, header)
+	}
+	for _, row := range rows {
+		line := make([]string, len(header))
+		for _, rowField := range row {
+			value, err := fieldString(rowField.value)
+			if err != nil {
+				return nil, err
+			}
+			line[columns[rowField.key]] = value
+		}
+		lines = append(lines, line)
+	}
+	return transformcsv.WriteCsv(lines, dialect)
+}
+
+/*
+	Helper functions
+*/
+// inferType converts the numbers to json.Number and true and false to booleans, the other fields stay strings
+func inferType(row []string, column int) any {
+	if column >= len(row) {
+		return nil
+	}
+	value := row[column]
+	switch {
+	case jsonNumber.MatchString(value):
+		return json.Number(value)
+	case value == "true":
+		return true
+	case value == "false":
+		return false
+	}
+	return value
+}
+
+// recordFields returns the fields of the record in order, a record that isn't an object is in a "value" column
+func recordFields(record any) []field {
+	switch record := record.(type) {
+	case *transformjson.Object:
+		fields := make([]field, 0, record.Len())
+		for _, key := range record.Keys() {
+			value, _ := record.Get(key)
+			fields = append(fields, field{key: key, value: value})
+		}
+		return fields
+	case map[string]any:
+		keys := make([]string, 0, len(record))
+		for key := range record {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fields := make([]field, 0, len(keys))
+		for _, key := range keys {
+			fields = append(fields, field{key: key, value: record[key]})
+		}
+		return fields
+	}
+	return []field{{key: "value", value: record}}
+}
+
+// fieldString writes the value of a CSV field, null is an empty field
+func fieldString(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		if value {
+			return "true", nil
+		}
+		return "false", nil
+	}
+	valueBytes, err := transformjson.FromJsonl(value)
+	if err != nil {
+		return "", err
+	}
+	return string(valueBytes), nil
+}
@@ -0,0 +1,121 @@
+package transformconvert
+
+import (
+	"fmt"
+	"lazy-lagoon/pkg/textencoding"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+)
+
+/*
+IsConversion reports whether the output is written in another data type than the input.
+SQL results are CSV, Arrow files and streams are the same records in two IPC formats, an empty output data type is the data type of the input.
+*/
+func IsConversion(inputType string, outputType string) bool {
+	if outputType == "" || outputType == inputType {
+		return false
+	}
+	if isArrow(inputType) && isArrow(outputType) {
+		return false
+	}
+	return !(inputType == "SQL" && outputType == "CSV")
+}
+
+func isArrow(dataType string) bool {
+	return dataType == "ARROW" || dataType == "ARROWSTREAM"
+}
+
+/*
+IsSupported reports whether the input data type can be converted into the output data type
+*/
+func IsSupported(inputType string, outputType string) bool {
+	switch inputType {
+	case "CSV", "SQL", "JSON", "JSONL":
+	default:
+		return false
+	}
+	switch outputType {
+	case "CSV", "JSON", "JSONL":
+		return true
+	}
+	return false
+}
+
+/*
+Step 1: execute transform, and store in output storage
+*/
+func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
+	if !IsSupported(input.DataType, output.DataType) {
+		return &types.TransformError{Message: fmt.Sprintf("conversion from %s to %s not supported", input.DataType, output.DataType)}
+	}
+	/*
+		Downloading the file from the input storage type, decoded to UTF-8
+	*/
+	byteContent, encoding, err := storage.GetText(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	// The output is written in the encoding of the input unless set
+	if output.Encoding != "" {
+		encoding = output.Encoding
+	}
+	/*
+		Transforming the records and writing them in the output data type
+	*/
+	byteContent, transformErr := ExecuteRules(byteContent, input, rules, output)
+	if transformErr != nil {
+		return transformErr
+	}
+	byteContent, err = textencoding.Encode(byteContent, encoding, true)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	// Store the converted bytes in the output storage type
+	err = storage.StoreBytes(output, byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	return nil
+}
+
+/*
+Step 2: Apply the rules to the records as they are in the input data type, and write the records in the output data type.
+The rules use the fields of the input: the CSV header names, or the JSON paths of a JSON document or of every JSONL line.
+*/
+func ExecuteRules(byteContent []byte, input types.Input, rules []types.Rule, output types.Output) ([]byte, *types.TransformError) {
+	flattenSettings, err := FlattenSettings(output.Flatten)
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error(), Key: "flatten"}
+	}
+	var records []any
+	var transformErr *types.TransformError
+	switch input.DataType {
+	case "CSV", "SQL":
+		records, transformErr = csvRecords(byteContent, input.Csv, rules, flattenSettings)
+	case "JSON":
+		records, transformErr = jsonRecords(byteContent, rules)
+	case "JSONL":
+		records, transformErr = jsonlRecords(byteContent, rules)
+	default:
+		return nil, &types.TransformError{Message: fmt.Sprintf("conversion from %s not supported", input.DataType)}
+	}
+	if transformErr != nil {
+		return nil, transformErr
+	}
+
+	var content []byte
+	switch output.DataType {
+	case "CSV":
+		content, err = writeCsv(records, output.Csv, flattenSettings)
+	case "JSON":
+		content, err = writeJson(records, output.Json)
+	case "JSONL":
+		content, err = writeJsonl(records)
+	default:
+		return nil, &types.TransformError{Message: fmt.Sprintf("conversion to %s not supported", output.DataType)}
+	}
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
+	return content, nil
+}
@@ -0,0 +1,99 @@
+package transformconvert
+
+import (
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestExecuteRules(t *testing.T) {
+	t.Run("CSV to JSONL with types inferred", func(t *testing.T) {
+		content := []byte("id,name,code,active,amount\n1,Ada,007,true,12.50\n2,Grace,010,false,\n")
+		rules := []types.Rule{{Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "code"}}}}
+		converted, transformErr := ExecuteRules(content, types.Input{DataType: "CSV"}, rules, types.Output{DataType: "JSONL"})
+		if transformErr != nil {
+			t.Fatalf("Failed to convert: %v", transformErr.Message)
+		}
+		assert.Equal(t, string(converted), `{"id":1,"name":"Ada","active":true,"amount":12.50}`+"\n"+`{"id":2,"name":"Grace","active":false,"amount":""}`+"\n")
+	})
+
+	t.Run("JSONL to CSV with the keys in the order they are seen", func(t *testing.T) {
+		content := []byte(`{"name":"Ada","id":1}` + "\n\n" + `{"id":2,"name":"Grace","tags":["a","b"],"manager":null}` + "\n")
+		rules := []types.Rule{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "name"}}}}
+		converted, transformErr := ExecuteRules(content, types.Input{DataType: "JSONL"}, rules, types.Output{DataType: "CSV", Csv: &types.CsvDialect{Delimiter: ";"}})
+		if transformErr != nil {
+			t.Fatalf("Failed to convert: %v", transformErr.Message)
+		}
+		assert.Equal(t, string(converted), "name;id;tags;manager\n**redacted**;1;;\n**redacted**;2;\"[\"\"a\"\",\"\"b\"\"]\";\n")
+	})
+
+	t.Run("JSON array to JSONL and back", func(t *testing.T) {
+		content := []byte(`[{"id":1,"type":"PAYMENT"},{"id":2,"type":"REFUND"}]`)
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions:     []types.Expressions{{FieldName: "[*].type", Operator: "EQ", Value: "REFUND"}},
+			},
+			Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "[*]"}},
+		}}
+		converted, transformErr := ExecuteRules(content, types.Input{DataType: "JSON"}, rules, types.Output{DataType: "JSONL"})
+		if transformErr != nil {
+			t.Fatalf("Failed to convert: %v", transformErr.Message)
+		}
+		assert.Equal(t, string(converted), `{"id":1,"type":"PAYMENT"}`+"\n")
+
+		converted, transformErr = ExecuteRules(converted, types.Input{DataType: "JSONL"}, nil, types.Output{DataType: "JSON"})
+		if transformErr != nil {
+			t.Fatalf("Failed to convert: %v", transformErr.Message)
+		}
+		assert.Equal(t, string(converted), "[\n\t{\n\t\t\"id\": 1,\n\t\t\"type\": \"PAYMENT\"\n\t}\n]")
+	})
+
+	t.Run("unsupported conversions", func(t *testing.T) {
+		assert.Equal(t, IsConversion("SQL", "CSV"), false)
+		assert.Equal(t, IsConversion("JSON", ""), false)
+		assert.Equal(t, IsConversion("SQL", "JSONL"), true)
+		assert.Equal(t, IsSupported("SQL", "JSONL"), true)
+		assert.Equal(t, IsSupported("PARQUET", "CSV"), false)
+		assert.Equal(t, IsSupported("CSV", "XLSX"), false)
+
+		_, transformErr := ExecuteRules([]byte("{"), types.Input{DataType: "JSONL"}, nil, types.Output{DataType: "CSV"})
+		assert.NotEqual(t, transformErr, nil)
+	})
+}
+
+func TestFlatten(t *testing.T) {
+	content := []byte(`{"id":1,"customer":{"name":"Ada"},"items":[{"sku":"A","qty":2},{"sku":"B"}],"tags":["new","vip"]}` + "\n")
+	convert := func(arrays string) string {
+		output := types.Output{DataType: "CSV", Flatten: &types.FlattenOptions{Arrays: arrays}}
+		converted, transformErr := ExecuteRules(content, types.Input{DataType: "JSONL"}, nil, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to flatten: %v", transformErr.Message)
+		}
+		return string(converted)
+	}
+
+	t.Run("arrays indexed, joined or exploded", func(t *testing.T) {
+		assert.Equal(t, convert(""), "id,customer.name,items[0].sku,items[0].qty,items[1].sku,tags[0],tags[1]\n1,Ada,A,2,B,new,vip\n")
+		assert.Equal(t, convert("join"), "id,customer.name,items[*].sku,items[*].qty,tags[*]\n1,Ada,A|B,2|,new|vip\n")
+		assert.Equal(t, convert("EXPLODE"), "id,customer.name,items[*].sku,items[*].qty,tags[*]\n1,Ada,A,2,new\n1,Ada,A,2,vip\n1,Ada,B,,new\n1,Ada,B,,vip\n")
+
+		_, transformErr := ExecuteRules(content, types.Input{DataType: "JSONL"}, nil, types.Output{DataType: "CSV", Flatten: &types.FlattenOptions{Arrays: "NEST"}})
+		assert.NotEqual(t, transformErr, nil)
+	})
+
+	t.Run("dot-path headers unflattened", func(t *testing.T) {
+		csv := []byte("id,customer.name,items[0].sku,items[1].sku,items[2].sku,tags[*]\n1,Ada,A,,B,new|vip\n")
+		output := types.Output{DataType: "JSONL", Flatten: &types.FlattenOptions{}}
+		converted, transformErr := ExecuteRules(csv, types.Input{DataType: "CSV"}, nil, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to unflatten: %v", transformErr.Message)
+		}
+		assert.Equal(t, string(converted), `{"id":1,"customer":{"name":"Ada"},"items":[{"sku":"A"},{"sku":"B"}],"tags":["new","vip"]}`+"\n")
+
+		_, transformErr = ExecuteRules([]byte("a,a.b\n1,2\n"), types.Input{DataType: "CSV"}, nil, output)
+		assert.NotEqual(t, transformErr, nil)
+	})
+}
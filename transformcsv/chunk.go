@@ -1,90 +1,79 @@
 package transformcsv
 
 import (
-	"bytes"
 	"fmt"
-	"os"
-
-	splitCsv "github.com/tolik505/split-csv"
+	"io"
 )
 
+// Bytes of rows per chunk, the chunks are transformed concurrently
+const chunkSize = 10 * 1024 * 1024 // 10MB in bytes
+
 /*
-	Chunk the content into multiple smaller chunks
+Chunks are the rows of the CSV content split into chunks of whole records, with the header read once for all of them
 */
-func Chunk(content []byte) ([][]byte, error) {
-	var chunks [][]byte
-	// default batch size of 10MB
-	batchSize := 10*1024*1024
-
-	// If the content is smaller than the batch size, return the content as a single chunk
-	if len(content) < batchSize {
-		return [][]byte{content}, nil
-	}
+type Chunks struct {
+	// The header row, the column positions of the widest row when the content has no header
+	Header []string
+	// The content of the rows after the header, every chunk ends at the end of a record. There is always at least one chunk
+	Rows [][]byte
+}
 
-	file, err := StoreTemp(content, "tempfile")
-	if err != nil {
-		return nil, err
-	}
-	// Closing and removing the file after the function is finished (including if the function errors)
-	defer file.Close()
-	defer os.Remove(file.Name())
-	
-	chunkedFiles, err := ChunkFiles(file.Name(), "./csvDownloads/", batchSize)
+/*
+Chunk splits the content into chunks of about size bytes. The records are read with the dialect, so a line break in a quoted field
+never splits a record, and the header row is left out of the chunks
+*/
+func Chunk(content []byte, dialect Dialect, size int) (Chunks, error) {
+	chunks := Chunks{Header: []string{}}
+	width := 0
+	start := 0
+	isHeader := dialect.HasHeader
+	err := readRecords(content, dialect, func(record []string, end int) {
+		if isHeader {
+			chunks.Header = append([]string{}, record...)
+			isHeader = false
+			start = end
+			return
+		}
+		width = max(width, len(record))
+		if end-start >= size {
+			chunks.Rows = append(chunks.Rows, content[start:end])
+			start = end
+		}
+	})
 	if err != nil {
-		return nil, err
+		return Chunks{}, err
 	}
-	// Checking if the chunks are empty
-	if len(chunkedFiles) == 0 {
-		return [][]byte{}, fmt.Errorf("Length of chunked files is 0")
+	if start < len(content) || len(chunks.Rows) == 0 {
+		chunks.Rows = append(chunks.Rows, content[start:])
 	}
-
-	// Looping through the chunkedFiles
-	for _, chunkedFile := range chunkedFiles {
-		// Remove file after the loop is finished
-		defer os.Remove(chunkedFile)
-		// Reading the chunk
-		chunk, err := os.ReadFile(chunkedFile)
-		if err != nil {
-			return nil, err
-		}
-
-		chunks = append(chunks, chunk)
+	if !dialect.HasHeader {
+		chunks.Header = dialect.Header([][]string{make([]string, width)})
 	}
-
 	return chunks, nil
 }
 
 /*
-	Chunk the file into multiple smaller file
+	Helper functions
 */
-func ChunkFiles(filePath string, fileDir string, size int) ([]string, error) {
-	splitter := splitCsv.New()
-	splitter.Separator = ";"
-	splitter.FileChunkSize = size
-	result, err := splitter.Split(filePath, fileDir)
-	return result, err
-}
-
-/*
-	Combine the files into a single file
-*/
-func CombineFiles(file string, combineFile string) error {
-	files := []string{file, combineFile}
-
-	var buf bytes.Buffer
-	for _, file := range files {
-		b, err := os.ReadFile(file)
-		if err != nil {
-			return err
+// readRecords reads every record of the content, end is the offset after the record and its line break
+func readRecords(content []byte, dialect Dialect, onRecord func(record []string, end int)) error {
+	if !dialect.isStandard() {
+		reader := &recordReader{content: content, dialect: dialect}
+		for record := reader.read(); record != nil; record = reader.read() {
+			onRecord(record, reader.position)
 		}
-
-		buf.Write(b)
+		return nil
 	}
-
-	err := os.WriteFile(combineFile, buf.Bytes(), 0644)
-	if err != nil {
-		return err
+	reader := newStandardReader(content, dialect)
+	reader.ReuseRecord = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not decode your input, please upload a new csv file")
+		}
+		onRecord(record, int(reader.InputOffset()))
 	}
-
-	return nil
 }
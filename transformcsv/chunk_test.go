@@ -0,0 +1,74 @@
+package transformcsv
+
+import (
+	"bytes"
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestChunk(t *testing.T) {
+	content := []byte("id,note\n1,\"line one\nline two\"\n2,plain\n3,\"a, \"\"quoted\"\" b\"\n4,last\n")
+
+	t.Run("chunks end at the end of a record", func(t *testing.T) {
+		// Every record is larger than the chunk size, the quoted line break stays in its record
+		chunks, err := Chunk(content, DefaultDialect, 1)
+		if err != nil {
+			t.Fatalf("Failed to chunk csv: %v", err)
+		}
+		assert.Equal(t, chunks.Header, []string{"id", "note"})
+		assert.Equal(t, len(chunks.Rows), 4)
+		assert.Equal(t, string(chunks.Rows[0]), "1,\"line one\nline two\"\n")
+		assert.Equal(t, bytes.Join(chunks.Rows, nil), content[len("id,note\n"):])
+	})
+
+	t.Run("every chunk is transformed with the header", func(t *testing.T) {
+		chunks, err := Chunk(content, DefaultDialect, 20)
+		if err != nil {
+			t.Fatalf("Failed to chunk csv: %v", err)
+		}
+		assert.Equal(t, len(chunks.Rows) > 1, true)
+		plan, transformErr := Compile(chunks.Header, []types.Rule{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "note"}}}})
+		if transformErr != nil {
+			t.Fatalf("Failed to compile rules: %v", transformErr.Message)
+		}
+		var notes []string
+		for _, chunk := range chunks.Rows {
+			lines, err := ReadCsv(chunk, DefaultDialect)
+			if err != nil {
+				t.Fatalf("Failed to read chunk: %v", err)
+			}
+			lines, transformErr = plan.ExecuteRows(lines)
+			if transformErr != nil {
+				t.Fatalf("Failed to transform chunk: %v", transformErr.Message)
+			}
+			for _, line := range lines {
+				notes = append(notes, line[1])
+			}
+		}
+		assert.Equal(t, notes, []string{"**redacted**", "**redacted**", "**redacted**", "**redacted**"})
+	})
+
+	t.Run("escaped quotes and files without a header", func(t *testing.T) {
+		dialect := Dialect{Delimiter: ';', Quote: '\'', Escape: '\\', HasHeader: false}
+		chunks, err := Chunk([]byte("1;'it\\'s;\nnot the end'\n2;b;extra\n"), dialect, 1)
+		if err != nil {
+			t.Fatalf("Failed to chunk csv: %v", err)
+		}
+		assert.Equal(t, chunks.Header, []string{"1", "2", "3"})
+		assert.Equal(t, len(chunks.Rows), 2)
+		assert.Equal(t, string(chunks.Rows[1]), "2;b;extra\n")
+	})
+
+	t.Run("header only", func(t *testing.T) {
+		chunks, err := Chunk([]byte("id,note\n"), DefaultDialect, 1)
+		if err != nil {
+			t.Fatalf("Failed to chunk csv: %v", err)
+		}
+		assert.Equal(t, chunks.Header, []string{"id", "note"})
+		assert.Equal(t, len(chunks.Rows), 1)
+		assert.Equal(t, len(chunks.Rows[0]), 0)
+	})
+}
@@ -0,0 +1,221 @@
+package transformcsv
+
+import (
+	"bytes"
+	"fmt"
+	"lazy-lagoon/pkg/types"
+	"strconv"
+	"unicode/utf8"
+)
+
+/*
+Dialect is how the fields and rows of a CSV file are delimited, resolved from the dialect settings of the request
+*/
+type Dialect struct {
+	Delimiter rune
+	Quote     rune
+	// 0 when quotes are escaped by doubling them
+	Escape    rune
+	HasHeader bool
+	UseCRLF   bool
+}
+
+// DefaultDialect is a comma separated file with a header row and double quotes
+var DefaultDialect = Dialect{Delimiter: ',', Quote: '"', HasHeader: true}
+
+// Delimiters tried when sniffing, in order of preference when several fit
+var sniffedDelimiters = []rune{',', ';', '\t', '|'}
+
+const (
+	// Number of lines and bytes looked at when sniffing
+	sniffLines = 20
+	sniffBytes = 64 * 1024
+)
+
+/*
+InputDialect resolves the dialect of the input, the delimiter and line terminator are sniffed from the content when not set
+*/
+func InputDialect(settings *types.CsvDialect, content []byte) (Dialect, error) {
+	dialect := DefaultDialect
+	if settings == nil {
+		settings = &types.CsvDialect{}
+	}
+	err := applySettings(&dialect, settings)
+	if err != nil {
+		return Dialect{}, err
+	}
+	if settings.Delimiter == "" {
+		dialect.Delimiter = sniffDelimiter(content, dialect.Quote, dialect.Escape)
+	}
+	if settings.LineTerminator == "" {
+		firstLine, _, _ := bytes.Cut(content, []byte("\n"))
+		dialect.UseCRLF = bytes.HasSuffix(firstLine, []byte("\r"))
+	}
+	return dialect, nil
+}
+
+/*
+OutputDialect resolves the dialect of the output, the settings that aren't set are the ones of the input
+*/
+func OutputDialect(settings *types.CsvDialect, input Dialect) (Dialect, error) {
+	dialect := input
+	if settings == nil {
+		return dialect, nil
+	}
+	err := applySettings(&dialect, settings)
+	if err != nil {
+		return Dialect{}, err
+	}
+	return dialect, nil
+}
+
+/*
+Header returns the header row, or the positions of the columns ("1", "2", ...) of the widest row when the file has no header
+*/
+func (dialect Dialect) Header(lines [][]string) []string {
+	if dialect.HasHeader {
+		if len(lines) == 0 {
+			return []string{}
+		}
+		return lines[0]
+	}
+	width := 0
+	for _, line := range lines {
+		width = max(width, len(line))
+	}
+	header := make([]string, width)
+	for column := range header {
+		header[column] = strconv.Itoa(column + 1)
+	}
+	return header
+}
+
+// isStandard is true when encoding/csv can read and write the dialect
+func (dialect Dialect) isStandard() bool {
+	return dialect.Quote == '"' && dialect.Escape == 0
+}
+
+/*
+	Helper functions
+*/
+func applySettings(dialect *Dialect, settings *types.CsvDialect) error {
+	var err error
+	if settings.Delimiter != "" {
+		dialect.Delimiter, err = character("delimiter", settings.Delimiter)
+		if err != nil {
+			return err
+		}
+	}
+	if settings.Quote != "" {
+		dialect.Quote, err = character("quote", settings.Quote)
+		if err != nil {
+			return err
+		}
+	}
+	if settings.Escape != "" {
+		dialect.Escape, err = character("escape", settings.Escape)
+		if err != nil {
+			return err
+		}
+		if dialect.Escape == dialect.Quote {
+			// Escaping a quote with a quote is doubling it
+			dialect.Escape = 0
+		}
+	}
+	if settings.HasHeader != nil {
+		dialect.HasHeader = *settings.HasHeader
+	}
+	switch settings.LineTerminator {
+	case "":
+	case "CRLF":
+		dialect.UseCRLF = true
+	case "LF":
+		dialect.UseCRLF = false
+	default:
+		return fmt.Errorf("csv line terminator %s not found, use CRLF or LF", settings.LineTerminator)
+	}
+	if dialect.Delimiter == dialect.Quote || (dialect.Escape != 0 && dialect.Delimiter == dialect.Escape) {
+		return fmt.Errorf("csv delimiter %q can't be the quote or escape character", dialect.Delimiter)
+	}
+	return nil
+}
+
+// character returns the single character of the setting, "\t" can be given escaped
+func character(name string, value string) (rune, error) {
+	if value == `\t` {
+		return '\t', nil
+	}
+	character, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || character == utf8.RuneError || character == '\r' || character == '\n' {
+		return 0, fmt.Errorf("csv %s %q must be a single character", name, value)
+	}
+	return character, nil
+}
+
+/*
+sniffDelimiter counts the candidate delimiters outside quotes in the first lines.
+The delimiter found the same number of times on every line wins (the most often when several are), then the most frequent one of the first line.
+*/
+func sniffDelimiter(content []byte, quote rune, escape rune) rune {
+	// The last line is cut when the content is
+	truncated := len(content) > sniffBytes
+	if truncated {
+		content = content[:sniffBytes]
+	}
+	var counts []map[rune]int
+	line := map[rune]int{}
+	quoted := false
+	escaped := false
+	for _, character := range string(content) {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && escape != 0 && character == escape:
+			escaped = true
+		case character == quote:
+			quoted = !quoted
+		case !quoted && character == '\n':
+			if len(line) > 0 {
+				counts = append(counts, line)
+			}
+			line = map[rune]int{}
+		case !quoted:
+			line[character]++
+		}
+		if len(counts) == sniffLines {
+			break
+		}
+	}
+	if len(line) > 0 && len(counts) < sniffLines && (!truncated || len(counts) == 0) {
+		counts = append(counts, line)
+	}
+	if len(counts) == 0 {
+		return DefaultDialect.Delimiter
+	}
+
+	best, bestCount := rune(0), 0
+	for _, delimiter := range sniffedDelimiters {
+		count := counts[0][delimiter]
+		for _, lineCounts := range counts[1:] {
+			if lineCounts[delimiter] != count {
+				count = 0
+				break
+			}
+		}
+		if count > bestCount {
+			best, bestCount = delimiter, count
+		}
+	}
+	if best != 0 {
+		return best
+	}
+	for _, delimiter := range sniffedDelimiters {
+		if counts[0][delimiter] > bestCount {
+			best, bestCount = delimiter, counts[0][delimiter]
+		}
+	}
+	if best != 0 {
+		return best
+	}
+	return DefaultDialect.Delimiter
+}
@@ -0,0 +1,97 @@
+package transformcsv
+
+import (
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestDialect(t *testing.T) {
+	t.Run("delimiter sniffed from the first lines", func(t *testing.T) {
+		cases := map[string]rune{
+			"name;city;note\nAda;London;\"a, b\"\nBob;Paris;c\n": ';',
+			"name\tcity\nAda\tLondon\n":                          '\t',
+			"name|city\r\nAda|London\r\n":                        '|',
+			"name,city\nAda,London\n":                            ',',
+			"name\nAda\n":                                        ',',
+		}
+		for content, delimiter := range cases {
+			dialect, err := InputDialect(nil, []byte(content))
+			if err != nil {
+				t.Fatalf("Failed to resolve dialect: %v", err)
+			}
+			assert.Equal(t, dialect.Delimiter, delimiter)
+		}
+
+		dialect, _ := InputDialect(nil, []byte("name|city\r\nAda|London\r\n"))
+		assert.Equal(t, dialect.UseCRLF, true)
+	})
+
+	t.Run("settings override the sniffed dialect", func(t *testing.T) {
+		_, err := InputDialect(&types.CsvDialect{Delimiter: ";;"}, []byte("a,b\n"))
+		assert.NotEqual(t, err, nil)
+		_, err = InputDialect(&types.CsvDialect{LineTerminator: "CR"}, []byte("a,b\n"))
+		assert.NotEqual(t, err, nil)
+
+		dialect, err := InputDialect(&types.CsvDialect{Delimiter: `\t`}, []byte("a,b\n"))
+		if err != nil {
+			t.Fatalf("Failed to resolve dialect: %v", err)
+		}
+		assert.Equal(t, dialect.Delimiter, '\t')
+
+		// The output keeps what it doesn't set from the input
+		output, err := OutputDialect(&types.CsvDialect{LineTerminator: "CRLF"}, dialect)
+		if err != nil {
+			t.Fatalf("Failed to resolve dialect: %v", err)
+		}
+		assert.Equal(t, output, Dialect{Delimiter: '\t', Quote: '"', HasHeader: true, UseCRLF: true})
+	})
+
+	t.Run("custom quote and escape characters", func(t *testing.T) {
+		dialect, err := InputDialect(&types.CsvDialect{Quote: "'", Escape: `\`}, []byte("name;note\n'Ada';'it\\'s; fine'\nBob; 'x'\n"))
+		if err != nil {
+			t.Fatalf("Failed to resolve dialect: %v", err)
+		}
+		assert.Equal(t, dialect.Delimiter, ';')
+		lines, err := ReadCsv([]byte("name;note\n'Ada';'it\\'s; fine'\n\nBob; 'x'y'\n"), dialect)
+		if err != nil {
+			t.Fatalf("Failed to read csv: %v", err)
+		}
+		assert.Equal(t, lines, [][]string{{"name", "note"}, {"Ada", "it's; fine"}, {"Bob", "x'y"}})
+
+		content, err := WriteCsv(lines, dialect)
+		if err != nil {
+			t.Fatalf("Failed to write csv: %v", err)
+		}
+		assert.Equal(t, string(content), "name;note\nAda;'it\\'s; fine'\nBob;'x\\'y'\n")
+	})
+
+	t.Run("files without a header are addressed by position", func(t *testing.T) {
+		hasHeader := false
+		content := []byte("Ada,ada@example.com\nBob,bob@example.com,VIP\n")
+		dialect, err := InputDialect(&types.CsvDialect{HasHeader: &hasHeader}, content)
+		if err != nil {
+			t.Fatalf("Failed to resolve dialect: %v", err)
+		}
+		header, err := ReadHeader(content, dialect)
+		if err != nil {
+			t.Fatalf("Failed to read header: %v", err)
+		}
+		assert.Equal(t, header, []string{"1", "2", "3"})
+
+		plan, transformErr := Compile(header, []types.Rule{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "2"}}}})
+		if transformErr != nil {
+			t.Fatalf("Failed to compile rules: %v", transformErr)
+		}
+		lines, _ := ReadCsv(content, dialect)
+		lines, transformErr = plan.ExecuteRows(lines)
+		if transformErr != nil {
+			t.Fatalf("Failed to execute rules: %v", transformErr)
+		}
+		dialect.UseCRLF = true
+		output, _ := WriteCsv(lines, dialect)
+		assert.Equal(t, string(output), "Ada,**redacted**\r\nBob,**redacted**,VIP\r\n")
+	})
+}
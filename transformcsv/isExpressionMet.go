@@ -3,36 +3,29 @@ package transformcsv
 import (
 	"lazy-lagoon/pkg/expressions"
 	"lazy-lagoon/pkg/types"
-	"slices"
 )
 
 /*
-	IsExpressionMet checks if the given expression is met
+	IsMet checks if the compiled expression is met for the given (unmutated) row
 */
-func IsExpressionMet(expression types.Expression, lines [][]string, index int, ruleIndex int) (bool, *types.TransformError) {
+func (expression compiledExpression) IsMet(row []string, ruleIndex int) (bool, *types.TransformError) {
 	expressionMet := false
-	if expression.Expressions == nil {
+	if expression.always {
 		return true, nil
 	}
-	for expressionIndex, exp := range expression.Expressions {
+	for _, condition := range expression.conditions {
 		// Checking to see if the expression is met
-		expressionColumn := slices.Index(lines[0], exp.FieldName)
-		if expressionColumn == -1 {
+		if condition.column == -1 {
 			// Column not found but considering it a no op
 			return false, nil
 		}
-		if expressionColumn >= len(lines[0]) {
-			// expression header is out of range
-			return false, &types.TransformError{
-				Message: "expression header is out of range",
-				RuleIndex: &ruleIndex,
-				ExpressionIndex: &expressionIndex,
-				Key: "fieldName",
-			}
+		value := ""
+		if condition.column < len(row) {
+			value = row[condition.column]
 		}
-		// Dealing with logical operators
-		met, err := expressions.IsOperatorResultMet(exp.Operator, exp.Value, lines[index][expressionColumn])
+		met, err := expressions.IsOperatorResultMet(condition.Operator, condition.Value, value)
 		if err != nil {
+			expressionIndex := condition.expressionIndex
 			return false, &types.TransformError{
 				Message: err.Error(),
 				RuleIndex: &ruleIndex,
@@ -43,7 +36,7 @@ func IsExpressionMet(expression types.Expression, lines [][]string, index int, r
 		// Dealing with logical operators
 		if met {
 			// If the logical operator is or then return true
-			if expression.LogicalOperator == "OR" {
+			if expression.logicalOperator == "OR" {
 				return true, nil
 			} else {
 				// If the logical operator is and then set the expressionMet to true (we have to check all expressions are met)
@@ -51,7 +44,7 @@ func IsExpressionMet(expression types.Expression, lines [][]string, index int, r
 			}
 		} else {
 			// If the logical operator is and then return false
-			if expression.LogicalOperator == "AND" {
+			if expression.logicalOperator == "AND" {
 				return false, nil
 			}
 		}
@@ -0,0 +1,275 @@
+package transformcsv
+
+import (
+	"lazy-lagoon/pkg/expressions"
+	"lazy-lagoon/pkg/types"
+	"slices"
+	"sort"
+)
+
+/*
+Plan holds the rules compiled against the CSV header. Column indexes are resolved and operators validated
+once per request, so every row is evaluated against all the rules in a single pass.
+*/
+type Plan struct {
+	rules []compiledRule
+	// Columns of the header excluded from every row, they are removed from the header and the rows
+	removed []bool
+}
+
+type compiledRule struct {
+	ruleIndex      int
+	priority       int
+	stopProcessing bool
+	expression     compiledExpression
+	actions        []compiledAction
+	elseActions    []compiledAction
+}
+
+type compiledAction struct {
+	actionIndex int
+	actionType  string
+	column      int
+}
+
+type compiledExpression struct {
+	// Rules without expressions are applied to every row
+	always          bool
+	logicalOperator string
+	conditions      []compiledCondition
+}
+
+type compiledCondition struct {
+	expressionIndex int
+	// -1 when the column is not in the header, the expression is then considered not met (no op)
+	column int
+	types.Expressions
+}
+
+/*
+Compile resolves the rules against the header row and orders them by priority
+*/
+func Compile(header []string, rules []types.Rule) (*Plan, *types.TransformError) {
+	plan := &Plan{}
+	for ruleIndex, rule := range rules {
+		expression, transformErr := compileExpression(header, rule.Expression, ruleIndex)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		actions, transformErr := compileActions(header, rule.Actions, ruleIndex, false)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		elseActions, transformErr := compileActions(header, rule.ElseActions, ruleIndex, true)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		plan.rules = append(plan.rules, compiledRule{
+			ruleIndex:      ruleIndex,
+			priority:       rule.Priority,
+			stopProcessing: rule.StopProcessing,
+			expression:     expression,
+			actions:        actions,
+			elseActions:    elseActions,
+		})
+	}
+	// Higher priorities run first, the same priority keeps the request order
+	sort.SliceStable(plan.rules, func(i, j int) bool {
+		return plan.rules[i].priority > plan.rules[j].priority
+	})
+	plan.removed = removedColumns(header, plan.rules)
+	return plan, nil
+}
+
+// removedColumns are the columns excluded by the rules without expressions, up to the first rule that can stop the processing of a row
+func removedColumns(header []string, rules []compiledRule) []bool {
+	removed := make([]bool, len(header))
+	for _, rule := range rules {
+		if rule.expression.always {
+			for _, action := range rule.actions {
+				if action.actionType == "EXCLUDE" {
+					removed[action.column] = true
+				}
+			}
+		}
+		if rule.stopProcessing {
+			break
+		}
+	}
+	return removed
+}
+
+// compileActions resolves the action columns, else actions report their index as elseActionIndex
+func compileActions(header []string, actions []types.Action, ruleIndex int, isElse bool) ([]compiledAction, *types.TransformError) {
+	var compiled []compiledAction
+	for actionIndex, action := range actions {
+		if action.FieldName == "" {
+			// No op if the field name is empty
+			continue
+		}
+		column := slices.Index(header, action.FieldName)
+		if column < 0 {
+			transformErr := &types.TransformError{
+				Message:   "column not found",
+				RuleIndex: &ruleIndex,
+				Key:       "fieldName",
+			}
+			if isElse {
+				transformErr.ElseActionIndex = &actionIndex
+			} else {
+				transformErr.ActionIndex = &actionIndex
+			}
+			return nil, transformErr
+		}
+		compiled = append(compiled, compiledAction{
+			actionIndex: actionIndex,
+			actionType:  action.ActionType,
+			column:      column,
+		})
+	}
+	return compiled, nil
+}
+
+// compileExpression resolves the expression columns and validates the operators
+func compileExpression(header []string, expression types.Expression, ruleIndex int) (compiledExpression, *types.TransformError) {
+	if expression.Expressions == nil {
+		return compiledExpression{always: true}, nil
+	}
+	compiled := compiledExpression{logicalOperator: expression.LogicalOperator}
+	for expressionIndex, exp := range expression.Expressions {
+		if !expressions.IsValidOperator(exp.Operator) {
+			return compiledExpression{}, &types.TransformError{
+				Message:         "invalid operator: " + exp.Operator,
+				RuleIndex:       &ruleIndex,
+				ExpressionIndex: &expressionIndex,
+				Key:             "operator",
+			}
+		}
+		compiled.conditions = append(compiled.conditions, compiledCondition{
+			expressionIndex: expressionIndex,
+			column:          slices.Index(header, exp.FieldName),
+			Expressions:     exp,
+		})
+	}
+	return compiled, nil
+}
+
+/*
+Header returns the header without the columns excluded from every row, the header of the rows returned by ExecuteRow
+*/
+func (plan *Plan) Header(header []string) []string {
+	return plan.removeColumns(append([]string{}, header...))
+}
+
+/*
+Execute applies the plan to every row after the header, mutating the lines in place
+*/
+func (plan *Plan) Execute(lines [][]string) ([][]string, *types.TransformError) {
+	if len(lines) > 0 {
+		lines[0] = plan.Header(lines[0])
+	}
+	for index := 1; index < len(lines); index++ {
+		row, transformErr := plan.ExecuteRow(lines[index])
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		lines[index] = row
+	}
+	return lines, nil
+}
+
+/*
+ExecuteRows applies the plan to every row, for the files without a header row
+*/
+func (plan *Plan) ExecuteRows(lines [][]string) ([][]string, *types.TransformError) {
+	for index := range lines {
+		row, transformErr := plan.ExecuteRow(lines[index])
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		lines[index] = row
+	}
+	return lines, nil
+}
+
+/*
+ExecuteRow applies the rules to a single row, the actions when the expression is met and the else actions when it isn't.
+Expressions are evaluated against the row as it was before any action was applied.
+The columns excluded from every row are removed so the row keeps the columns of Header, the other excluded cells are emptied.
+*/
+func (plan *Plan) ExecuteRow(row []string) ([]string, *types.TransformError) {
+	row, transformErr := plan.execute(row, nil)
+	if transformErr != nil {
+		return nil, transformErr
+	}
+	return plan.removeColumns(row), nil
+}
+
+/*
+ExecuteFields applies the rules to a single row like ExecuteRow, but the excluded columns are returned instead of removed
+so the row keeps the columns of the header - used to convert the rows into other data types
+*/
+func (plan *Plan) ExecuteFields(row []string) ([]string, []bool, *types.TransformError) {
+	excluded := make([]bool, len(row))
+	row, transformErr := plan.execute(row, excluded)
+	return row, excluded, transformErr
+}
+
+func (plan *Plan) execute(row []string, excluded []bool) ([]string, *types.TransformError) {
+	original := make([]string, len(row))
+	copy(original, row)
+
+	for _, rule := range plan.rules {
+		if len(rule.actions) == 0 && len(rule.elseActions) == 0 && !rule.stopProcessing {
+			continue
+		}
+		met, transformErr := rule.expression.IsMet(original, rule.ruleIndex)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		if met {
+			row = applyActions(row, rule.actions, excluded)
+			if rule.stopProcessing {
+				// No other rule is applied to this row
+				break
+			}
+		} else {
+			row = applyActions(row, rule.elseActions, excluded)
+		}
+	}
+	return row, nil
+}
+
+// removeColumns removes the columns excluded from every row, the cells after the header are kept
+func (plan *Plan) removeColumns(row []string) []string {
+	kept := row[:0]
+	for column, value := range row {
+		if column >= len(plan.removed) || !plan.removed[column] {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
+
+// applyActions redacts or excludes the action columns of the row, excluded columns are marked instead of emptied when excluded is set
+func applyActions(row []string, actions []compiledAction, excluded []bool) []string {
+	for _, action := range actions {
+		if action.column >= len(row) {
+			// If the column is out of range then skip the row
+			continue
+		}
+		// Applying the operation
+		if action.actionType == "REDACT" {
+			// Redact the column
+			if row[action.column] != "" {
+				row[action.column] = "**redacted**"
+			}
+		} else if excluded != nil {
+			excluded[action.column] = true
+		} else {
+			// Empty the cell so the row keeps its columns, the columns excluded from every row are removed afterwards
+			row[action.column] = ""
+		}
+	}
+	return row
+}
@@ -0,0 +1,195 @@
+package transformcsv
+
+import (
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestCompile(t *testing.T) {
+	header := []string{"id", "type", "amount"}
+
+	t.Run("column not found", func(t *testing.T) {
+		rules := []types.Rule{{
+			Actions: []types.Action{
+				{ActionType: "REDACT", FieldName: "amount"},
+				{ActionType: "REDACT", FieldName: "missing"},
+			},
+		}}
+		_, err := Compile(header, rules)
+		assert.NotEqual(t, err, nil)
+		assert.Equal(t, *err.ActionIndex, 1)
+		assert.Equal(t, err.Key, "fieldName")
+	})
+
+	t.Run("invalid operator", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions: []types.Expressions{
+					{FieldName: "type", Operator: "LIKE", Value: "PAY"},
+				},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "amount"}},
+		}}
+		_, err := Compile(header, rules)
+		assert.NotEqual(t, err, nil)
+		assert.Equal(t, *err.ExpressionIndex, 0)
+		assert.Equal(t, err.Key, "operator")
+	})
+
+	t.Run("single pass over every rule", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions: []types.Expressions{
+						{FieldName: "type", Operator: "EQ", Value: "PAYMENT"},
+					},
+				},
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "amount"}},
+			},
+			{
+				// Expressions are evaluated against the row before the first rule redacted it
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions: []types.Expressions{
+						{FieldName: "amount", Operator: "GT", Value: 100},
+					},
+				},
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "id"}},
+			},
+		}
+		plan, err := Compile(header, rules)
+		if err != nil {
+			t.Fatalf("Failed to compile rules: %v", err)
+		}
+		lines := [][]string{
+			header,
+			{"1", "PAYMENT", "150.5"},
+			{"2", "TRANSFER", "20"},
+			{"3", "PAYMENT", "5"},
+		}
+		mutated, err := plan.Execute(lines)
+		if err != nil {
+			t.Fatalf("Failed to execute plan: %v", err)
+		}
+		assert.Equal(t, mutated, [][]string{
+			header,
+			{"**redacted**", "PAYMENT", "**redacted**"},
+			{"2", "TRANSFER", "20"},
+			{"3", "PAYMENT", "**redacted**"},
+		})
+	})
+
+	t.Run("rules do not mutate the original lines", func(t *testing.T) {
+		lines := [][]string{header, {"1", "PAYMENT", "150.5"}}
+		rules := []types.Rule{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "amount"}}}}
+		_, err := ExecuteRules(lines, rules)
+		if err != nil {
+			t.Fatalf("Failed to execute rules: %v", err)
+		}
+		assert.Equal(t, lines[1][2], "150.5")
+	})
+
+	t.Run("else actions, priorities and stop processing", func(t *testing.T) {
+		internal := types.Expression{
+			LogicalOperator: "AND",
+			Expressions: []types.Expressions{
+				{FieldName: "type", Operator: "EQ", Value: "INTERNAL"},
+			},
+		}
+		rules := []types.Rule{
+			{
+				// Runs last, skipped for internal rows
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "id"}},
+			},
+			{
+				Expression:     internal,
+				Actions:        []types.Action{{ActionType: "REDACT", FieldName: "amount"}},
+				ElseActions:    []types.Action{{ActionType: "REDACT", FieldName: "type"}},
+				Priority:       10,
+				StopProcessing: true,
+			},
+		}
+		plan, err := Compile(header, rules)
+		if err != nil {
+			t.Fatalf("Failed to compile rules: %v", err)
+		}
+		mutated, err := plan.Execute([][]string{
+			header,
+			{"1", "INTERNAL", "150.5"},
+			{"2", "PAYMENT", "20"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to execute plan: %v", err)
+		}
+		assert.Equal(t, mutated, [][]string{
+			header,
+			{"1", "INTERNAL", "**redacted**"},
+			{"**redacted**", "**redacted**", "20"},
+		})
+	})
+
+	t.Run("else action column not found", func(t *testing.T) {
+		rules := []types.Rule{{ElseActions: []types.Action{{ActionType: "REDACT", FieldName: "missing"}}}}
+		_, err := Compile(header, rules)
+		assert.NotEqual(t, err, nil)
+		assert.Equal(t, err.ActionIndex, nil)
+		assert.Equal(t, *err.ElseActionIndex, 0)
+	})
+
+	t.Run("excluded columns keep the rows aligned with the header", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				// Only some rows, the cell is emptied
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions: []types.Expressions{
+						{FieldName: "type", Operator: "EQ", Value: "PAYMENT"},
+					},
+				},
+				Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "amount"}},
+			},
+			{
+				// Every row, the column is removed
+				Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "id"}},
+			},
+		}
+		plan, err := Compile(header, rules)
+		if err != nil {
+			t.Fatalf("Failed to compile rules: %v", err)
+		}
+		assert.Equal(t, plan.Header(header), []string{"type", "amount"})
+		mutated, err := plan.Execute([][]string{
+			header,
+			{"1", "PAYMENT", "150.5"},
+			{"2", "TRANSFER", "20"},
+			{"3"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to execute plan: %v", err)
+		}
+		assert.Equal(t, mutated, [][]string{
+			{"type", "amount"},
+			{"PAYMENT", ""},
+			{"TRANSFER", "20"},
+			{},
+		})
+
+		// A rule that can stop the processing of a row comes first, the column is only emptied
+		rules = append(rules, types.Rule{Expression: rules[0].Expression, Priority: 1, StopProcessing: true})
+		plan, err = Compile(header, rules)
+		if err != nil {
+			t.Fatalf("Failed to compile rules: %v", err)
+		}
+		assert.Equal(t, plan.Header(header), header)
+		row, err := plan.ExecuteRow([]string{"2", "TRANSFER", "20"})
+		if err != nil {
+			t.Fatalf("Failed to execute plan: %v", err)
+		}
+		assert.Equal(t, row, []string{"", "TRANSFER", "20"})
+	})
+}
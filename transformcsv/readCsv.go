@@ -0,0 +1,218 @@
+package transformcsv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ReadCsv converts the bytes content into the rows of the dialect.
+Quotes are lazy (a quote inside a field is kept) and the spaces before a field are trimmed, like the default comma separated files.
+*/
+func ReadCsv(bytesContent []byte, dialect Dialect) ([][]string, error) {
+	if !dialect.isStandard() {
+		reader := &recordReader{content: bytesContent, dialect: dialect}
+		lines := [][]string{}
+		for record := reader.read(); record != nil; record = reader.read() {
+			lines = append(lines, record)
+		}
+		return lines, nil
+	}
+	lines, err := newStandardReader(bytesContent, dialect).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not decode your input, please upload a new csv file")
+	}
+	return lines, nil
+}
+
+/*
+WriteCsv converts the rows into the bytes content of the dialect.
+Fields are quoted when they contain the delimiter, a quote, the escape character or a line break.
+*/
+func WriteCsv(lines [][]string, dialect Dialect) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+	if !dialect.isStandard() {
+		for _, line := range lines {
+			writeRecord(buffer, line, dialect)
+		}
+		return buffer.Bytes(), nil
+	}
+	writer := csv.NewWriter(buffer)
+	writer.Comma = dialect.Delimiter
+	writer.UseCRLF = dialect.UseCRLF
+	writer.WriteAll(lines)
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("error flushing csv writer: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+/*
+	Helper functions
+*/
+// readFirstRecord reads only the first row of the content, nil when it's empty
+func readFirstRecord(bytesContent []byte, dialect Dialect) ([]string, error) {
+	if !dialect.isStandard() {
+		reader := &recordReader{content: bytesContent, dialect: dialect}
+		return reader.read(), nil
+	}
+	record, err := newStandardReader(bytesContent, dialect).Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not decode your input, please upload a new csv file")
+	}
+	return record, nil
+}
+
+func newStandardReader(bytesContent []byte, dialect Dialect) *csv.Reader {
+	reader := csv.NewReader(bytes.NewReader(bytesContent))
+	reader.Comma = dialect.Delimiter
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	// Trimming the leading spaces would also trim the delimiter of empty fields when it's a space (e.g. tab)
+	reader.TrimLeadingSpace = !unicode.IsSpace(dialect.Delimiter)
+	return reader
+}
+
+// recordReader reads the dialects encoding/csv can't: other quote characters, and quotes escaped with an escape character
+type recordReader struct {
+	content  []byte
+	position int
+	dialect  Dialect
+}
+
+// read returns the next row, nil at the end of the content. Empty lines are skipped
+func (reader *recordReader) read() []string {
+	for reader.position < len(reader.content) && reader.lineBreak() > 0 {
+		reader.position += reader.lineBreak()
+	}
+	if reader.position >= len(reader.content) {
+		return nil
+	}
+
+	record := []string{}
+	field := strings.Builder{}
+	for {
+		field.Reset()
+		// Leading spaces are trimmed
+		for character, size := reader.peek(0); size > 0 && character != reader.dialect.Delimiter && (character == ' ' || character == '\t'); character, size = reader.peek(0) {
+			reader.position += size
+		}
+		if character, size := reader.peek(0); size > 0 && character == reader.dialect.Quote {
+			reader.position += size
+			reader.readQuoted(&field)
+		}
+		// Unquoted field, or the rest of a field after its closing quote
+		for character, size := reader.peek(0); size > 0 && character != reader.dialect.Delimiter && reader.lineBreak() == 0; character, size = reader.peek(0) {
+			field.WriteRune(character)
+			reader.position += size
+		}
+		record = append(record, field.String())
+
+		if character, size := reader.peek(0); size > 0 && character == reader.dialect.Delimiter {
+			reader.position += size
+			continue
+		}
+		reader.position += reader.lineBreak()
+		return record
+	}
+}
+
+// readQuoted reads a quoted field after its opening quote, up to its closing quote
+func (reader *recordReader) readQuoted(field *strings.Builder) {
+	quote, escape := reader.dialect.Quote, reader.dialect.Escape
+	for reader.position < len(reader.content) {
+		character, size := reader.peek(0)
+		next, nextSize := reader.peek(size)
+		switch {
+		case escape != 0 && character == escape && nextSize > 0 && (next == quote || next == escape):
+			field.WriteRune(next)
+			reader.position += size + nextSize
+		case character == quote && escape == 0 && nextSize > 0 && next == quote:
+			field.WriteRune(quote)
+			reader.position += size + nextSize
+		case character == quote:
+			reader.position += size
+			// The closing quote is followed by the delimiter or the end of the line, other quotes are kept (lazy quotes)
+			if next, nextSize := reader.peek(0); nextSize == 0 || next == reader.dialect.Delimiter || reader.lineBreak() > 0 {
+				return
+			}
+			field.WriteRune(quote)
+		case character == '\r' && nextSize > 0 && next == '\n':
+			// Line breaks in quoted fields are \n, like encoding/csv
+			field.WriteRune('\n')
+			reader.position += size + nextSize
+		default:
+			field.WriteRune(character)
+			reader.position += size
+		}
+	}
+}
+
+// peek returns the character at the offset from the position, with a size of 0 at the end of the content
+func (reader *recordReader) peek(offset int) (rune, int) {
+	if reader.position+offset >= len(reader.content) {
+		return 0, 0
+	}
+	return utf8.DecodeRune(reader.content[reader.position+offset:])
+}
+
+// lineBreak returns the size of the line break (\n or \r\n) at the position, 0 when there is none
+func (reader *recordReader) lineBreak() int {
+	rest := reader.content[reader.position:]
+	if bytes.HasPrefix(rest, []byte("\n")) {
+		return 1
+	}
+	if bytes.HasPrefix(rest, []byte("\r\n")) {
+		return 2
+	}
+	return 0
+}
+
+// writeRecord writes the row with the quote and escape characters of the dialect
+func writeRecord(buffer *bytes.Buffer, record []string, dialect Dialect) {
+	for index, field := range record {
+		if index > 0 {
+			buffer.WriteRune(dialect.Delimiter)
+		}
+		if !needsQuotes(field, dialect) {
+			buffer.WriteString(field)
+			continue
+		}
+		buffer.WriteRune(dialect.Quote)
+		for _, character := range field {
+			switch {
+			case character == dialect.Quote && dialect.Escape == 0:
+				buffer.WriteRune(dialect.Quote)
+			case dialect.Escape != 0 && (character == dialect.Quote || character == dialect.Escape):
+				buffer.WriteRune(dialect.Escape)
+			}
+			buffer.WriteRune(character)
+		}
+		buffer.WriteRune(dialect.Quote)
+	}
+	if dialect.UseCRLF {
+		buffer.WriteString("\r\n")
+	} else {
+		buffer.WriteString("\n")
+	}
+}
+
+func needsQuotes(field string, dialect Dialect) bool {
+	if field == "" {
+		return false
+	}
+	if field[0] == ' ' || field[0] == '\t' || strings.ContainsAny(field, "\r\n") {
+		return true
+	}
+	return strings.ContainsRune(field, dialect.Delimiter) || strings.ContainsRune(field, dialect.Quote) ||
+		(dialect.Escape != 0 && strings.ContainsRune(field, dialect.Escape))
+}
@@ -0,0 +1,333 @@
+package transformcsv
+
+import (
+	"bytes"
+	"fmt"
+	"lazy-lagoon/pkg/types"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialects of the SQL scripts
+const (
+	Postgres = "POSTGRES"
+	MySQL    = "MYSQL"
+)
+
+// Rows inserted per INSERT statement when the batch size isn't set
+const defaultBatchSize = 100
+
+// Column types of the script, written with the type names of the dialect
+const (
+	integerColumn   = "integer"
+	decimalColumn   = "decimal"
+	floatColumn     = "float"
+	booleanColumn   = "boolean"
+	dateColumn      = "date"
+	timestampColumn = "timestamp"
+	textColumn      = "text"
+)
+
+// Numbers written without quotes, "007" or "1." are strings
+var sqlNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// Layouts of the date and timestamp values, the database drivers write timestamps as RFC 3339
+var (
+	dateLayouts      = []string{"2006-01-02", time.RFC3339Nano}
+	timestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999"}
+)
+
+/*
+SqlScript is how the rows of a SQL output are written as a script creating the table and inserting the rows
+*/
+type SqlScript struct {
+	Dialect   string
+	Table     string
+	BatchSize int
+}
+
+/*
+IsSqlScript reports whether the output is written as a SQL script instead of CSV, the output data type defaults to the input data type
+*/
+func IsSqlScript(inputType string, output types.Output) bool {
+	dataType := output.DataType
+	if dataType == "" {
+		dataType = inputType
+	}
+	return dataType == "SQL" && output.Sql != nil && strings.ToUpper(output.Sql.Format) == "INSERT"
+}
+
+/*
+NewSqlScript resolves the script settings, the table defaults to the table of the input reference
+*/
+func NewSqlScript(settings *types.SqlScript, table string) (SqlScript, error) {
+	script := SqlScript{Dialect: Postgres, Table: table, BatchSize: defaultBatchSize}
+	if script.Table == "" {
+		script.Table = "data"
+	}
+	if settings == nil {
+		return script, nil
+	}
+	switch strings.ToUpper(settings.Format) {
+	case "", "CSV", "INSERT":
+	default:
+		return SqlScript{}, fmt.Errorf("sql format %s not supported, use CSV or INSERT", settings.Format)
+	}
+	if settings.Dialect != "" {
+		script.Dialect = strings.ToUpper(settings.Dialect)
+		if script.Dialect != Postgres && script.Dialect != MySQL {
+			return SqlScript{}, fmt.Errorf("sql dialect %s not supported, use POSTGRES or MYSQL", settings.Dialect)
+		}
+	}
+	if settings.Table != "" {
+		script.Table = settings.Table
+	}
+	if settings.BatchSize < 0 {
+		return SqlScript{}, fmt.Errorf("sql batch size must be positive")
+	}
+	if settings.BatchSize > 0 {
+		script.BatchSize = settings.BatchSize
+	}
+	return script, nil
+}
+
+/*
+Write returns the script creating the table and inserting the rows in batches.
+The rows keep the columns of the header, their excluded fields are NULL and the columns excluded from every row are left out.
+The column types are the source types (e.g. INT4 from a Postgres query) when every value still fits them, they are inferred from the values otherwise.
+Empty fields are NULL, like the NULL values of a query.
+*/
+func (script SqlScript) Write(header []string, sourceTypes []string, rows [][]string, excluded [][]bool) []byte {
+	// Columns kept in the table, and their types
+	var columns []int
+	for column := range header {
+		for index := range rows {
+			if !isExcludedField(excluded, index, column) {
+				columns = append(columns, column)
+				break
+			}
+		}
+	}
+	if len(rows) == 0 {
+		for column := range header {
+			columns = append(columns, column)
+		}
+	}
+	columnTypes := make([]string, len(header))
+	for _, column := range columns {
+		sourceType := ""
+		if column < len(sourceTypes) {
+			sourceType = sourceTypes[column]
+		}
+		columnTypes[column] = columnType(sourceType, columnValues(rows, excluded, column))
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	table := script.quoteTable()
+	// CREATE TABLE
+	fmt.Fprintf(buffer, "CREATE TABLE %s (\n", table)
+	names := make([]string, len(columns))
+	for index, column := range columns {
+		names[index] = script.quoteName(header[column])
+		separator := ","
+		if index == len(columns)-1 {
+			separator = ""
+		}
+		fmt.Fprintf(buffer, "  %s %s%s\n", names[index], script.typeName(columnTypes[column]), separator)
+	}
+	buffer.WriteString(");\n")
+
+	// INSERT statements of batchSize rows
+	for start := 0; start < len(rows); start += script.BatchSize {
+		end := min(start+script.BatchSize, len(rows))
+		fmt.Fprintf(buffer, "\nINSERT INTO %s (%s) VALUES\n", table, strings.Join(names, ", "))
+		for index := start; index < end; index++ {
+			values := make([]string, len(columns))
+			for position, column := range columns {
+				value := ""
+				if column < len(rows[index]) && !isExcludedField(excluded, index, column) {
+					value = rows[index][column]
+				}
+				values[position] = script.literal(value, columnTypes[column])
+			}
+			separator := ","
+			if index == end-1 {
+				separator = ";"
+			}
+			fmt.Fprintf(buffer, "(%s)%s\n", strings.Join(values, ", "), separator)
+		}
+	}
+	return buffer.Bytes()
+}
+
+/*
+	Helper functions
+*/
+// isExcludedField checks the field of the row was excluded by the rules
+func isExcludedField(excluded [][]bool, row int, column int) bool {
+	return row < len(excluded) && column < len(excluded[row]) && excluded[row][column]
+}
+
+// columnValues returns the values of the column that aren't NULL
+func columnValues(rows [][]string, excluded [][]bool, column int) []string {
+	var values []string
+	for index, row := range rows {
+		if column < len(row) && row[column] != "" && !isExcludedField(excluded, index, column) {
+			values = append(values, row[column])
+		}
+	}
+	return values
+}
+
+// columnType returns the type of the source when the values fit it, the type inferred from the values otherwise
+func columnType(sourceType string, values []string) string {
+	if sourceType != "" {
+		columnType := sourceColumnType(sourceType)
+		if fitsAll(columnType, values) {
+			return columnType
+		}
+		// The values were changed by the actions, e.g. **redacted** in a number column
+		return textColumn
+	}
+	if len(values) == 0 {
+		return textColumn
+	}
+	for _, columnType := range []string{integerColumn, decimalColumn, booleanColumn, dateColumn, timestampColumn} {
+		if fitsAll(columnType, values) {
+			return columnType
+		}
+	}
+	return textColumn
+}
+
+// sourceColumnType returns the column type of the database type name, e.g. INT4 is an integer
+func sourceColumnType(sourceType string) string {
+	switch strings.ToUpper(sourceType) {
+	case "INT2", "INT4", "INT8", "SMALLINT", "INTEGER", "INT", "BIGINT", "TINYINT", "MEDIUMINT":
+		return integerColumn
+	case "NUMERIC", "DECIMAL":
+		return decimalColumn
+	case "FLOAT4", "FLOAT8", "REAL", "FLOAT", "DOUBLE":
+		return floatColumn
+	case "BOOL", "BOOLEAN":
+		return booleanColumn
+	case "DATE":
+		return dateColumn
+	case "TIMESTAMP", "TIMESTAMPTZ", "DATETIME":
+		return timestampColumn
+	}
+	return textColumn
+}
+
+// fitsAll checks every value can be written in the column type
+func fitsAll(columnType string, values []string) bool {
+	for _, value := range values {
+		if !fits(columnType, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func fits(columnType string, value string) bool {
+	switch columnType {
+	case integerColumn:
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && sqlNumber.MatchString(value)
+	case decimalColumn, floatColumn:
+		return sqlNumber.MatchString(value)
+	case booleanColumn:
+		return value == "true" || value == "false"
+	case dateColumn:
+		// A date is a timestamp at midnight UTC for the database drivers
+		parsed, ok := parseTime(value, dateLayouts)
+		return ok && parsed.UTC().Equal(parsed.Truncate(24*time.Hour))
+	case timestampColumn:
+		_, ok := parseTime(value, timestampLayouts)
+		return ok
+	}
+	return true
+}
+
+func parseTime(value string, layouts []string) (time.Time, bool) {
+	for _, layout := range layouts {
+		parsed, err := time.Parse(layout, value)
+		if err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// typeName returns the name of the column type in the dialect
+func (script SqlScript) typeName(columnType string) string {
+	switch columnType {
+	case integerColumn:
+		return "BIGINT"
+	case decimalColumn:
+		if script.Dialect == MySQL {
+			return "DECIMAL(65,30)"
+		}
+		return "NUMERIC"
+	case floatColumn:
+		return "DOUBLE PRECISION"
+	case booleanColumn:
+		return "BOOLEAN"
+	case dateColumn:
+		return "DATE"
+	case timestampColumn:
+		if script.Dialect == MySQL {
+			return "DATETIME(6)"
+		}
+		return "TIMESTAMP"
+	}
+	return "TEXT"
+}
+
+// literal writes the value in the column type: NULL, numbers, booleans, or quoted strings; dates and timestamps are written in UTC
+func (script SqlScript) literal(value string, columnType string) string {
+	if value == "" {
+		return "NULL"
+	}
+	switch columnType {
+	case integerColumn, decimalColumn, floatColumn:
+		return value
+	case booleanColumn:
+		return strings.ToUpper(value)
+	case dateColumn:
+		parsed, _ := parseTime(value, dateLayouts)
+		return script.quoteString(parsed.Format("2006-01-02"))
+	case timestampColumn:
+		parsed, _ := parseTime(value, timestampLayouts)
+		return script.quoteString(parsed.UTC().Format("2006-01-02 15:04:05.999999"))
+	}
+	return script.quoteString(value)
+}
+
+// quoteString quotes the string, MySQL also escapes the backslashes
+func (script SqlScript) quoteString(value string) string {
+	if script.Dialect == MySQL {
+		value = strings.ReplaceAll(value, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// quoteName quotes the table or column name, with double quotes in Postgres and backticks in MySQL
+func (script SqlScript) quoteName(name string) string {
+	quote := `"`
+	if script.Dialect == MySQL {
+		quote = "`"
+	}
+	return quote + strings.ReplaceAll(name, quote, quote+quote) + quote
+}
+
+// quoteTable quotes the table name, "schema.table" is quoted as two names
+func (script SqlScript) quoteTable() string {
+	parts := strings.Split(script.Table, ".")
+	for index, part := range parts {
+		parts[index] = script.quoteName(part)
+	}
+	return strings.Join(parts, ".")
+}
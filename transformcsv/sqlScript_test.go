@@ -0,0 +1,102 @@
+package transformcsv
+
+import (
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestSqlScript(t *testing.T) {
+	header := []string{"id", "full_name", "salary", "created_at", "note"}
+	lines := [][]string{
+		header,
+		{"1", "O'Brien", "1200.50", "2023-10-01T00:00:00Z", `C:\temp`},
+		{"2", "Ada", "", "2023-10-02T08:30:00Z", ""},
+		{"3", "Grace", "900", "2023-10-03T00:00:00Z", "x"},
+	}
+	rules := []types.Rule{
+		{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions:     []types.Expressions{{FieldName: "id", Operator: "EQ", Value: 3}},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "salary"}},
+		},
+		{Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "note"}}},
+	}
+	transform := func(t *testing.T) ([][]string, [][]bool) {
+		plan, transformErr := Compile(header, rules)
+		if transformErr != nil {
+			t.Fatalf("Failed to compile rules: %v", transformErr.Message)
+		}
+		var rows [][]string
+		var excluded [][]bool
+		for _, line := range lines[1:] {
+			row, rowExcluded, transformErr := plan.ExecuteFields(append([]string{}, line...))
+			if transformErr != nil {
+				t.Fatalf("Failed to execute rules: %v", transformErr.Message)
+			}
+			rows, excluded = append(rows, row), append(excluded, rowExcluded)
+		}
+		return rows, excluded
+	}
+
+	t.Run("postgres script with the source types", func(t *testing.T) {
+		script, err := NewSqlScript(&types.SqlScript{Format: "INSERT", BatchSize: 2}, "public.users")
+		if err != nil {
+			t.Fatalf("Failed to resolve script: %v", err)
+		}
+		rows, excluded := transform(t)
+		content := script.Write(header, []string{"INT4", "VARCHAR", "NUMERIC", "TIMESTAMPTZ", "TEXT"}, rows, excluded)
+		assert.Equal(t, string(content), `CREATE TABLE "public"."users" (
+  "id" BIGINT,
+  "full_name" TEXT,
+  "salary" TEXT,
+  "created_at" TIMESTAMP
+);
+
+INSERT INTO "public"."users" ("id", "full_name", "salary", "created_at") VALUES
+(1, 'O''Brien', '1200.50', '2023-10-01 00:00:00'),
+(2, 'Ada', NULL, '2023-10-02 08:30:00');
+
+INSERT INTO "public"."users" ("id", "full_name", "salary", "created_at") VALUES
+(3, 'Grace', '**redacted**', '2023-10-03 00:00:00');
+`)
+	})
+
+	t.Run("mysql script with the inferred types", func(t *testing.T) {
+		script, err := NewSqlScript(&types.SqlScript{Format: "INSERT", Dialect: "mysql", Table: "users"}, "")
+		if err != nil {
+			t.Fatalf("Failed to resolve script: %v", err)
+		}
+		content := script.Write([]string{"id", "amount", "active", "note"}, nil, [][]string{
+			{"1", "12.50", "true", `C:\temp`},
+			{"2", "007", "false", ""},
+		}, nil)
+		assert.Equal(t, string(content), "CREATE TABLE `users` (\n"+
+			"  `id` BIGINT,\n"+
+			"  `amount` TEXT,\n"+
+			"  `active` BOOLEAN,\n"+
+			"  `note` TEXT\n"+
+			");\n\n"+
+			"INSERT INTO `users` (`id`, `amount`, `active`, `note`) VALUES\n"+
+			"(1, '12.50', TRUE, 'C:\\\\temp'),\n"+
+			"(2, '007', FALSE, NULL);\n")
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		cases := []*types.SqlScript{
+			{Format: "COPY"},
+			{Format: "INSERT", Dialect: "ORACLE"},
+			{Format: "INSERT", BatchSize: -1},
+		}
+		for _, testCase := range cases {
+			_, err := NewSqlScript(testCase, "")
+			assert.NotEqual(t, err, nil)
+		}
+		assert.Equal(t, IsSqlScript("SQL", types.Output{Sql: &types.SqlScript{Format: "insert"}}), true)
+		assert.Equal(t, IsSqlScript("SQL", types.Output{DataType: "CSV", Sql: &types.SqlScript{Format: "INSERT"}}), false)
+	})
+}
@@ -1,14 +1,10 @@
 package transformcsv
 
 import (
-	"bytes"
-	"encoding/csv"
-	"fmt"
 	"lazy-lagoon/pkg/concurrent"
+	"lazy-lagoon/pkg/textencoding"
 	"lazy-lagoon/pkg/types"
 	"lazy-lagoon/storage"
-	"slices"
-	"strings"
 )
 
 /*
@@ -16,159 +12,202 @@ Step 1: execute transform, and store in output storage
 */
 func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
 	/*
-		Downloading the file from the input storage type
+		Downloading the file from the input storage type, decoded to UTF-8
 	*/
-	byteContent, err := storage.GetBytes(input)
+	byteContent, encoding, err := storage.GetText(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	// The output is written in the encoding of the input unless set
+	if output.Encoding != "" {
+		encoding = output.Encoding
+	}
+	/*
+		Resolving the dialects, the output writes the dialect of the input unless set
+	*/
+	dialect, err := InputDialect(input.Csv, byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	outputDialect, err := OutputDialect(output.Csv, dialect)
 	if err != nil {
 		return &types.TransformError{Message: err.Error()}
 	}
 	/*
-		Chunking the file
+		Chunking the rows of the file, the header is read once for every chunk
 	*/
-	chunks, err := Chunk(byteContent)
+	chunks, err := Chunk(byteContent, dialect, chunkSize)
 	if err != nil {
 		return &types.TransformError{Message: err.Error()}
 	}
+	// SQL outputs can be written as a script creating the table and inserting the rows
+	if IsSqlScript(input.DataType, output) {
+		return processSqlScriptWithOutput(chunks, rules, dialect, input, encoding, output)
+	}
 
 	// If output is specified, transform and upload the data
-	return processChunksWithOutput(chunks, rules, output)
+	return processChunksWithOutput(chunks, rules, dialect, outputDialect, encoding, output)
 }
 
 // processChunksWithOutput transforms the chunks and uploads them to the specified output
-func processChunksWithOutput(chunks [][]byte, rules []types.Rule, output types.Output) *types.TransformError {
-	// Create a client for multipart uploads
-	client, uploadId, err := storage.CreateMultiPartClient(output)
-	if err != nil {
-		return &types.TransformError{Message: err.Error()}
+func processChunksWithOutput(chunks Chunks, rules []types.Rule, dialect Dialect, outputDialect Dialect, encoding string, output types.Output) *types.TransformError {
+	/*
+		Compiling the rules once against the header
+	*/
+	plan, transformErr := Compile(chunks.Header, rules)
+	if transformErr != nil {
+		return transformErr
 	}
 
-	// Initialize uploadedParts based on storage type
-	uploadedParts, err := storage.InitializeUploadedParts(output)
+	// The columns excluded from every row are left out of the header
+	header := plan.Header(chunks.Header)
+
+	upload, err := storage.NewMultipartWriter(output)
 	if err != nil {
 		return &types.TransformError{Message: err.Error()}
 	}
-	// Process and upload each chunk
-	transformErr := concurrent.ForEachVoid(chunks, func(chunk []byte, index int) *types.TransformError {
+
+	// Transform the chunks concurrently, each one is uploaded as soon as the chunks before it are
+	transformErr = concurrent.ForEachOrdered(chunks.Rows, func(chunk []byte, index int) ([]byte, *types.TransformError) {
 		// Transform the chunk
-		csvLines, err := ToCsv(chunk)
+		csvLines, err := ReadCsv(chunk, dialect)
 		if err != nil {
-			return &types.TransformError{Message: err.Error()}
+			return nil, &types.TransformError{Message: err.Error()}
 		}
 		/*
 			Transforming the CSV lines
 		*/
-		csvLines, transformErr := ExecuteRules(csvLines, rules)
+		csvLines, transformErr := plan.ExecuteRows(csvLines)
 		if transformErr != nil {
-			return transformErr
+			return nil, transformErr
+		}
+		// The header row is written once, before the rows of the first chunk (the column positions when the input has none)
+		if outputDialect.HasHeader && index == 0 && len(header) > 0 {
+			csvLines = append([][]string{header}, csvLines...)
 		}
 		/*
 			Converting the CSV lines back to bytes
 		*/
-		transformedBytes, err := FromCsv(csvLines)
+		transformedBytes, err := WriteCsv(csvLines, outputDialect)
 		if err != nil {
-			return &types.TransformError{Message: err.Error(), Key: "upload"}
+			return nil, &types.TransformError{Message: err.Error(), Key: "upload"}
 		}
-
-		// Upload the transformed chunk
-		var partNumber int64 = int64(index + 1)
-		isLastChunk := index == (len(chunks) - 1)
-
-		uploadedPart, err := storage.UploadAndCompleteChunk(client, output, partNumber, uploadId, transformedBytes, isLastChunk, uploadedParts)
+		transformedBytes, err = textencoding.Encode(transformedBytes, encoding, index == 0)
 		if err != nil {
-			return &types.TransformError{Message: err.Error()}
+			return nil, &types.TransformError{Message: err.Error(), Key: "upload"}
 		}
-
-		// Update uploadedParts with the new part
-		uploadedParts, err = storage.UpdateUploadedParts(output, uploadedParts, uploadedPart, partNumber)
+		return transformedBytes, nil
+	}, func(transformedBytes []byte, index int) *types.TransformError {
+		/*
+			Uploading the chunk, the multipart writer compresses the chunks and splits them into parts
+		*/
+		_, err := upload.Write(transformedBytes)
 		if err != nil {
 			return &types.TransformError{Message: err.Error(), Key: "upload"}
 		}
-
 		return nil
 	})
 	if transformErr != nil {
 		return transformErr
 	}
-
-	// Return empty byte slice as the data has been uploaded
+	err = upload.Close()
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
 	return nil
 }
 
-/*
-Step 2: Transform the CSV document based on the rules
-*/
-func ExecuteRules(lines [][]string, rules []types.Rule) ([][]string, *types.TransformError) {
-	// Create a deep copy of the original lines to preserve them
-	documentCopy := make([][]string, len(lines))
-	for i, line := range lines {
-		documentCopy[i] = make([]string, len(line))
-		copy(documentCopy[i], line)
+// processSqlScriptWithOutput transforms the chunks and uploads the rows as a SQL script with the column types of the source
+func processSqlScriptWithOutput(chunks Chunks, rules []types.Rule, dialect Dialect, input types.Input, encoding string, output types.Output) *types.TransformError {
+	script, err := NewSqlScript(output.Sql, input.Reference.Table)
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "sql"}
+	}
+	sourceTypes, err := storage.GetColumnTypes(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	/*
+		Compiling the rules once against the header
+	*/
+	header := chunks.Header
+	plan, transformErr := Compile(header, rules)
+	if transformErr != nil {
+		return transformErr
 	}
 
-	// Apply the rules to the lines
-	for ruleIndex, rule := range rules {
-		for actionIndex, action := range rule.Actions {
-			transformErr := ExecuteAction(lines, documentCopy, action.FieldName, rule.Expression, action.ActionType, ruleIndex, actionIndex)
+	// Transform the chunks concurrently, the excluded fields are kept so every row has the columns of the header
+	type transformedChunk struct {
+		rows     [][]string
+		excluded [][]bool
+	}
+	transformedChunks, transformErr := concurrent.ForEach(chunks.Rows, func(chunk []byte, index int) (transformedChunk, *types.TransformError) {
+		csvLines, err := ReadCsv(chunk, dialect)
+		if err != nil {
+			return transformedChunk{}, &types.TransformError{Message: err.Error()}
+		}
+		transformed := transformedChunk{rows: make([][]string, len(csvLines)), excluded: make([][]bool, len(csvLines))}
+		for lineIndex, line := range csvLines {
+			row, excluded, transformErr := plan.ExecuteFields(line)
 			if transformErr != nil {
-				return nil, transformErr
+				return transformedChunk{}, transformErr
 			}
+			transformed.rows[lineIndex], transformed.excluded[lineIndex] = row, excluded
 		}
+		return transformed, nil
+	})
+	if transformErr != nil {
+		return transformErr
+	}
+	var rows [][]string
+	var excluded [][]bool
+	for _, transformed := range transformedChunks {
+		rows = append(rows, transformed.rows...)
+		excluded = append(excluded, transformed.excluded...)
 	}
-	return lines, nil
+
+	/*
+		Writing the script, the column types depend on every transformed row
+	*/
+	content, err := textencoding.Encode(script.Write(header, sourceTypes, rows, excluded), encoding, true)
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
+	upload, err := storage.NewMultipartWriter(output)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	_, err = upload.Write(content)
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
+	err = upload.Close()
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
+	return nil
 }
 
 /*
-Step 3: Execute the actions by the actionType if the expressions are met
+Step 2: Transform the CSV document based on the rules
 */
-func ExecuteAction(lines [][]string, unMutatedLines [][]string, fieldName string, expression types.Expression, actionType string, ruleIndex int, actionIndex int) *types.TransformError {
-	if fieldName == "" {
-		// No op if the field name is empty
-		return nil
+func ExecuteRules(lines [][]string, rules []types.Rule) ([][]string, *types.TransformError) {
+	if len(lines) == 0 {
+		return lines, nil
 	}
-	// lines[0] is the header line
-	column := slices.Index(lines[0], fieldName)
-	// If theres an index found - fault safety
-	if column < 0 {
-		return &types.TransformError{
-			Message: "column not found",
-			RuleIndex: &ruleIndex,
-			ActionIndex: &actionIndex,
-			Key: "fieldName",
-		}
+	// Create a deep copy of the original lines to preserve them
+	documentCopy := make([][]string, len(lines))
+	for i, line := range lines {
+		documentCopy[i] = make([]string, len(line))
+		copy(documentCopy[i], line)
 	}
-	for index, line := range lines {
-		// Skip the header
-		if index == 0 {
-			continue
-		}
-		if column >= len(line) {
-			// If the column is out of range then skip the line
-			continue
-		}
-		// Checking if the expressions are met
-		met, transformErr := IsExpressionMet(expression, unMutatedLines, index, ruleIndex)
-		if transformErr != nil {
-			return transformErr
-		}
-		if !met {
-			continue
-		}
 
-		// Applying the operation if the expressions are met
-		if actionType == "REDACT" {
-			// Don't redact the header
-			if index != 0 {
-				// Redact the column
-				if line[column] != "" {
-					line[column] = "**redacted**"
-				}
-			}
-		} else {
-			// Exclude column
-			lines[index] = append(lines[index][:column], lines[index][column+1:]...)
-		}
+	// lines[0] is the header line
+	plan, transformErr := Compile(documentCopy[0], rules)
+	if transformErr != nil {
+		return nil, transformErr
 	}
-	return nil
+	return plan.Execute(documentCopy)
 }
 
 /*
@@ -176,27 +215,29 @@ func ExecuteAction(lines [][]string, unMutatedLines [][]string, fieldName string
 */
 // Convert the bytes content into a 2d slice of strings which is the csv content
 func ToCsv(bytesContent []byte) ([][]string, error) {
-	reader := csv.NewReader(strings.NewReader(string(bytesContent)))
-	reader.Comma = ','
-	reader.LazyQuotes = true
-	reader.FieldsPerRecord = -1
-	reader.TrimLeadingSpace = true
+	return ReadCsv(bytesContent, DefaultDialect)
+}
 
-	lines, err := reader.ReadAll()
+// Read only the header row of the CSV content, the column positions of the rows when the file has no header
+func ReadHeader(bytesContent []byte, dialect Dialect) ([]string, error) {
+	if !dialect.HasHeader {
+		lines, err := ReadCsv(bytesContent, dialect)
+		if err != nil {
+			return nil, err
+		}
+		return dialect.Header(lines), nil
+	}
+	header, err := readFirstRecord(bytesContent, dialect)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode your input, please upload a new csv file")
+		return nil, err
+	}
+	if header == nil {
+		return []string{}, nil
 	}
-	return lines, nil
+	return header, nil
 }
 
 // Convert the 2d slice of strings into bytes
 func FromCsv(lines [][]string) ([]byte, error) {
-	buffer := bytes.NewBuffer(nil)
-	writer := csv.NewWriter(buffer)
-	writer.WriteAll(lines)
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		return nil, fmt.Errorf("error flushing csv writer: %v", err)
-	}
-	return buffer.Bytes(), nil
+	return WriteCsv(lines, DefaultDialect)
 }
@@ -0,0 +1,152 @@
+package transformfixedwidth
+
+import (
+	"fmt"
+	"lazy-lagoon/pkg/types"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Field is a field of the layout, the positions are in characters and 0 based
+*/
+type Field struct {
+	Name         string
+	start        int
+	length       int
+	rightAligned bool
+	padding      rune
+}
+
+/*
+Layout is the fields of every record line, resolved from the layout of the request
+*/
+type Layout struct {
+	Fields      []Field
+	HeaderLines int
+}
+
+/*
+NewLayout checks the layout of the request: the fields need a unique name, a start and a length, and can't overlap
+*/
+func NewLayout(settings *types.FixedWidthLayout) (Layout, error) {
+	if settings == nil || len(settings.Fields) == 0 {
+		return Layout{}, fmt.Errorf("fixedWidth fields are required for FIXEDWIDTH files")
+	}
+	if settings.HeaderLines < 0 {
+		return Layout{}, fmt.Errorf("headerLines can't be negative")
+	}
+	layout := Layout{HeaderLines: settings.HeaderLines}
+	names := map[string]bool{}
+	for _, setting := range settings.Fields {
+		if setting.Name == "" {
+			return Layout{}, fmt.Errorf("every field needs a name")
+		}
+		if names[setting.Name] {
+			return Layout{}, fmt.Errorf("field %s is in the layout twice", setting.Name)
+		}
+		names[setting.Name] = true
+		if setting.Start < 1 || setting.Length < 1 {
+			return Layout{}, fmt.Errorf("field %s needs a start and a length of at least 1", setting.Name)
+		}
+		field := Field{Name: setting.Name, start: setting.Start - 1, length: setting.Length, padding: ' '}
+		switch strings.ToUpper(setting.Alignment) {
+		case "", "LEFT":
+		case "RIGHT":
+			field.rightAligned = true
+		default:
+			return Layout{}, fmt.Errorf("alignment %s of field %s not supported, use LEFT or RIGHT", setting.Alignment, setting.Name)
+		}
+		if setting.Padding != "" {
+			if utf8.RuneCountInString(setting.Padding) != 1 {
+				return Layout{}, fmt.Errorf("padding of field %s must be a single character", setting.Name)
+			}
+			field.padding, _ = utf8.DecodeRuneInString(setting.Padding)
+		}
+		layout.Fields = append(layout.Fields, field)
+	}
+	// Fields written over each other can't be written back
+	sorted := append([]Field{}, layout.Fields...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+	for index := 1; index < len(sorted); index++ {
+		if sorted[index].start < sorted[index-1].start+sorted[index-1].length {
+			return Layout{}, fmt.Errorf("field %s overlaps field %s", sorted[index].Name, sorted[index-1].Name)
+		}
+	}
+	return layout, nil
+}
+
+/*
+Header returns the names of the fields, the columns of the rows
+*/
+func (layout Layout) Header() []string {
+	header := make([]string, len(layout.Fields))
+	for index, field := range layout.Fields {
+		header[index] = field.Name
+	}
+	return header
+}
+
+/*
+Read returns the values of the fields of the line without their padding, the fields past the end of the line are empty
+*/
+func (layout Layout) Read(line []rune) []string {
+	row := make([]string, len(layout.Fields))
+	for index, field := range layout.Fields {
+		value := string(line[min(field.start, len(line)):min(field.start+field.length, len(line))])
+		row[index] = field.trim(value)
+	}
+	return row
+}
+
+/*
+Write returns the line with the changed fields written in their width, truncated when the value is longer.
+Excluded fields are only padding. The fields that didn't change and the characters between the fields are kept.
+*/
+func (layout Layout) Write(line []rune, original []string, row []string, excluded []bool) []rune {
+	for index, field := range layout.Fields {
+		value := row[index]
+		if excluded[index] {
+			value = ""
+		} else if value == original[index] {
+			continue
+		}
+		end := field.start + field.length
+		if len(line) < end {
+			line = append(line, []rune(strings.Repeat(" ", end-len(line)))...)
+		}
+		copy(line[field.start:end], field.pad(value))
+	}
+	return line
+}
+
+/*
+	Helper functions
+*/
+// trim removes the padding around the value, a field that is only padding (e.g. 0000) keeps one padding character unless it's a space
+func (field Field) trim(value string) string {
+	var trimmed string
+	if field.rightAligned {
+		trimmed = strings.TrimLeft(value, string(field.padding))
+	} else {
+		trimmed = strings.TrimRight(value, string(field.padding))
+	}
+	if trimmed == "" && value != "" && field.padding != ' ' {
+		return string(field.padding)
+	}
+	return trimmed
+}
+
+// pad returns the value in the width of the field, the end of the value is cut when it doesn't fit
+func (field Field) pad(value string) []rune {
+	runes := []rune(value)
+	if len(runes) >= field.length {
+		return runes[:field.length]
+	}
+	padding := []rune(strings.Repeat(string(field.padding), field.length-len(runes)))
+	if field.rightAligned {
+		return append(padding, runes...)
+	}
+	return append(runes, padding...)
+}
@@ -0,0 +1,149 @@
+package transformfixedwidth
+
+import (
+	"bytes"
+	"lazy-lagoon/pkg/textencoding"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+	"lazy-lagoon/transformcsv"
+	"strings"
+)
+
+/*
+Step 1: execute transform, and store in output storage
+*/
+func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
+	/*
+		Downloading the file from the input storage type, decoded to UTF-8
+	*/
+	byteContent, encoding, err := storage.GetText(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	// The output is written in the encoding of the input unless set
+	if output.Encoding != "" {
+		encoding = output.Encoding
+	}
+	/*
+		Transforming the record lines
+	*/
+	byteContent, transformErr := ExecuteRules(byteContent, input.FixedWidth, rules)
+	if transformErr != nil {
+		return transformErr
+	}
+	byteContent, err = textencoding.Encode(byteContent, encoding, true)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	// Store the transformed lines in the output storage type
+	err = storage.StoreBytes(output, byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	return nil
+}
+
+/*
+Step 2: Transform the record lines as CSV rows with a column per field of the layout, and write the changed fields back in their width.
+The header lines, the empty lines, the line endings and the characters between the fields are left untouched.
+*/
+func ExecuteRules(byteContent []byte, settings *types.FixedWidthLayout, rules []types.Rule) ([]byte, *types.TransformError) {
+	layout, err := NewLayout(settings)
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error(), Key: "fixedWidth"}
+	}
+	plan, transformErr := transformcsv.Compile(layout.Header(), rules)
+	if transformErr != nil {
+		return nil, transformErr
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, len(byteContent)))
+	for index, line := range splitLines(byteContent) {
+		if index < layout.HeaderLines || strings.TrimSpace(line.text) == "" {
+			buffer.WriteString(line.text + line.ending)
+			continue
+		}
+		runes := []rune(line.text)
+		original := layout.Read(runes)
+		row, excluded, transformErr := plan.ExecuteFields(append([]string{}, original...))
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		buffer.WriteString(string(layout.Write(runes, original, row, excluded)) + line.ending)
+	}
+	return buffer.Bytes(), nil
+}
+
+/*
+Paths returns the names of the fields of the layout
+*/
+func Paths(settings *types.FixedWidthLayout) ([]string, error) {
+	layout, err := NewLayout(settings)
+	if err != nil {
+		return nil, err
+	}
+	return layout.Header(), nil
+}
+
+/*
+Pages splits the file into files of the header lines and linesPerPage record lines - used for preview
+*/
+func Pages(byteContent []byte, settings *types.FixedWidthLayout, linesPerPage int) ([][]byte, error) {
+	layout, err := NewLayout(settings)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitLines(byteContent)
+	header := bytes.NewBuffer(nil)
+	for index := 0; index < min(layout.HeaderLines, len(lines)); index++ {
+		header.WriteString(lines[index].text + lines[index].ending)
+	}
+	var pages [][]byte
+	page := bytes.NewBuffer(nil)
+	records := 0
+	for index := layout.HeaderLines; index < len(lines); index++ {
+		if strings.TrimSpace(lines[index].text) == "" {
+			continue
+		}
+		if records == 0 {
+			page.Write(header.Bytes())
+		}
+		page.WriteString(lines[index].text + lines[index].ending)
+		records++
+		if records == linesPerPage {
+			pages = append(pages, page.Bytes())
+			page = bytes.NewBuffer(nil)
+			records = 0
+		}
+	}
+	if records > 0 {
+		pages = append(pages, page.Bytes())
+	}
+	return pages, nil
+}
+
+/*
+	Helper functions
+*/
+// line is a line of the file without its line ending, \n or \r\n
+type line struct {
+	text   string
+	ending string
+}
+
+// splitLines returns the lines of the content, the last line has no ending when the file doesn't end with a line break
+func splitLines(byteContent []byte) []line {
+	lines := []line{}
+	for _, text := range strings.SplitAfter(string(byteContent), "\n") {
+		if text == "" {
+			continue
+		}
+		ending := ""
+		if strings.HasSuffix(text, "\r\n") {
+			ending = "\r\n"
+		} else if strings.HasSuffix(text, "\n") {
+			ending = "\n"
+		}
+		lines = append(lines, line{text: strings.TrimSuffix(text, ending), ending: ending})
+	}
+	return lines
+}
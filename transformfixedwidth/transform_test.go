@@ -0,0 +1,82 @@
+package transformfixedwidth
+
+import (
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+var settings = &types.FixedWidthLayout{
+	HeaderLines: 1,
+	Fields: []types.FixedWidthField{
+		{Name: "account", Start: 1, Length: 8},
+		{Name: "name", Start: 10, Length: 6},
+		{Name: "amount", Start: 16, Length: 7, Alignment: "RIGHT", Padding: "0"},
+	},
+}
+
+const content = "HDR20240101\r\n" +
+	"12345678 Ada   0001250\r\n" +
+	"87654321 Grace 0000000\r\n" +
+	"\r\n" +
+	"11112222 Zoë   0099999"
+
+func TestExecuteRules(t *testing.T) {
+	t.Run("fields read without their padding", func(t *testing.T) {
+		layout, err := NewLayout(settings)
+		if err != nil {
+			t.Fatalf("Failed to read layout: %v", err)
+		}
+		lines := splitLines([]byte(content))
+		assert.Equal(t, layout.Read([]rune(lines[1].text)), []string{"12345678", "Ada", "1250"})
+		assert.Equal(t, layout.Read([]rune(lines[2].text)), []string{"87654321", "Grace", "0"})
+		assert.Equal(t, layout.Read([]rune("123")), []string{"123", "", ""})
+	})
+
+	t.Run("changed fields written back in their width", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions:     []types.Expressions{{FieldName: "amount", Operator: "GT", Value: 1000}},
+			},
+			Actions: []types.Action{
+				{ActionType: "REDACT", FieldName: "name"},
+				{ActionType: "EXCLUDE", FieldName: "amount"},
+			},
+		}}
+		transformed, transformErr := ExecuteRules([]byte(content), settings, rules)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform: %v", transformErr.Message)
+		}
+		assert.Equal(t, string(transformed), "HDR20240101\r\n"+
+			"12345678 **reda0000000\r\n"+
+			"87654321 Grace 0000000\r\n"+
+			"\r\n"+
+			"11112222 **reda0000000")
+	})
+
+	t.Run("invalid layouts", func(t *testing.T) {
+		cases := []*types.FixedWidthLayout{
+			nil,
+			{Fields: []types.FixedWidthField{{Name: "a", Start: 0, Length: 2}}},
+			{Fields: []types.FixedWidthField{{Name: "a", Start: 1, Length: 2}, {Name: "b", Start: 2, Length: 2}}},
+			{Fields: []types.FixedWidthField{{Name: "a", Start: 1, Length: 2, Alignment: "CENTER"}}},
+			{Fields: []types.FixedWidthField{{Name: "a", Start: 1, Length: 2, Padding: "00"}}},
+		}
+		for _, testCase := range cases {
+			_, transformErr := ExecuteRules([]byte(content), testCase, nil)
+			assert.NotEqual(t, transformErr, nil)
+		}
+	})
+
+	t.Run("pages start with the header lines", func(t *testing.T) {
+		pages, err := Pages([]byte(content), settings, 2)
+		if err != nil {
+			t.Fatalf("Failed to paginate: %v", err)
+		}
+		assert.Equal(t, len(pages), 2)
+		assert.Equal(t, string(pages[1]), "HDR20240101\r\n11112222 Zoë   0099999")
+	})
+}
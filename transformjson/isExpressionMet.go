@@ -3,52 +3,71 @@ package transformjson
 import (
 	"lazy-lagoon/pkg/expressions"
 	"lazy-lagoon/pkg/types"
-	"strconv"
-	"strings"
 )
 
 /*
 IsExpressionMet checks if the given expression is met
 */
 func IsExpressionMet(expression types.Expression, indexes []int, ruleIndex int, jsonDocument any) (bool, *types.TransformError) {
+	compiled, transformErr := compileExpression(expression, ruleIndex)
+	if transformErr != nil {
+		return false, transformErr
+	}
+	return compiled.IsMet(indexes, ruleIndex, jsonDocument)
+}
+
+/*
+IsMet checks if the compiled expression is met, the * of the expression pointers are replaced by the indexes traversed so far.
+The * of the array a quantifier (ALL, NONE, COUNT) applies to is kept, the quantifier is checked on all of its elements
+*/
+func (expression compiledExpression) IsMet(indexes []int, ruleIndex int, jsonDocument any) (bool, *types.TransformError) {
 	// If the expression is nil then return true
-	if expression.Expressions == nil {
+	if expression.always {
 		return true, nil
 	}
 
 	// For AND, start optimistic; for OR start pessimistic
-	expressionMet := expression.LogicalOperator != "OR"
+	expressionMet := expression.logicalOperator != "OR"
 	isOperatorResultMet := false
 
-	for expressionIndex, exp := range expression.Expressions {
-		// Process the field name with indexes if needed
-		fieldName := exp.FieldName
-		if fieldName == "" {
+	for _, condition := range expression.conditions {
+		expressionIndex := condition.expressionIndex
+		if condition.pointer == nil {
 			// SKIP the expression if the field name is empty
 			return false, nil
 		}
-		if len(indexes) > 0 {
-			fieldName = replaceIndexes(fieldName, indexes)
+		// Process the pointer with indexes if needed
+		pointerIndexes := indexes
+		if condition.substitutedIndexes >= 0 && len(indexes) > condition.substitutedIndexes {
+			pointerIndexes = indexes[:condition.substitutedIndexes]
 		}
+		pointer, hasWildcard := substituteIndexes(condition.pointer, pointerIndexes)
 
-		// If the fieldName does not contain a wildcard.
-		if !strings.Contains(fieldName, "*") {
+		// If the pointer does not contain a wildcard.
+		if !hasWildcard {
 			/*
 				Checking the expression on the single value of the field.
 			*/
-			// Get the value from the JSON document
-			expressionValue, err := getExpressionValue(fieldName, jsonDocument)
-			if err != nil {
-				return false, &types.TransformError{
-					Message:         err.Error(),
-					RuleIndex:       &ruleIndex,
-					ExpressionIndex: &expressionIndex,
-					Key:             "fieldName",
+			// Get the value from the JSON document, size operators need the raw array/object
+			var expressionValue any
+			if expressions.IsSizeOperator(condition.Operator) {
+				expressionValue, _ = GetPointerNode(pointer, jsonDocument)
+			} else {
+				var err error
+				expressionValue, err = GetPointerValue(pointer, jsonDocument)
+				if err != nil {
+					return false, &types.TransformError{
+						Message:         err.Error(),
+						RuleIndex:       &ruleIndex,
+						ExpressionIndex: &expressionIndex,
+						Key:             "fieldName",
+					}
 				}
 			}
 
 			// Check if the operator condition is met
-			isOperatorResultMet, err = expressions.IsOperatorResultMet(exp.Operator, exp.Value, expressionValue)
+			var err error
+			isOperatorResultMet, err = expressions.IsOperatorResultMet(condition.Operator, condition.Value, expressionValue)
 			if err != nil {
 				return false, &types.TransformError{
 					Message:         err.Error(),
@@ -59,10 +78,10 @@ func IsExpressionMet(expression types.Expression, indexes []int, ruleIndex int,
 			}
 		} else {
 			/*
-				Checking the array of values for the case where an expression has extra arrays, if any of the values meet the expression then return true. (Logical OR)
+				Checking the array of values for the case where an expression has extra arrays, the quantifier decides how many of the values need to meet the expression (ANY by default)
 			*/
 			// Get the values from the JSON document
-			expressionArrayValues, err := getExpressionArrayValues(fieldName, jsonDocument)
+			expressionArrayValues, err := GetPointerArrayValues(pointer, jsonDocument)
 			if err != nil {
 				return false, &types.TransformError{
 					Message:         err.Error(),
@@ -73,7 +92,7 @@ func IsExpressionMet(expression types.Expression, indexes []int, ruleIndex int,
 			}
 
 			// Check if the operator condition is met
-			isOperatorResultMet, err = expressions.IsOperatorArrayResultMet(exp.Operator, exp.Value, expressionArrayValues)
+			isOperatorResultMet, err = expressions.IsQuantifiedArrayResultMet(condition.Quantifier, condition.Operator, condition.Value, expressionArrayValues, condition.CountOperator, condition.Count)
 			if err != nil {
 				return false, &types.TransformError{
 					Message:         err.Error(),
@@ -87,14 +106,14 @@ func IsExpressionMet(expression types.Expression, indexes []int, ruleIndex int,
 		// Handle logical operators
 		if isOperatorResultMet {
 			// For OR operations, return true immediately if any condition is met
-			if expression.LogicalOperator == "OR" {
+			if expression.logicalOperator == "OR" {
 				return true, nil
 			}
 			// For AND operations, mark that at least one condition is met
 			expressionMet = true
 		} else {
 			// For AND operations, return false immediately if any condition is not met
-			if expression.LogicalOperator == "AND" {
+			if expression.logicalOperator == "AND" {
 				return false, nil
 			}
 		}
@@ -102,46 +121,3 @@ func IsExpressionMet(expression types.Expression, indexes []int, ruleIndex int,
 
 	return expressionMet, nil
 }
-
-// replaceIndexes replaces all * characters in the field name with the corresponding index
-func replaceIndexes(fieldName string, indexes []int) string {
-	result := fieldName
-	for _, index := range indexes {
-		result = strings.Replace(result, "*", strconv.Itoa(index), 1)
-	}
-	return result
-}
-
-// getExpressionArrayValues gets the values from the JSON document using the field name
-func getExpressionArrayValues(fieldName string, jsonDocument any) ([]any, error) {
-	// Make a pointer to the field
-	expressionPointer, err := MakePointer(fieldName)
-	if err != nil {
-		return nil, err
-	}
-
-	// Get the value from the pointer
-	expressionValues, err := GetPointerArrayValues(expressionPointer, jsonDocument)
-	if err != nil {
-		return nil, err
-	}
-
-	return expressionValues, nil
-}
-
-// getExpressionValue gets the value from the JSON document using the field name
-func getExpressionValue(fieldName string, jsonDocument any) (any, error) {
-	// Make a pointer to the field
-	expressionPointer, err := MakePointer(fieldName)
-	if err != nil {
-		return nil, err
-	}
-
-	// Get the value from the pointer
-	expressionValue, err := GetPointerValue(expressionPointer, jsonDocument)
-	if err != nil {
-		return nil, err
-	}
-
-	return expressionValue, nil
-}
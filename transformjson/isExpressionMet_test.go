@@ -71,4 +71,71 @@ func TestExpressions(t *testing.T) {
 		}
 		assert.Equal(t, met, true)
 	})
+
+	// Test Case 3: Quantifiers on wildcard arrays
+	t.Run("quantifiers on wildcard arrays", func(t *testing.T) {
+		testCases := []struct {
+			name       string
+			expression types.Expressions
+			indexes    []int
+			expected   bool
+		}{
+			{"ALL friends are older than 25", types.Expressions{FieldName: "friends[*].age", Operator: "GT", Value: 25, Quantifier: "ALL"}, []int{}, true},
+			{"ALL friends are older than 30", types.Expressions{FieldName: "friends[*].age", Operator: "GT", Value: 30, Quantifier: "ALL"}, []int{}, false},
+			{"NONE of the friends are called Carol", types.Expressions{FieldName: "friends[*].name", Operator: "EQ", Value: "Carol", Quantifier: "NONE"}, []int{}, true},
+			{"NONE of the friends are called Bob", types.Expressions{FieldName: "friends[*].name", Operator: "EQ", Value: "Bob", Quantifier: "NONE"}, []int{}, false},
+			{"COUNT of roles is greater than 3", types.Expressions{FieldName: "roles[*]", Operator: "EXISTS", Value: true, Quantifier: "COUNT", CountOperator: "GT", Count: 3}, []int{}, true},
+			{"COUNT of email contacts equals 1 for friend 0", types.Expressions{FieldName: "friends[*].contacts[*].type", Operator: "EQ", Value: "email", Quantifier: "COUNT", CountOperator: "EQ", Count: 1}, []int{0}, true},
+			{"ALL contacts are emails for friend 1", types.Expressions{FieldName: "friends[*].contacts[*].type", Operator: "EQ", Value: "email", Quantifier: "ALL"}, []int{1}, false},
+		}
+		for _, testCase := range testCases {
+			expression := types.Expression{
+				Expressions:     []types.Expressions{testCase.expression},
+				LogicalOperator: "AND",
+			}
+			met, err := IsExpressionMet(expression, testCase.indexes, 0, jsonDocument)
+			if err != nil {
+				t.Fatalf("%s: failed to check if expression is met: %v", testCase.name, err)
+			}
+			assert.Equal(t, met, testCase.expected)
+		}
+	})
+
+	// Test Case 4: Size operators on arrays and strings
+	t.Run("size operators", func(t *testing.T) {
+		testCases := []struct {
+			name       string
+			expression types.Expressions
+			expected   bool
+		}{
+			{"more than 3 roles", types.Expressions{FieldName: "roles", Operator: "SIZE_GT", Value: 3}, true},
+			{"exactly 2 friends", types.Expressions{FieldName: "friends", Operator: "SIZE_EQ", Value: 2}, true},
+			{"name shorter than 4 characters", types.Expressions{FieldName: "name", Operator: "SIZE_LT", Value: 4}, false},
+			{"missing field has a size of 0", types.Expressions{FieldName: "addresses", Operator: "SIZE_EQ", Value: 0}, true},
+			{"ANY friend with more than 1 contact", types.Expressions{FieldName: "friends[*].contacts", Operator: "SIZE_GT", Value: 1}, true},
+		}
+		for _, testCase := range testCases {
+			expression := types.Expression{
+				Expressions:     []types.Expressions{testCase.expression},
+				LogicalOperator: "AND",
+			}
+			met, err := IsExpressionMet(expression, []int{}, 0, jsonDocument)
+			if err != nil {
+				t.Fatalf("%s: failed to check if expression is met: %v", testCase.name, err)
+			}
+			assert.Equal(t, met, testCase.expected)
+		}
+	})
+
+	t.Run("invalid quantifier", func(t *testing.T) {
+		expression := types.Expression{
+			Expressions: []types.Expressions{
+				{FieldName: "roles[*]", Operator: "EQ", Value: "admin", Quantifier: "MOST"},
+			},
+			LogicalOperator: "AND",
+		}
+		_, err := IsExpressionMet(expression, []int{}, 0, jsonDocument)
+		assert.NotEqual(t, err, nil)
+		assert.Equal(t, err.Key, "quantifier")
+	})
 }
@@ -0,0 +1,107 @@
+package transformjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"lazy-lagoon/pkg/types"
+	"strings"
+)
+
+// Styles of the JSON output
+const (
+	StyleSource  = "SOURCE"
+	StyleCompact = "COMPACT"
+	StyleIndent  = "INDENT"
+)
+
+/*
+Layout is how a JSON document is written
+*/
+type Layout struct {
+	// Written once per level of the nested values, every value is on its own line when not compact
+	Indent  string
+	Compact bool
+	// The document ends with a newline
+	TrailingNewline bool
+}
+
+// DefaultLayout indents with tabs, used when there is no JSON source to keep the layout of
+var DefaultLayout = Layout{Indent: "\t"}
+
+/*
+DetectLayout returns the layout of the JSON content: compact when the document is on one line,
+otherwise indented with the spaces or tabs of the first indented line
+*/
+func DetectLayout(content []byte) Layout {
+	layout := Layout{TrailingNewline: bytes.HasSuffix(content, []byte("\n"))}
+	document := bytes.TrimSpace(content)
+	if len(document) == 0 || (document[0] != '{' && document[0] != '[') {
+		layout.Compact = true
+		return layout
+	}
+	// Strings can't have line breaks, the first one is between two values
+	lineBreak := bytes.IndexByte(document, '\n')
+	if lineBreak < 0 {
+		layout.Compact = true
+		return layout
+	}
+	line := document[lineBreak+1:]
+	indentEnd := 0
+	for indentEnd < len(line) && (line[indentEnd] == ' ' || line[indentEnd] == '\t') {
+		indentEnd++
+	}
+	layout.Indent = string(line[:indentEnd])
+	return layout
+}
+
+/*
+OutputLayout resolves the layout of the output from the format settings, SOURCE keeps the layout of the source when there is one
+*/
+func OutputLayout(format *types.JsonFormat, source []byte) (Layout, error) {
+	sourceLayout := DefaultLayout
+	if source != nil {
+		sourceLayout = DetectLayout(source)
+	}
+	if format == nil {
+		return sourceLayout, nil
+	}
+	switch strings.ToUpper(format.Style) {
+	case "", StyleSource:
+		return sourceLayout, nil
+	case StyleCompact:
+		return Layout{Compact: true, TrailingNewline: sourceLayout.TrailingNewline}, nil
+	case StyleIndent:
+		indent := format.Indent
+		if indent == "" {
+			indent = DefaultLayout.Indent
+		}
+		if strings.Trim(indent, " \t") != "" {
+			return Layout{}, fmt.Errorf("indent can only have spaces and tabs")
+		}
+		return Layout{Indent: indent, TrailingNewline: sourceLayout.TrailingNewline}, nil
+	}
+	return Layout{}, fmt.Errorf("style %s not supported, use SOURCE, COMPACT or INDENT", format.Style)
+}
+
+/*
+Format writes the JSON document in the layout, the keys of the objects keep their order
+*/
+func Format(jsonDocument any, layout Layout) ([]byte, error) {
+	content, err := marshal(jsonDocument)
+	if err != nil {
+		return nil, err
+	}
+	if !layout.Compact {
+		var indented bytes.Buffer
+		err = json.Indent(&indented, content, "", layout.Indent)
+		if err != nil {
+			return nil, err
+		}
+		content = indented.Bytes()
+	}
+	if layout.TrailingNewline {
+		content = append(content, '\n')
+	}
+	return content, nil
+}
@@ -0,0 +1,70 @@
+package transformjson
+
+import (
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestLayout(t *testing.T) {
+	content := []byte("{\n  \"zeta\": \"a<b & c\",\n  \"alpha\": {\n    \"owner\": \"Ada\",\n    \"id\": 2\n  },\n  \"middle\": [1, 2]\n}\n")
+
+	t.Run("keys keep their order after the rules", func(t *testing.T) {
+		jsonDocument, err := ToJson(content)
+		if err != nil {
+			t.Fatalf("Failed to convert to json: %v", err)
+		}
+		mutatedJson, transformErr := ExecuteRules(jsonDocument, []types.Rule{{
+			Actions: []types.Action{
+				{ActionType: "EXCLUDE", FieldName: "alpha.owner"},
+				{ActionType: "REDACT", FieldName: "zeta"},
+			},
+		}})
+		if transformErr != nil {
+			t.Fatalf("Failed to execute rule: %v", transformErr)
+		}
+		byteContent, err := FromJsonl(mutatedJson)
+		if err != nil {
+			t.Fatalf("Failed to convert json to bytes: %v", err)
+		}
+		assert.Equal(t, string(byteContent), `{"zeta":"**redacted**","alpha":{"id":2},"middle":[1,2]}`)
+
+		// The source is written back as it was
+		byteContent, err = Format(jsonDocument, DetectLayout(content))
+		if err != nil {
+			t.Fatalf("Failed to convert json to bytes: %v", err)
+		}
+		assert.Equal(t, string(byteContent), "{\n  \"zeta\": \"a<b & c\",\n  \"alpha\": {\n    \"owner\": \"Ada\",\n    \"id\": 2\n  },\n  \"middle\": [\n    1,\n    2\n  ]\n}\n")
+	})
+
+	t.Run("layout detected or set", func(t *testing.T) {
+		assert.Equal(t, DetectLayout(content), Layout{Indent: "  ", TrailingNewline: true})
+		assert.Equal(t, DetectLayout([]byte(`{"a": [1, 2]}`)), Layout{Compact: true})
+		assert.Equal(t, DetectLayout([]byte("[\n\t{}\n]")), Layout{Indent: "\t"})
+
+		layout, err := OutputLayout(&types.JsonFormat{Style: "compact"}, content)
+		if err != nil {
+			t.Fatalf("Failed to resolve layout: %v", err)
+		}
+		assert.Equal(t, layout, Layout{Compact: true, TrailingNewline: true})
+
+		layout, err = OutputLayout(&types.JsonFormat{Style: "INDENT", Indent: "    "}, nil)
+		if err != nil {
+			t.Fatalf("Failed to resolve layout: %v", err)
+		}
+		assert.Equal(t, layout, Layout{Indent: "    "})
+
+		layout, err = OutputLayout(nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to resolve layout: %v", err)
+		}
+		assert.Equal(t, layout, DefaultLayout)
+
+		_, err = OutputLayout(&types.JsonFormat{Style: "INDENT", Indent: "--"}, nil)
+		assert.NotEqual(t, err, nil)
+		_, err = OutputLayout(&types.JsonFormat{Style: "PRETTY"}, nil)
+		assert.NotEqual(t, err, nil)
+	})
+}
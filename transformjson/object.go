@@ -0,0 +1,155 @@
+package transformjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+/*
+Object is a JSON object that keeps the order of its keys, so the transformed document is written back in the order of the input
+*/
+type Object struct {
+	keys   []string
+	values map[string]any
+}
+
+// NewObject returns an empty object
+func NewObject() *Object {
+	return &Object{values: map[string]any{}}
+}
+
+// Keys returns the keys in the order they were added
+func (object *Object) Keys() []string {
+	return object.keys
+}
+
+// Len returns the number of keys
+func (object *Object) Len() int {
+	return len(object.keys)
+}
+
+// Get returns the value of the key, exists is false when the object doesn't have it
+func (object *Object) Get(key string) (value any, exists bool) {
+	value, exists = object.values[key]
+	return value, exists
+}
+
+// Set changes the value of the key, a new key is added at the end
+func (object *Object) Set(key string, value any) {
+	if _, exists := object.values[key]; !exists {
+		object.keys = append(object.keys, key)
+	}
+	object.values[key] = value
+}
+
+// Delete removes the key, the other keys keep their order
+func (object *Object) Delete(key string) {
+	if _, exists := object.values[key]; !exists {
+		return
+	}
+	delete(object.values, key)
+	object.keys = slices.DeleteFunc(object.keys, func(objectKey string) bool { return objectKey == key })
+}
+
+// MarshalJSON writes the keys in order, without escaping HTML characters
+func (object *Object) MarshalJSON() ([]byte, error) {
+	buffer := bytes.NewBuffer([]byte{'{'})
+	for index, key := range object.keys {
+		if index > 0 {
+			buffer.WriteByte(',')
+		}
+		keyBytes, err := marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		valueBytes, err := marshal(object.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(keyBytes)
+		buffer.WriteByte(':')
+		buffer.Write(valueBytes)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+/*
+	Helper functions
+*/
+// decodeValue reads the next value of the decoder, objects are read into an Object to keep the order of their keys
+func decodeValue(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	return decodeToken(decoder, token)
+}
+
+// decodeToken reads the value that starts with the token already read from the decoder
+func decodeToken(decoder *json.Decoder, token json.Token) (any, error) {
+	delim, isDelim := token.(json.Delim)
+	if !isDelim {
+		// Strings, numbers, booleans and null
+		return token, nil
+	}
+	switch delim {
+	case '{':
+		object := NewObject()
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, isString := keyToken.(string)
+			if !isString {
+				return nil, fmt.Errorf("invalid object key")
+			}
+			value, err := decodeValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object.Set(key, value)
+		}
+		// Reading the closing }
+		_, err := decoder.Token()
+		return object, err
+	case '[':
+		array := []any{}
+		for decoder.More() {
+			value, err := decodeValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		// Reading the closing ]
+		_, err := decoder.Token()
+		return array, err
+	}
+	return nil, fmt.Errorf("unexpected %v", delim)
+}
+
+// marshal is json.Marshal without escaping <, > and &, they are written as they were in the input
+func marshal(value any) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	// The encoder ends every value with a newline
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// readEnd checks only whitespace follows the document
+func readEnd(decoder *json.Decoder) error {
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("unmarshalling json error, not valid json")
+	}
+	return nil
+}
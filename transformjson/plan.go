@@ -0,0 +1,412 @@
+package transformjson
+
+import (
+	"fmt"
+	"lazy-lagoon/pkg/expressions"
+	"lazy-lagoon/pkg/types"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+/*
+Plan holds the rules compiled once per request. Pointers are parsed and operators validated up front,
+so each document is evaluated against all the rules in a single pass without re-parsing any paths.
+*/
+type Plan struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	ruleIndex      int
+	priority       int
+	stopProcessing bool
+	expression     compiledExpression
+	actions        []compiledAction
+	elseActions    []compiledAction
+}
+
+type compiledAction struct {
+	actionIndex int
+	actionType  string
+	pointer     []string
+}
+
+type compiledExpression struct {
+	// Rules without expressions are applied everywhere
+	always          bool
+	logicalOperator string
+	conditions      []compiledCondition
+}
+
+type compiledCondition struct {
+	expressionIndex int
+	// nil when the field name is empty, the expression is then considered not met
+	pointer []string
+	// The number of indexes of the action replacing the selectors of the pointer, -1 for all of them.
+	// The array a quantifier applies to keeps its selector so the quantifier is checked on all of its elements
+	substitutedIndexes int
+	types.Expressions
+}
+
+/*
+Compile parses the pointers of every action and expression, validates the operators and orders the rules by priority
+*/
+func Compile(rules []types.Rule) (*Plan, *types.TransformError) {
+	plan := &Plan{}
+	for ruleIndex, rule := range rules {
+		expression, transformErr := compileExpression(rule.Expression, ruleIndex)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		actions, transformErr := compileActions(rule.Actions, ruleIndex, false)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		elseActions, transformErr := compileActions(rule.ElseActions, ruleIndex, true)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		plan.rules = append(plan.rules, compiledRule{
+			ruleIndex:      ruleIndex,
+			priority:       rule.Priority,
+			stopProcessing: rule.StopProcessing,
+			expression:     expression,
+			actions:        actions,
+			elseActions:    elseActions,
+		})
+	}
+	// Higher priorities run first, the same priority keeps the request order
+	sort.SliceStable(plan.rules, func(i, j int) bool {
+		return plan.rules[i].priority > plan.rules[j].priority
+	})
+	return plan, nil
+}
+
+// compileActions parses the action pointers, else actions report their index as elseActionIndex
+func compileActions(actions []types.Action, ruleIndex int, isElse bool) ([]compiledAction, *types.TransformError) {
+	var compiled []compiledAction
+	for actionIndex, action := range actions {
+		if action.FieldName == "" {
+			// SKIP the action if the field name is empty
+			continue
+		}
+		pointer, err := MakePointer(action.FieldName)
+		if err != nil {
+			transformErr := &types.TransformError{
+				Message:   err.Error(),
+				RuleIndex: &ruleIndex,
+				Key:       "fieldName",
+			}
+			if isElse {
+				transformErr.ElseActionIndex = &actionIndex
+			} else {
+				transformErr.ActionIndex = &actionIndex
+			}
+			return nil, transformErr
+		}
+		compiled = append(compiled, compiledAction{
+			actionIndex: actionIndex,
+			actionType:  action.ActionType,
+			pointer:     pointer,
+		})
+	}
+	return compiled, nil
+}
+
+// compileExpression parses the expression pointers and validates the operators and quantifiers
+func compileExpression(expression types.Expression, ruleIndex int) (compiledExpression, *types.TransformError) {
+	if expression.Expressions == nil {
+		return compiledExpression{always: true}, nil
+	}
+	compiled := compiledExpression{logicalOperator: expression.LogicalOperator}
+	for expressionIndex, exp := range expression.Expressions {
+		condition := compiledCondition{expressionIndex: expressionIndex, substitutedIndexes: -1, Expressions: exp}
+		if exp.FieldName == "" {
+			// Expressions without a field name are never met, nothing else to validate
+			compiled.conditions = append(compiled.conditions, condition)
+			continue
+		}
+		pointer, err := MakePointer(exp.FieldName)
+		if err != nil {
+			return compiledExpression{}, &types.TransformError{
+				Message:         err.Error(),
+				RuleIndex:       &ruleIndex,
+				ExpressionIndex: &expressionIndex,
+				Key:             "fieldName",
+			}
+		}
+		condition.pointer = pointer
+		if !expressions.IsValidOperator(exp.Operator) {
+			return compiledExpression{}, &types.TransformError{
+				Message:         "invalid operator: " + exp.Operator,
+				RuleIndex:       &ruleIndex,
+				ExpressionIndex: &expressionIndex,
+				Key:             "operator",
+			}
+		}
+		if !expressions.IsValidQuantifier(exp.Quantifier) {
+			return compiledExpression{}, &types.TransformError{
+				Message:         "invalid quantifier: " + exp.Quantifier,
+				RuleIndex:       &ruleIndex,
+				ExpressionIndex: &expressionIndex,
+				Key:             "quantifier",
+			}
+		}
+		if exp.Quantifier != "" && exp.Quantifier != "ANY" {
+			substitutedIndexes, isQuantifiable := quantifiedIndexes(pointer)
+			if !isQuantifiable {
+				return compiledExpression{}, &types.TransformError{
+					Message:         "quantifier " + exp.Quantifier + " needs a *, slice, filter or recursive descent in the field name",
+					RuleIndex:       &ruleIndex,
+					ExpressionIndex: &expressionIndex,
+					Key:             "quantifier",
+				}
+			}
+			condition.substitutedIndexes = substitutedIndexes
+		}
+		compiled.conditions = append(compiled.conditions, condition)
+	}
+	return compiled, nil
+}
+
+/*
+Execute applies the plan to the document, the actions where the expression is met and the else actions where it isn't.
+A matching rule with stopProcessing ends the evaluation of the elements it matched, e.g. a rule on customers[*].internal stops the rules
+only for customers/0 when the first customer is internal; the elements of other arrays are still transformed.
+Without a *, slice or filter in its expression the rule stops the whole document. The match is checked before its actions run.
+IMPORTANT: This function mutates the document, copy it first if the original is still needed
+*/
+func (plan *Plan) Execute(jsonDocument any) (any, *types.TransformError) {
+	// The paths of the elements already stopped (e.g. customers/0), the later rules leave them as they are
+	stopped := [][]string{}
+	for _, rule := range plan.rules {
+		isMet := func(indexes []int) (bool, *types.TransformError) {
+			return rule.expression.IsMet(indexes, rule.ruleIndex, jsonDocument)
+		}
+		var matched [][]string
+		if rule.stopProcessing {
+			var transformErr *types.TransformError
+			matched, transformErr = rule.matchedPaths(jsonDocument, isMet)
+			if transformErr != nil {
+				return nil, transformErr
+			}
+		}
+		for _, action := range rule.actions {
+			isActionMet := func(indexes []int) (bool, *types.TransformError) {
+				if path, _ := actionPath(jsonDocument, action.pointer, indexes); isStopped(stopped, path) {
+					return false, nil
+				}
+				return isMet(indexes)
+			}
+			transformErr := mutate(jsonDocument, action.pointer, isActionMet, false, action.actionType, []int{}, rule.ruleIndex, action.actionIndex)
+			if transformErr != nil {
+				return nil, transformErr
+			}
+		}
+		for _, action := range rule.elseActions {
+			isActionMet := func(indexes []int) (bool, *types.TransformError) {
+				// Stopped elements are reported as met so the else actions skip them,
+				// the arrays holding some of them are then checked element by element
+				path, isArray := actionPath(jsonDocument, action.pointer, indexes)
+				if isStopped(stopped, path) || (isArray && hasStopped(stopped, path)) {
+					return true, nil
+				}
+				return isMet(indexes)
+			}
+			transformErr := mutate(jsonDocument, action.pointer, isActionMet, true, action.actionType, []int{}, rule.ruleIndex, action.actionIndex)
+			if transformErr != nil {
+				if transformErr.ActionIndex != nil {
+					transformErr.ElseActionIndex, transformErr.ActionIndex = transformErr.ActionIndex, nil
+				}
+				return nil, transformErr
+			}
+		}
+		stopped = append(stopped, matched...)
+		if isStopped(stopped, []string{}) {
+			// No other rule is applied to this document
+			break
+		}
+	}
+	return jsonDocument, nil
+}
+
+/*
+	Helper functions
+*/
+// matchedPaths returns the paths of the elements where the expression is met, e.g. customers/0 for customers[*].internal.
+// The elements are the ones selected by the *, slices and filters of the expression pointers,
+// an expression without them is checked on the whole document (an empty path)
+func (rule compiledRule) matchedPaths(jsonDocument any, isMet func(indexes []int) (bool, *types.TransformError)) ([][]string, *types.TransformError) {
+	candidates := [][]int{}
+	for _, condition := range rule.expression.conditions {
+		candidates = append(candidates, elementIndexes(jsonDocument, condition.pointer, []int{})...)
+	}
+	if len(candidates) == 0 {
+		candidates = append(candidates, []int{})
+	}
+	matched := [][]string{}
+	seen := map[string]bool{}
+	for _, indexes := range candidates {
+		key := fmt.Sprint(indexes)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		met, transformErr := isMet(indexes)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		if !met {
+			continue
+		}
+		if len(indexes) == 0 {
+			matched = append(matched, []string{})
+			continue
+		}
+		// The element is stopped in every array of the expression the indexes select it in
+		for _, condition := range rule.expression.conditions {
+			if path := elementPath(condition.pointer, indexes); path != nil {
+				matched = append(matched, path)
+			}
+		}
+	}
+	return matched, nil
+}
+
+// elementPath returns the pointer up to the last selector replaced by the indexes, e.g. customers/0 for customers[*].internal and [0].
+// nil when the pointer has no selector before a recursive descent
+func elementPath(pointer []string, indexes []int) []string {
+	path := []string{}
+	end, position := 0, 0
+	for _, token := range pointer {
+		if token == descent || position == len(indexes) {
+			break
+		}
+		if IsSelector(token) {
+			token = strconv.Itoa(indexes[position])
+			position++
+			end = len(path) + 1
+		}
+		path = append(path, token)
+	}
+	if end == 0 {
+		return nil
+	}
+	return path[:end]
+}
+
+// actionPath returns the path of the node the action is on with the indexes traversed so far, the arrays take the indexes like mutate does.
+// isArray is true when the path ends on an array the action selects elements of, the path stops at a recursive descent
+func actionPath(node any, pointer []string, indexes []int) (path []string, isArray bool) {
+	path = []string{}
+	position := 0
+	for _, token := range pointer {
+		if token == descent {
+			return path, false
+		}
+		switch typedNode := node.(type) {
+		case []any:
+			if position == len(indexes) {
+				return path, true
+			}
+			index := indexes[position]
+			position++
+			if index < 0 || index >= len(typedNode) {
+				return path, false
+			}
+			path = append(path, strconv.Itoa(index))
+			node = typedNode[index]
+		case *Object:
+			path = append(path, token)
+			node, _ = typedNode.Get(token)
+		case map[string]any:
+			path = append(path, token)
+			node = typedNode[token]
+		default:
+			return path, false
+		}
+	}
+	return path, false
+}
+
+// elementIndexes returns the indexes selected by the *, slices and filters of the pointer up to the last one or a recursive descent.
+// The elements missing a key on the way have nothing to stop and are left out
+func elementIndexes(node any, pointer []string, indexes []int) [][]int {
+	selector := slices.IndexFunc(pointer, func(token string) bool { return token == descent || IsSelector(token) })
+	if selector < 0 || pointer[selector] == descent {
+		return [][]int{indexes}
+	}
+	array, _ := GetPointerNode(pointer[:selector], node)
+	elements, isArray := array.([]any)
+	if !isArray {
+		return nil
+	}
+	selected, err := selectIndexes(pointer[selector], elements)
+	if err != nil {
+		return nil
+	}
+	found := [][]int{}
+	for _, index := range selected {
+		found = append(found, elementIndexes(elements[index], pointer[selector+1:], append(slices.Clone(indexes), index))...)
+	}
+	return found
+}
+
+// quantifiedIndexes returns the number of selectors replaced by the indexes of the action, all of them but the last one
+// which is the array the quantifier applies to, or all of them when a recursive descent follows. isQuantifiable is false without any
+func quantifiedIndexes(pointer []string) (substitutedIndexes int, isQuantifiable bool) {
+	selectors := 0
+	for _, token := range pointer {
+		if token == descent {
+			return selectors, true
+		}
+		if IsSelector(token) {
+			selectors++
+		}
+	}
+	return selectors - 1, selectors > 0
+}
+
+// isStopped checks if the path is under the elements stopped by a rule
+func isStopped(stopped [][]string, path []string) bool {
+	for _, stoppedPath := range stopped {
+		if len(path) >= len(stoppedPath) && slices.Equal(path[:len(stoppedPath)], stoppedPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasStopped checks if some of the elements under the path are stopped
+func hasStopped(stopped [][]string, path []string) bool {
+	for _, stoppedPath := range stopped {
+		if len(stoppedPath) > len(path) && slices.Equal(stoppedPath[:len(path)], path) {
+			return true
+		}
+	}
+	return false
+}
+
+// substituteIndexes replaces the *, slice and filter tokens of the pointer with the indexes traversed by the action.
+// The tokens after a recursive descent are left as they are, they are matched at any depth
+func substituteIndexes(pointer []string, indexes []int) (tokens []string, hasWildcard bool) {
+	tokens = make([]string, len(pointer))
+	position := 0
+	for i, token := range pointer {
+		if token == descent {
+			copy(tokens[i:], pointer[i:])
+			return tokens, true
+		}
+		if IsSelector(token) {
+			if position < len(indexes) {
+				token = strconv.Itoa(indexes[position])
+				position++
+			} else {
+				hasWildcard = true
+			}
+		}
+		tokens[i] = token
+	}
+	return tokens, hasWildcard
+}
@@ -0,0 +1,260 @@
+package transformjson
+
+import (
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestCompile(t *testing.T) {
+	t.Run("malformed action path", func(t *testing.T) {
+		rules := []types.Rule{{
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "friends...name"}},
+		}}
+		_, err := Compile(rules)
+		assert.NotEqual(t, err, nil)
+		assert.Equal(t, *err.ActionIndex, 0)
+		assert.Equal(t, err.Key, "fieldName")
+	})
+
+	t.Run("invalid operator is reported before execution", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions: []types.Expressions{
+					{FieldName: "name", Operator: "EQ", Value: "John"},
+					{FieldName: "age", Operator: "BETWEEN", Value: 30},
+				},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "name"}},
+		}}
+		_, err := Compile(rules)
+		assert.NotEqual(t, err, nil)
+		assert.Equal(t, *err.ExpressionIndex, 1)
+		assert.Equal(t, err.Key, "operator")
+	})
+
+	t.Run("plan is reused across documents", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions: []types.Expressions{
+					{FieldName: "items[*].type", Operator: "EQ", Value: "card"},
+				},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "items[*].number"}},
+		}}
+		plan, err := Compile(rules)
+		if err != nil {
+			t.Fatalf("Failed to compile rules: %v", err)
+		}
+		for _, line := range []string{
+			`{"items":[{"type":"card","number":"4111"},{"type":"cash","number":"1"}]}`,
+			`{"items":[{"type":"cash","number":"2"},{"type":"card","number":"5500"}]}`,
+		} {
+			document, parseErr := ToJson([]byte(line))
+			if parseErr != nil {
+				t.Fatalf("Failed to parse json: %v", parseErr)
+			}
+			mutated, err := plan.Execute(document)
+			if err != nil {
+				t.Fatalf("Failed to execute plan: %v", err)
+			}
+			values, pointerErr := GetPointerArrayValues([]string{"items", "*", "number"}, mutated)
+			if pointerErr != nil {
+				t.Fatalf("Failed to get pointer values: %v", pointerErr)
+			}
+			redacted := 0
+			for _, value := range values {
+				if value == "**redacted**" {
+					redacted++
+				}
+			}
+			assert.Equal(t, redacted, 1)
+		}
+	})
+
+	t.Run("else actions, priorities and stop processing", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				// Never reached for internal documents
+				Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "owner"}},
+			},
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions: []types.Expressions{
+						{FieldName: "internal", Operator: "EQ", Value: true},
+					},
+				},
+				ElseActions:    []types.Action{{ActionType: "REDACT", FieldName: "items[*].number"}},
+				Priority:       1,
+				StopProcessing: true,
+			},
+		}
+		plan, err := Compile(rules)
+		if err != nil {
+			t.Fatalf("Failed to compile rules: %v", err)
+		}
+		for line, expected := range map[string]string{
+			`{"internal":true,"owner":"ops","items":[{"number":"4111"}]}`:  `{"internal":true,"owner":"ops","items":[{"number":"4111"}]}`,
+			`{"internal":false,"owner":"ops","items":[{"number":"4111"}]}`: `{"internal":false,"items":[{"number":"**redacted**"}]}`,
+		} {
+			document, _ := ToJson([]byte(line))
+			mutated, err := plan.Execute(document)
+			if err != nil {
+				t.Fatalf("Failed to execute plan: %v", err)
+			}
+			expectedDocument, _ := ToJson([]byte(expected))
+			assert.Equal(t, mutated, expectedDocument)
+		}
+	})
+
+	t.Run("stop processing only stops the matched elements", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions: []types.Expressions{
+						{FieldName: "[*].internal", Operator: "EQ", Value: true},
+					},
+				},
+				Priority:       1,
+				StopProcessing: true,
+			},
+			{
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "[*].email"}},
+			},
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions: []types.Expressions{
+						{FieldName: "[*].internal", Operator: "EQ", Value: true},
+					},
+				},
+				ElseActions: []types.Action{{ActionType: "EXCLUDE", FieldName: "[*]"}},
+			},
+		}
+		plan, err := Compile(rules)
+		if err != nil {
+			t.Fatalf("Failed to compile rules: %v", err)
+		}
+		for line, expected := range map[string]string{
+			`[{"internal":true,"email":"ops@example.com"},{"internal":false,"email":"jane@example.com"}]`: `[{"internal":true,"email":"ops@example.com"},[]]`,
+			`[{"internal":false,"email":"jane@example.com"},{"internal":true,"email":"ops@example.com"}]`: `[[],{"internal":true,"email":"ops@example.com"}]`,
+			`[{"internal":false,"email":"jane@example.com"}]`:                                             `[[]]`,
+		} {
+			document, _ := ToJson([]byte(line))
+			mutated, err := plan.Execute(document)
+			if err != nil {
+				t.Fatalf("Failed to execute plan: %v", err)
+			}
+			expectedDocument, _ := ToJson([]byte(expected))
+			assert.Equal(t, mutated, expectedDocument)
+		}
+
+		// The email of the records that aren't stopped is redacted
+		plan, _ = Compile(rules[:2])
+		document, _ := ToJson([]byte(`[{"internal":true,"email":"ops@example.com"},{"internal":false,"email":"jane@example.com"}]`))
+		mutated, _ := plan.Execute(document)
+		expectedDocument, _ := ToJson([]byte(`[{"internal":true,"email":"ops@example.com"},{"internal":false,"email":"**redacted**"}]`))
+		assert.Equal(t, mutated, expectedDocument)
+	})
+
+	t.Run("stop processing doesn't stop the same index of another array", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions: []types.Expressions{
+						{FieldName: "customers[*].internal", Operator: "EQ", Value: true},
+					},
+				},
+				Priority:       1,
+				StopProcessing: true,
+			},
+			{
+				Actions: []types.Action{
+					{ActionType: "REDACT", FieldName: "orders[*].card"},
+					{ActionType: "REDACT", FieldName: "customers[*].email"},
+				},
+			},
+		}
+		plan, err := Compile(rules)
+		if err != nil {
+			t.Fatalf("Failed to compile rules: %v", err)
+		}
+		document, _ := ToJson([]byte(`{"customers":[{"internal":true,"email":"ops@example.com"},{"internal":false,"email":"jane@example.com"}],"orders":[{"card":"4111"},{"card":"5500"}]}`))
+		mutated, transformErr := plan.Execute(document)
+		if transformErr != nil {
+			t.Fatalf("Failed to execute plan: %v", transformErr)
+		}
+		expectedDocument, _ := ToJson([]byte(`{"customers":[{"internal":true,"email":"ops@example.com"},{"internal":false,"email":"**redacted**"}],"orders":[{"card":"**redacted**"},{"card":"**redacted**"}]}`))
+		assert.Equal(t, mutated, expectedDocument)
+	})
+
+	t.Run("quantifiers apply to the whole array the action goes through", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions: []types.Expressions{
+					{FieldName: "orders[*].refunded", Operator: "EQ", Value: true, Quantifier: "ALL"},
+				},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "orders[*].card"}},
+		}}
+		plan, err := Compile(rules)
+		if err != nil {
+			t.Fatalf("Failed to compile rules: %v", err)
+		}
+		for line, expected := range map[string]string{
+			`{"orders":[{"refunded":true,"card":"1"},{"refunded":false,"card":"2"}]}`: `{"orders":[{"refunded":true,"card":"1"},{"refunded":false,"card":"2"}]}`,
+			`{"orders":[{"refunded":true,"card":"1"},{"refunded":true,"card":"2"}]}`:  `{"orders":[{"refunded":true,"card":"**redacted**"},{"refunded":true,"card":"**redacted**"}]}`,
+		} {
+			document, _ := ToJson([]byte(line))
+			mutated, err := plan.Execute(document)
+			if err != nil {
+				t.Fatalf("Failed to execute plan: %v", err)
+			}
+			expectedDocument, _ := ToJson([]byte(expected))
+			assert.Equal(t, mutated, expectedDocument)
+		}
+
+		// Without an array the quantifier has nothing to apply to
+		rules[0].Expression.Expressions[0].FieldName = "refunded"
+		_, err = Compile(rules)
+		assert.NotEqual(t, err, nil)
+		assert.Equal(t, err.Key, "quantifier")
+		assert.Equal(t, *err.ExpressionIndex, 0)
+	})
+
+	t.Run("else actions apply to the array elements that don't match", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions: []types.Expressions{
+					{FieldName: "items[*].type", Operator: "EQ", Value: "cash"},
+				},
+			},
+			ElseActions: []types.Action{{ActionType: "REDACT", FieldName: "items[*].number"}},
+		}}
+		plan, err := Compile(rules)
+		if err != nil {
+			t.Fatalf("Failed to compile rules: %v", err)
+		}
+		for line, expected := range map[string]string{
+			`{"items":[{"type":"card","number":"4111"},{"type":"cash","number":"1"}]}`: `{"items":[{"type":"card","number":"**redacted**"},{"type":"cash","number":"1"}]}`,
+			`{"items":[{"type":"card","number":"4111"},{"type":"card","number":"5500"}]}`: `{"items":[{"type":"card","number":"**redacted**"},{"type":"card","number":"**redacted**"}]}`,
+		} {
+			document, _ := ToJson([]byte(line))
+			mutated, err := plan.Execute(document)
+			if err != nil {
+				t.Fatalf("Failed to execute plan: %v", err)
+			}
+			expectedDocument, _ := ToJson([]byte(expected))
+			assert.Equal(t, mutated, expectedDocument)
+		}
+	})
+}
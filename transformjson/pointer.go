@@ -5,46 +5,178 @@ import (
 	"lazy-lagoon/pkg/types"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 /*
-MakePointer splits token string by . to individual tokens and handles array indices
+MakePointer splits the path into its tokens: the keys separated by . and the array indexes (or *) in brackets.
+Keys with dots, brackets or quotes are quoted in brackets, e.g. ['user.name'] or ["a[b]"], with \ escaping the quote, \ and \uXXXX characters.
+Negative indexes count from the end, the brackets can also hold a slice like [0:5] or a filter like [?(@.type=='card')],
+and .. or ** match the rest of the path at any depth, e.g. ..ssn or **.email.
+A path starting with / is a JSON Pointer (RFC 6901), e.g. /user.name/0 with ~1 for / and ~0 for ~.
 */
 func MakePointer(token string) ([]string, error) {
 	if token == "" {
 		return nil, fmt.Errorf("no field provided")
 	}
+	// The recursive descent token is kept out of the keys
+	if !utf8.ValidString(token) {
+		return nil, fmt.Errorf("path is not valid UTF-8")
+	}
+	if strings.HasPrefix(token, "/") {
+		return makeJsonPointer(token), nil
+	}
 
 	var tokens []string
-	parts := strings.Split(token, ".")
-
-	for _, part := range parts {
-		if part == "" {
-			return nil, fmt.Errorf("empty token in path")
+	// A key is expected at the start and after every .
+	expectKey := true
+	for position := 0; position < len(token); {
+		switch token[position] {
+		case '.':
+			if strings.HasPrefix(token[position:], "..") && (!expectKey || len(tokens) == 0) {
+				// Recursive descent
+				tokens = append(tokens, descent)
+				expectKey = true
+				position += 2
+				continue
+			}
+			if expectKey {
+				return nil, fmt.Errorf("empty token in path")
+			}
+			expectKey = true
+			position++
+		case '[':
+			if expectKey && len(tokens) > 0 {
+				return nil, fmt.Errorf("empty token in path")
+			}
+			bracket, end, err := readBracket(token, position)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, bracket)
+			expectKey = false
+			position = end
+		default:
+			if !expectKey {
+				return nil, fmt.Errorf("invalid array notation in %s", token)
+			}
+			end := strings.IndexAny(token[position:], ".[")
+			if end < 0 {
+				end = len(token) - position
+			}
+			key := token[position : position+end]
+			if key == "**" {
+				// Recursive descent, a key named ** is quoted
+				key = descent
+			}
+			tokens = append(tokens, key)
+			expectKey = false
+			position += end
 		}
+	}
+	if expectKey {
+		return nil, fmt.Errorf("empty token in path")
+	}
+	if tokens[len(tokens)-1] == descent {
+		return nil, fmt.Errorf("recursive descent needs a field after it")
+	}
 
-		// Check if this part contains array notation
-		if strings.Contains(part, "[") && strings.HasSuffix(part, "]") {
-			// Split into array name and index
-			arrayParts := strings.Split(part, "[")
-			if len(arrayParts) != 2 {
-				return nil, fmt.Errorf("invalid array notation in %s", part)
-			}
+	return tokens, nil
+}
 
-			// Add the array name as a token
-			if arrayParts[0] != "" {
-				tokens = append(tokens, arrayParts[0])
+/*
+KeyPath appends the key to the path with a ., the key is quoted in brackets when MakePointer wouldn't read it back as a key
+*/
+func KeyPath(path string, key string) string {
+	if key == "" || key == "**" || strings.ContainsAny(key, ".[]'\"\\") || (path == "" && strings.HasPrefix(key, "/")) {
+		quoted := strings.NewReplacer("\\", "\\\\", "'", "\\'").Replace(key)
+		return path + "['" + quoted + "']"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// readBracket reads the index, selector or quoted key in the brackets starting at position, end is the position after the ]
+func readBracket(path string, position int) (token string, end int, err error) {
+	position++
+	if position < len(path) && (path[position] == '\'' || path[position] == '"') {
+		quote := path[position]
+		var key strings.Builder
+		for position++; position < len(path) && path[position] != quote; position++ {
+			if path[position] != '\\' {
+				key.WriteByte(path[position])
+				continue
+			}
+			if position+1 >= len(path) {
+				break
 			}
+			position++
+			if path[position] == 'u' && position+4 < len(path) {
+				code, err := strconv.ParseUint(path[position+1:position+5], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape in %s", path)
+				}
+				key.WriteRune(rune(code))
+				position += 4
+				continue
+			}
+			key.WriteByte(path[position])
+		}
+		if position+1 >= len(path) || path[position+1] != ']' {
+			return "", 0, fmt.Errorf("unterminated quoted key in %s", path)
+		}
+		return key.String(), position + 2, nil
+	}
+	closing := strings.IndexByte(path[position:], ']')
+	if strings.HasPrefix(path[position:], "?(") {
+		// The filter may hold brackets and quotes of its own
+		closing = filterEnd(path[position:])
+	}
+	if closing <= 0 || !isValidBracket(path[position:position+closing]) {
+		return "", 0, fmt.Errorf("invalid array notation in %s", path)
+	}
+	return path[position : position+closing], position + closing + 1, nil
+}
 
-			// Add the index (including *) as a token
-			index := strings.TrimSuffix(arrayParts[1], "]")
-			tokens = append(tokens, index)
-		} else {
-			tokens = append(tokens, part)
+// filterEnd returns the position of the ] after the parenthesis closing the filter, -1 when the filter isn't closed
+func filterEnd(path string) int {
+	var quote byte
+	depth := 0
+	for position := 0; position < len(path); position++ {
+		character := path[position]
+		switch {
+		case quote != 0:
+			if character == '\\' {
+				position++
+			} else if character == quote {
+				quote = 0
+			}
+		case character == '\'' || character == '"':
+			quote = character
+		case character == '(':
+			depth++
+		case character == ')':
+			depth--
+			if depth == 0 {
+				if position+1 < len(path) && path[position+1] == ']' {
+					return position + 1
+				}
+				return -1
+			}
 		}
 	}
+	return -1
+}
 
-	return tokens, nil
+// makeJsonPointer splits a JSON Pointer into its unescaped tokens
+func makeJsonPointer(pointer string) []string {
+	tokens := strings.Split(pointer[1:], "/")
+	for index, token := range tokens {
+		tokens[index] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens
 }
 
 /*
@@ -63,6 +195,12 @@ func GetPointerValue(tokens []string, node any) (any, error) {
 	if isLastToken {
 		switch typedNode := node.(type) {
 		// If the node is a object
+		case *Object:
+			// If the node is an object, try to get the value of the key
+			if value, exists := typedNode.Get(currentToken); exists {
+				return fmt.Sprintf("%v", value), nil
+			}
+			return "", nil
 		case map[string]any:
 			// If the node is a map, try to get the value from the map
 			if value, exists := typedNode[currentToken]; exists {
@@ -71,14 +209,11 @@ func GetPointerValue(tokens []string, node any) (any, error) {
 			return "", nil
 		case []any:
 			// If the node is an array, try to convert the current token to an integer and index into the array
-			currentTokenAsInt, err := strconv.Atoi(currentToken)
+			index, err := resolveIndex(currentToken, len(typedNode))
 			if err != nil {
-				return "", fmt.Errorf("invalid array index format: %v", err)
+				return "", err
 			}
-			if currentTokenAsInt < 0 || currentTokenAsInt >= len(typedNode) {
-				return "", fmt.Errorf("array index out of bounds: %d (length: %d)", currentTokenAsInt, len(typedNode))
-			}
-			return typedNode[currentTokenAsInt], nil
+			return typedNode[index], nil
 		case any, nil:
 			return typedNode, nil
 		default:
@@ -86,6 +221,12 @@ func GetPointerValue(tokens []string, node any) (any, error) {
 		}
 	}
 	switch typedNode := node.(type) {
+	case *Object:
+		// If the node is an object then index into the object and recurse
+		if value, ok := typedNode.Get(currentToken); ok {
+			return GetPointerValue(cleanedToken, value)
+		}
+		return "", nil
 	case map[string]any:
 		// If the node is a map then index into the map and recurse
 		if value, ok := typedNode[currentToken]; ok {
@@ -93,21 +234,53 @@ func GetPointerValue(tokens []string, node any) (any, error) {
 		}
 		return "", nil
 	case []any:
-		// If the current token is a wildcard then throw an error (should be using GetPointerArrayValues)
-		if currentToken == "*" {
-			return "", fmt.Errorf("cannot use * as an index")
+		// If the current token is a wildcard, slice or filter then throw an error (should be using GetPointerArrayValues)
+		if IsSelector(currentToken) {
+			return "", fmt.Errorf("cannot use %s as an index", currentToken)
 		}
 		// If the current token is an integer then index into the array and recurse
-		if index, err := strconv.Atoi(currentToken); err == nil {
-			if index >= 0 && index < len(typedNode) {
-				return GetPointerValue(cleanedToken, typedNode[index])
+		if _, err := strconv.Atoi(currentToken); err == nil {
+			index, err := resolveIndex(currentToken, len(typedNode))
+			if err != nil {
+				return "", fmt.Errorf("invalid array index")
 			}
-			return "", fmt.Errorf("invalid array index")
+			return GetPointerValue(cleanedToken, typedNode[index])
 		}
 	}
 	return node, nil
 }
 
+/*
+Get the raw node from the json pointer without converting it, exists is false when the path can't be resolved
+*/
+func GetPointerNode(tokens []string, node any) (value any, exists bool) {
+	for _, token := range tokens {
+		switch typedNode := node.(type) {
+		case *Object:
+			child, ok := typedNode.Get(token)
+			if !ok {
+				return nil, false
+			}
+			node = child
+		case map[string]any:
+			child, ok := typedNode[token]
+			if !ok {
+				return nil, false
+			}
+			node = child
+		case []any:
+			index, err := resolveIndex(token, len(typedNode))
+			if err != nil {
+				return nil, false
+			}
+			node = typedNode[index]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
 /*
 Get multiple values from the json pointer
 */
@@ -118,10 +291,35 @@ func GetPointerArrayValues(tokens []string, node any) ([]any, error) {
 	currentToken := tokens[0]
 	isLastToken := len(tokens) == 1
 
+	// Recursive descent, the values of the next tokens at any depth
+	if currentToken == descent {
+		var results []any
+		if isTokenOf(tokens[1], node) {
+			values, err := GetPointerArrayValues(tokens[1:], node)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, values...)
+		}
+		for _, child := range children(node) {
+			values, err := GetPointerArrayValues(tokens, child)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, values...)
+		}
+		return results, nil
+	}
+
 	if isLastToken {
 		// Handle potential errors based on node type
 		switch typedNode := node.(type) {
 		// If the node is a object
+		case *Object:
+			if value, exists := typedNode.Get(currentToken); exists {
+				return []any{value}, nil
+			}
+			return nil, nil
 		case map[string]any:
 			// if the node is a map and current token is a key then return the value as an array
 			if value, exists := typedNode[currentToken]; exists {
@@ -129,6 +327,25 @@ func GetPointerArrayValues(tokens []string, node any) ([]any, error) {
 			}
 			return nil, nil
 		case []any:
+			if IsSelector(currentToken) && currentToken != "*" {
+				// The elements selected by the slice or filter
+				indexes, err := selectIndexes(currentToken, typedNode)
+				if err != nil {
+					return nil, err
+				}
+				results := make([]any, len(indexes))
+				for position, index := range indexes {
+					results[position] = typedNode[index]
+				}
+				return results, nil
+			}
+			if _, err := strconv.Atoi(currentToken); err == nil {
+				// A single element, none when the index is out of range
+				if index, err := resolveIndex(currentToken, len(typedNode)); err == nil {
+					return []any{typedNode[index]}, nil
+				}
+				return nil, nil
+			}
 			// Return the array directly since it's already []any
 			return typedNode, nil
 		case any:
@@ -139,6 +356,11 @@ func GetPointerArrayValues(tokens []string, node any) ([]any, error) {
 	cleanedToken := tokens[1:]
 	switch typedNode := node.(type) {
 	// If the node is a object
+	case *Object:
+		if value, ok := typedNode.Get(currentToken); ok {
+			return GetPointerArrayValues(cleanedToken, value)
+		}
+		return nil, nil
 	case map[string]any:
 		// If the node is a map then index into the map and recurse
 		if value, ok := typedNode[currentToken]; ok {
@@ -147,28 +369,67 @@ func GetPointerArrayValues(tokens []string, node any) ([]any, error) {
 		return nil, nil
 	// If the node is an array
 	case []any:
-		if currentToken == "*" {
+		if IsSelector(currentToken) {
+			indexes, err := selectIndexes(currentToken, typedNode)
+			if err != nil {
+				return nil, err
+			}
 			var results []any
-			// Getting all the values for each array *
-			for _, child := range typedNode {
-				childValues, err := GetPointerArrayValues(cleanedToken, child)
+			// Getting all the values for each selected element
+			for _, index := range indexes {
+				childValues, err := GetPointerArrayValues(cleanedToken, typedNode[index])
 				if err != nil {
 					return nil, err
 				}
 				results = append(results, childValues...)
 			}
 			return results, nil
-		} else if index, err := strconv.Atoi(currentToken); err == nil {
+		} else if _, err := strconv.Atoi(currentToken); err == nil {
 			// If the current token is an integer then index into the array and recurse
-			if index >= 0 && index < len(typedNode) {
-				return GetPointerArrayValues(cleanedToken, typedNode[index])
+			index, err := resolveIndex(currentToken, len(typedNode))
+			if err != nil {
+				return nil, fmt.Errorf("invalid array index")
 			}
-			return nil, fmt.Errorf("invalid array index")
+			return GetPointerArrayValues(cleanedToken, typedNode[index])
 		}
 	}
 	return []any{node}, nil
 }
 
+// isTokenOf reports whether the token can be resolved in the node: an index or selector of an array, or a key of an object
+func isTokenOf(token string, node any) bool {
+	switch node.(type) {
+	case *Object, map[string]any:
+		return true
+	case []any:
+		_, err := strconv.Atoi(token)
+		return err == nil || IsSelector(token)
+	}
+	return false
+}
+
+// children returns the values of an object or the elements of an array, the nodes a recursive descent goes through
+func children(node any) []any {
+	switch typedNode := node.(type) {
+	case *Object:
+		values := make([]any, 0, typedNode.Len())
+		for _, key := range typedNode.Keys() {
+			value, _ := typedNode.Get(key)
+			values = append(values, value)
+		}
+		return values
+	case map[string]any:
+		values := make([]any, 0, len(typedNode))
+		for _, value := range typedNode {
+			values = append(values, value)
+		}
+		return values
+	case []any:
+		return typedNode
+	}
+	return nil
+}
+
 /*
 Mutate goes through node interface from the given pointer to Redact or Exclude values in json and checks if the expression is met
 */
@@ -188,6 +449,30 @@ func Mutate(
 	ruleIndex int,
 	actionIndex int,
 	) *types.TransformError {
+	compiled, transformErr := compileExpression(expression, ruleIndex)
+	if transformErr != nil {
+		return transformErr
+	}
+	isMet := func(indexes []int) (bool, *types.TransformError) {
+		return compiled.IsMet(indexes, ruleIndex, document)
+	}
+	return mutate(node, tokens, isMet, false, actionType, indexes, ruleIndex, actionIndex)
+}
+
+/*
+mutate is Mutate with the expression already compiled into isMet, which is called with the indexes traversed so far.
+With negate the values are mutated when the expression is NOT met (else actions).
+*/
+func mutate(
+	node any,
+	tokens []string,
+	isMet func(indexes []int) (bool, *types.TransformError),
+	negate bool,
+	actionType string,
+	indexes []int,
+	ruleIndex int,
+	actionIndex int,
+	) *types.TransformError {
 	if len(tokens) == 0 {
 		return &types.TransformError{
 			Message: "empty token list",
@@ -200,17 +485,70 @@ func Mutate(
 	isLastToken := len(tokens) == 1
 	cleanedToken := tokens[1:]
 
+	if currentToken == descent {
+		// Recursive descent: the next tokens are applied at this node and at every node under it.
+		// The indexes of the arrays it goes through are not traversed indexes, they can't be matched with the expression
+		if isTokenOf(cleanedToken[0], node) {
+			if transformErr := mutate(node, cleanedToken, isMet, negate, actionType, indexes, ruleIndex, actionIndex); transformErr != nil {
+				return transformErr
+			}
+		}
+		for _, child := range children(node) {
+			if transformErr := mutate(child, tokens, isMet, negate, actionType, indexes, ruleIndex, actionIndex); transformErr != nil {
+				return transformErr
+			}
+		}
+		return nil
+	}
+
 	if isLastToken {
 		// At the last token, we may be redacting/excluding a value or array element
-		met, transformErr := IsExpressionMet(expression, indexes, ruleIndex, document)
+		met, transformErr := isMet(indexes)
 		if transformErr != nil {
 			return transformErr
 		}
-		if !met {
-			// Returning without redaction if expression isn't met
+		if array, isArray := node.([]any); isArray && IsSelector(currentToken) {
+			if !met && !negate {
+				// Returning without redaction if expression isn't met
+				return nil
+			}
+			if !met {
+				// None of the elements can meet the expression, the else action applies to all of them
+				isMet = func(indexes []int) (bool, *types.TransformError) { return true, nil }
+				negate = false
+			}
+			selected, err := selectIndexes(currentToken, array)
+			if err != nil {
+				return &types.TransformError{
+					Message: err.Error(),
+					RuleIndex: &ruleIndex,
+					ActionIndex: &actionIndex,
+					Key: "fieldName",
+				}
+			}
+			for _, i := range selected {
+				// Calling again so individually can check expressions
+				if transformErr := mutate(array, []string{strconv.Itoa(i)}, isMet, negate, actionType, append(indexes, i), ruleIndex, actionIndex); transformErr != nil {
+					return transformErr
+				}
+			}
+			return nil
+		}
+		if met == negate {
+			// Returning without redaction if expression isn't met (or is met for else actions)
 			return nil
 		}
 		switch typedNode := node.(type) {
+		// If the node is an object, the other keys keep their order
+		case *Object:
+			if actionType == "REDACT" {
+				if _, exists := typedNode.Get(currentToken); exists {
+					typedNode.Set(currentToken, "**redacted**")
+				}
+			} else if actionType == "EXCLUDE" {
+				typedNode.Delete(currentToken)
+			}
+			return nil
 		// If the node is a map/object
 		case map[string]any:
 			if actionType == "REDACT" {
@@ -226,20 +564,13 @@ func Mutate(
 			return nil
 		// If the node is an array
 		case []any:
-			// if the last token is * and an array
-			if currentToken == "*" {
-				for i := 0; i < len(typedNode); i++ {
-					// Calling again so individually can check expressions
-					if transformErr := Mutate(document, typedNode, []string{strconv.Itoa(i)}, expression, actionType, append(indexes, i), ruleIndex, actionIndex); transformErr != nil {
-						return transformErr
-					}
-				}
-			} else if currentToken != "" {
-				// The * after its been called above. (execution phase)
-				tokenAsInt, err := strconv.Atoi(currentToken)
+			// The * has been expanded above (execution phase)
+			if currentToken != "" {
+				// The * after its been called above. (execution phase), negative indexes count from the end
+				tokenAsInt, err := resolveIndex(currentToken, len(typedNode))
 				if err != nil {
 					return &types.TransformError{
-						Message: fmt.Sprintf("invalid array index format: %v", err),
+						Message: err.Error(),
 						RuleIndex: &ruleIndex,
 						ActionIndex: &actionIndex,
 						Key: "fieldName",
@@ -260,46 +591,52 @@ func Mutate(
 
 	// Not at the last token: recurse deeper into the structure
 	switch typedNode := node.(type) {
+	case *Object:
+		if value, ok := typedNode.Get(currentToken); ok {
+			return mutate(value, cleanedToken, isMet, negate, actionType, indexes, ruleIndex, actionIndex)
+		}
+		return nil
 	// If the node is a map/object
 	case map[string]any:
 		if value, ok := typedNode[currentToken]; ok {
 			// Recurse into the next token
-			return Mutate(document, value, cleanedToken, expression, actionType, indexes, ruleIndex, actionIndex)
+			return mutate(value, cleanedToken, isMet, negate, actionType, indexes, ruleIndex, actionIndex)
 		} else {
 			// No op if the key doesn't exist in this index
 			return nil
 		}
 	// If the node is an array
 	case []any:
-		if currentToken == "*" {
-			// Wildcard: recurse into each child with the current index
-			for index, child := range typedNode {
-				if transformErr := Mutate(document, child, cleanedToken, expression, actionType, append(indexes, index), ruleIndex, actionIndex); transformErr != nil {
-					return transformErr
-				}
-			}
-			return nil
-		} else if currentToken != "" {
-			// Handle a specific array index
-			tokenAsInt, err := strconv.Atoi(currentToken)
+		if IsSelector(currentToken) {
+			// Wildcard, slice or filter: recurse into each selected child with the current index
+			selected, err := selectIndexes(currentToken, typedNode)
 			if err != nil {
 				return &types.TransformError{
-					Message: fmt.Sprintf("invalid array index format: %v", err),
+					Message: err.Error(),
 					RuleIndex: &ruleIndex,
 					ActionIndex: &actionIndex,
 					Key: "fieldName",
 				}
 			}
-			if tokenAsInt < 0 || tokenAsInt >= len(typedNode) {
+			for _, index := range selected {
+				if transformErr := mutate(typedNode[index], cleanedToken, isMet, negate, actionType, append(indexes, index), ruleIndex, actionIndex); transformErr != nil {
+					return transformErr
+				}
+			}
+			return nil
+		} else if currentToken != "" {
+			// Handle a specific array index, negative indexes count from the end
+			tokenAsInt, err := resolveIndex(currentToken, len(typedNode))
+			if err != nil {
 				return &types.TransformError{
-					Message: fmt.Sprintf("array index out of bounds: %d (length: %d)", tokenAsInt, len(typedNode)),
+					Message: err.Error(),
 					RuleIndex: &ruleIndex,
 					ActionIndex: &actionIndex,
 					Key: "fieldName",
 				}
 			}
 			// Recurse into the next token for the given index
-			return Mutate(document, typedNode[tokenAsInt], cleanedToken, expression, actionType, append(indexes, tokenAsInt), ruleIndex, actionIndex)
+			return mutate(typedNode[tokenAsInt], cleanedToken, isMet, negate, actionType, append(indexes, tokenAsInt), ruleIndex, actionIndex)
 		}
 		return nil
 	}
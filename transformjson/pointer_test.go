@@ -3,6 +3,8 @@ package transformjson
 import (
 	"testing"
 
+	"lazy-lagoon/pkg/types"
+
 	"github.com/go-playground/assert/v2"
 )
 
@@ -63,3 +65,171 @@ func TestMakeAndGetPointer(t *testing.T) {
 		assert.Equal(t, rolesArrayValues, []any{"admin", "user", "editor", "guest", "moderator"})
 	})
 }
+
+func TestQuotedPointer(t *testing.T) {
+	t.Run("quoted keys and json pointers", func(t *testing.T) {
+		cases := map[string][]string{
+			"['user.name']":               {"user.name"},
+			`payload["a[b]"].id`:          {"payload", "a[b]", "id"},
+			`['it\'s'][0]['back\\slash']`: {"it's", "0", `back\slash`},
+			`['café'].first name`:         {"café", "first name"},
+			"matrix[0][*]":                {"matrix", "0", "*"},
+			"/user.name/a~1b/0/~0":        {"user.name", "a/b", "0", "~"},
+		}
+		for path, expected := range cases {
+			tokens, err := MakePointer(path)
+			if err != nil {
+				t.Fatalf("Failed to create pointer %s: %v", path, err)
+			}
+			assert.Equal(t, tokens, expected)
+		}
+		for _, path := range []string{"a...b", "a.", "a[0", "['a'", "['a']b", "a[]", "a.[0]"} {
+			_, err := MakePointer(path)
+			assert.NotEqual(t, err, nil)
+		}
+	})
+
+	t.Run("key paths read back as the same keys", func(t *testing.T) {
+		for _, key := range []string{"name", "user.name", "a[b]", "it's", `back\slash`, "/root", "", "first name", "**"} {
+			tokens, err := MakePointer(KeyPath(KeyPath("", "data"), key))
+			if err != nil {
+				t.Fatalf("Failed to create pointer for %q: %v", key, err)
+			}
+			assert.Equal(t, tokens, []string{"data", key})
+			tokens, err = MakePointer(KeyPath("", key))
+			if err != nil {
+				t.Fatalf("Failed to create pointer for %q: %v", key, err)
+			}
+			assert.Equal(t, tokens, []string{key})
+		}
+		assert.Equal(t, KeyPath("user", "name"), "user.name")
+		assert.Equal(t, KeyPath("", "user.name"), "['user.name']")
+	})
+
+	t.Run("dotted keys are read and mutated", func(t *testing.T) {
+		document, err := ToJson([]byte(`{"user.name": "Ada", "user": {"name": "Grace"}, "tags": [{"a[b]": "x"}]}`))
+		if err != nil {
+			t.Fatalf("Failed to parse json: %v", err)
+		}
+		value, err := GetPointerValue([]string{"user.name"}, document)
+		if err != nil {
+			t.Fatalf("Failed to get pointer value: %v", err)
+		}
+		assert.Equal(t, value, "Ada")
+		tokens, _ := MakePointer(`tags[*]["a[b]"]`)
+		values, err := GetPointerArrayValues(tokens, document)
+		if err != nil {
+			t.Fatalf("Failed to get pointer values: %v", err)
+		}
+		assert.Equal(t, values, []any{"x"})
+
+		for _, path := range []string{"['user.name']", "/tags/0/a[b]"} {
+			tokens, _ = MakePointer(path)
+			transformErr := Mutate(document, document, tokens, types.Expression{}, "REDACT", []int{}, 0, 0)
+			if transformErr != nil {
+				t.Fatalf("Failed to mutate: %v", transformErr.Message)
+			}
+		}
+		output, _ := FromJsonl(document)
+		assert.Equal(t, string(output), `{"user.name":"**redacted**","user":{"name":"Grace"},"tags":[{"a[b]":"**redacted**"}]}`)
+	})
+}
+
+func TestSelectors(t *testing.T) {
+	content := `{"customer": {"ssn": "1", "profile": {"ssn": "2"}}, "items": [{"type": "card", "number": "4111", "ssn": "3"}, {"type": "iban", "number": "DE89"}, {"type": "card", "number": "5500"}], "ssn": "0"}`
+
+	t.Run("recursive descent, slices and filters", func(t *testing.T) {
+		cases := map[string][]string{
+			"..ssn":                              {descent, "ssn"},
+			"**.email":                           {descent, "email"},
+			"customer..ssn":                      {"customer", descent, "ssn"},
+			"customer['**'].ssn":                 {"customer", "**", "ssn"},
+			"/customer/**/ssn":                   {"customer", "**", "ssn"},
+			"items[0:2].number":                  {"items", "0:2", "number"},
+			"items[-1]":                          {"items", "-1"},
+			"items[?(@.type=='card')].number":    {"items", "?(@.type=='card')", "number"},
+			`items[?(@.tags[0] == "a]")].number`: {"items", `?(@.tags[0] == "a]")`, "number"},
+		}
+		for path, expected := range cases {
+			tokens, err := MakePointer(path)
+			if err != nil {
+				t.Fatalf("Failed to create pointer %s: %v", path, err)
+			}
+			assert.Equal(t, tokens, expected)
+		}
+		for _, path := range []string{"customer..", "customer.**", "customer.\xff**.ssn", "items[?(@.type=='card']", "items[1:x]", "items[?(type=='card')]", "items[?(@.type==card)]", "items[name]"} {
+			_, err := MakePointer(path)
+			assert.NotEqual(t, err, nil)
+		}
+	})
+
+	t.Run("values of the selectors", func(t *testing.T) {
+		document, _ := ToJson([]byte(content))
+		cases := map[string][]any{
+			"..ssn":                           {"0", "1", "2", "3"},
+			"customer.**.ssn":                 {"1", "2"},
+			"items[0:2].number":               {"4111", "DE89"},
+			"items[-2:].type":                 {"iban", "card"},
+			"items[?(@.type=='card')].number": {"4111", "5500"},
+			"items[?(@.ssn)].number":          {"4111"},
+			"items[?(@.type != 'card')]":      {document.(*Object).values["items"].([]any)[1]},
+		}
+		for path, expected := range cases {
+			tokens, _ := MakePointer(path)
+			values, err := GetPointerArrayValues(tokens, document)
+			if err != nil {
+				t.Fatalf("Failed to get pointer values %s: %v", path, err)
+			}
+			assert.Equal(t, values, expected)
+		}
+		// A key named ** is only read with the path quoting it
+		starred, _ := ToJson([]byte(`{"**": {"ssn": "4"}, "customer": {"ssn": "1"}}`))
+		for path, expected := range map[string][]any{"['**'].ssn": {"4"}, "/**/ssn": {"4"}, "**.ssn": {"4", "1"}} {
+			tokens, _ := MakePointer(path)
+			values, err := GetPointerArrayValues(tokens, starred)
+			if err != nil {
+				t.Fatalf("Failed to get pointer values %s: %v", path, err)
+			}
+			assert.Equal(t, values, expected)
+		}
+
+		tokens, _ := MakePointer("items[-1].number")
+		value, err := GetPointerValue(tokens, document)
+		if err != nil {
+			t.Fatalf("Failed to get pointer value: %v", err)
+		}
+		assert.Equal(t, value, "5500")
+	})
+
+	t.Run("actions and expressions with selectors", func(t *testing.T) {
+		document, _ := ToJson([]byte(content))
+		plan, transformErr := Compile([]types.Rule{
+			{Actions: []types.Action{{ActionType: "REDACT", FieldName: "..ssn"}}},
+			{
+				// The index of the slice is substituted in the expression
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "items[*].type", Operator: "EQ", Value: "card"}},
+				},
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "items[1:].number"}},
+			},
+			{Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "items[?(@.type=='iban')].type"}, {ActionType: "REDACT", FieldName: "items[-3].type"}}},
+		})
+		if transformErr != nil {
+			t.Fatalf("Failed to compile rules: %v", transformErr.Message)
+		}
+		_, isStreamable := plan.StreamPath()
+		assert.Equal(t, isStreamable, false)
+		document, transformErr = plan.Execute(document)
+		if transformErr != nil {
+			t.Fatalf("Failed to execute plan: %v", transformErr.Message)
+		}
+		output, _ := FromJsonl(document)
+		assert.Equal(t, string(output), `{"customer":{"ssn":"**redacted**","profile":{"ssn":"**redacted**"}},"items":[{"type":"**redacted**","number":"4111","ssn":"**redacted**"},{"number":"DE89"},{"type":"card","number":"**redacted**"}],"ssn":"**redacted**"}`)
+
+		// An index out of range is reported
+		plan, _ = Compile([]types.Rule{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "items[-4]"}}}})
+		_, transformErr = plan.Execute(document)
+		assert.NotEqual(t, transformErr, nil)
+	})
+}
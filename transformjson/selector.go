@@ -0,0 +1,241 @@
+package transformjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"lazy-lagoon/pkg/expressions"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// descent is the token of .. and **, the tokens after it are matched at any depth.
+// It isn't valid UTF-8 so no key can be read as it, the keys ['**'] and /** stay keys
+const descent = "\xff**"
+
+// filterOperators are the comparisons of the filters and their expression operators, the longer ones are looked for first
+var filterOperators = []struct{ symbol, operator string }{
+	{"==", "EQ"}, {"!=", "NE"}, {">=", "GTE"}, {"<=", "LTE"}, {">", "GT"}, {"<", "LT"},
+}
+
+// filters caches the parsed filters by token, the same tokens are evaluated for every array of every document
+var filters sync.Map
+
+/*
+filter is a parsed filter token like ?(@.type=='card'): the value at the pointer of every element is compared with the value.
+A filter without a comparison, like ?(@.email), keeps the elements where the value exists.
+*/
+type filter struct {
+	pointer  []string
+	operator string
+	value    any
+}
+
+/*
+IsSelector reports whether the token selects elements of an array: *, a slice like 0:5 or a filter like ?(@.type=='card')
+*/
+func IsSelector(token string) bool {
+	if token == "*" || isFilter(token) {
+		return true
+	}
+	_, _, isSlice := parseSlice(token)
+	return isSlice
+}
+
+/*
+IsDescent reports whether the token is the recursive descent of .. or **, the tokens after it are matched at any depth
+*/
+func IsDescent(token string) bool {
+	return token == descent
+}
+
+/*
+	Helper functions
+*/
+// isValidBracket checks the content of brackets that isn't quoted: an index, * or a slice or filter
+func isValidBracket(token string) bool {
+	if _, err := strconv.Atoi(token); err == nil || token == "*" {
+		return true
+	}
+	if isFilter(token) {
+		_, err := parseFilter(token)
+		return err == nil
+	}
+	_, _, isSlice := parseSlice(token)
+	return isSlice
+}
+
+// resolveIndex converts the token to an index of the array, negative indexes count from the end
+func resolveIndex(token string, length int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid array index format: %v", err)
+	}
+	if index < 0 {
+		index += length
+	}
+	if index < 0 || index >= length {
+		return 0, fmt.Errorf("array index out of bounds: %s (length: %d)", token, length)
+	}
+	return index, nil
+}
+
+// selectIndexes returns the indexes of the elements selected by the * , slice or filter token, in the order of the array
+func selectIndexes(token string, array []any) ([]int, error) {
+	indexes := []int{}
+	if token == "*" {
+		for index := range array {
+			indexes = append(indexes, index)
+		}
+		return indexes, nil
+	}
+	if isFilter(token) {
+		selected, err := parseFilter(token)
+		if err != nil {
+			return nil, err
+		}
+		for index, element := range array {
+			isMatch, err := selected.matches(element)
+			if err != nil {
+				return nil, err
+			}
+			if isMatch {
+				indexes = append(indexes, index)
+			}
+		}
+		return indexes, nil
+	}
+	start, end, isSlice := parseSlice(token)
+	if !isSlice {
+		return nil, fmt.Errorf("invalid array selector %s", token)
+	}
+	// Negative bounds count from the end, the bounds are clamped to the array
+	bound := func(value *int, fallback int) int {
+		if value == nil {
+			return fallback
+		}
+		if *value < 0 {
+			return max(*value+len(array), 0)
+		}
+		return min(*value, len(array))
+	}
+	for index := bound(start, 0); index < bound(end, len(array)); index++ {
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// parseSlice parses start:end, both bounds are optional and nil when left out
+func parseSlice(token string) (start *int, end *int, isSlice bool) {
+	startText, endText, found := strings.Cut(token, ":")
+	if !found {
+		return nil, nil, false
+	}
+	parseBound := func(text string) (*int, bool) {
+		if text == "" {
+			return nil, true
+		}
+		value, err := strconv.Atoi(text)
+		return &value, err == nil
+	}
+	start, isStartValid := parseBound(startText)
+	end, isEndValid := parseBound(endText)
+	return start, end, isStartValid && isEndValid
+}
+
+func isFilter(token string) bool {
+	return strings.HasPrefix(token, "?(") && strings.HasSuffix(token, ")")
+}
+
+// parseFilter parses ?(@.field OP value) with OP one of == != > >= < <=, the value is a quoted string, a number, true, false or null
+func parseFilter(token string) (*filter, error) {
+	if cached, ok := filters.Load(token); ok {
+		return cached.(*filter), nil
+	}
+	invalid := fmt.Errorf("invalid filter %s", token)
+	body := strings.TrimSpace(token[2 : len(token)-1])
+	parsed := &filter{operator: "EXISTS", value: true}
+
+	left := body
+	if position, operator := findOperator(body); position >= 0 {
+		left = strings.TrimSpace(body[:position])
+		value, err := parseLiteral(strings.TrimSpace(body[position+len(operator.symbol):]))
+		if err != nil {
+			return nil, invalid
+		}
+		parsed.operator, parsed.value = operator.operator, value
+	}
+	// The field is relative to the element, @ is the element itself
+	if !strings.HasPrefix(left, "@") {
+		return nil, invalid
+	}
+	field := strings.TrimPrefix(strings.TrimPrefix(left, "@"), ".")
+	if field != "" {
+		pointer, err := MakePointer(field)
+		if err != nil {
+			return nil, invalid
+		}
+		parsed.pointer = pointer
+	}
+	filters.Store(token, parsed)
+	return parsed, nil
+}
+
+// findOperator returns the position of the first comparison outside of quotes, -1 when there is none
+func findOperator(body string) (int, struct{ symbol, operator string }) {
+	var quote byte
+	for position := 0; position < len(body); position++ {
+		character := body[position]
+		if quote != 0 {
+			if character == '\\' {
+				position++
+			} else if character == quote {
+				quote = 0
+			}
+			continue
+		}
+		if character == '\'' || character == '"' {
+			quote = character
+			continue
+		}
+		for _, operator := range filterOperators {
+			if strings.HasPrefix(body[position:], operator.symbol) {
+				return position, operator
+			}
+		}
+	}
+	return -1, filterOperators[0]
+}
+
+// parseLiteral parses the value of a filter, null is compared like the "null" expression value
+func parseLiteral(literal string) (any, error) {
+	switch {
+	case literal == "true":
+		return true, nil
+	case literal == "false":
+		return false, nil
+	case literal == "null":
+		return "null", nil
+	case len(literal) >= 2 && (literal[0] == '\'' || literal[0] == '"') && literal[len(literal)-1] == literal[0]:
+		// The quoted value is read like a quoted key
+		tokens, err := MakePointer("[" + literal + "]")
+		if err != nil || len(tokens) != 1 {
+			return nil, fmt.Errorf("invalid string %s", literal)
+		}
+		return tokens[0], nil
+	}
+	if _, err := strconv.ParseFloat(literal, 64); err != nil {
+		return nil, err
+	}
+	return json.Number(literal), nil
+}
+
+// matches compares the value of the element with the value of the filter
+func (selected *filter) matches(element any) (bool, error) {
+	value, exists := GetPointerNode(selected.pointer, element)
+	if !exists {
+		// Elements without the field never match
+		return false, nil
+	}
+	return expressions.IsOperatorResultMet(selected.operator, selected.value, value)
+}
@@ -0,0 +1,363 @@
+package transformjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"lazy-lagoon/pkg/concurrent"
+	"lazy-lagoon/pkg/textencoding"
+	"lazy-lagoon/pkg/types"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Bytes of the input read before the elements are transformed, and of the output written at once
+	streamChunkSize = 5 * 1024 * 1024 // 5MB in bytes
+	// Elements transformed by the same goroutine
+	streamGroupSize = 500
+)
+
+/*
+StreamPath returns the path of the array whose elements can be transformed one at a time, as if every element was the only one in the document.
+That's the case when every pointer of the plan goes through the elements of the same array with a *, e.g. items[*].ssn and items[*].type with the path items.
+isStreamable is false when a rule needs the whole document:
+  - a pointer without a *, or under another array
+  - a recursive descent, slice, filter or negative index before the *
+  - stopProcessing, a match can stop the rules for the whole document
+  - a quantifier other than ANY on the array itself (items[*].type), the quantifier is checked on all the elements
+*/
+func (plan *Plan) StreamPath() (path []string, isStreamable bool) {
+	isFirst := true
+	for _, rule := range plan.rules {
+		if rule.stopProcessing {
+			return nil, false
+		}
+		pointers := [][]string{}
+		for _, action := range append(append([]compiledAction{}, rule.actions...), rule.elseActions...) {
+			pointers = append(pointers, action.pointer)
+		}
+		for _, condition := range rule.expression.conditions {
+			if condition.pointer != nil {
+				pointers = append(pointers, condition.pointer)
+			}
+		}
+		for _, pointer := range pointers {
+			// The array is the first one of the pointer, its elements are selected with a * (slices, filters and negative indexes need the whole array)
+			wildcard := slices.IndexFunc(pointer, func(token string) bool {
+				index, err := strconv.Atoi(token)
+				return token == descent || IsSelector(token) || (err == nil && index < 0)
+			})
+			if wildcard < 0 || pointer[wildcard] != "*" {
+				return nil, false
+			}
+			if isFirst {
+				path, isFirst = pointer[:wildcard], false
+			} else if !slices.Equal(path, pointer[:wildcard]) {
+				return nil, false
+			}
+		}
+	}
+	for _, rule := range plan.rules {
+		for _, condition := range rule.expression.conditions {
+			// The quantifier applies to the elements of the array itself, not to an array under them
+			if condition.substitutedIndexes == 0 {
+				return nil, false
+			}
+		}
+	}
+	return path, true
+}
+
+/*
+IsStreamed reports whether the JSON content is streamed with the path: the array is nested in the document,
+or it's the document itself. The other documents are transformed in memory
+*/
+func IsStreamed(byteContent []byte, path []string) bool {
+	return len(path) > 0 || bytes.HasPrefix(bytes.TrimSpace(byteContent), []byte("["))
+}
+
+/*
+ExecuteStream transforms the JSON document read from the reader without loading it: the elements of the array at the path are read in batches, transformed concurrently
+and written in the layout as they are read, the values around the array are written as they are read.
+The output is the same as transforming the whole document with the plan, the plan must be streamable with the path (see StreamPath)
+*/
+func ExecuteStream(reader io.Reader, plan *Plan, path []string, layout Layout, output io.Writer) *types.TransformError {
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+	stream := &streamWriter{decoder: decoder, plan: plan, path: path, layout: layout, buffer: bytes.NewBuffer(nil), output: output}
+	transformErr := stream.writeValue([]string{}, 0)
+	if transformErr != nil {
+		return transformErr
+	}
+	// Only whitespace may follow the document
+	err := readEnd(decoder)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	if layout.TrailingNewline {
+		stream.buffer.WriteByte('\n')
+	}
+	return stream.flush(0)
+}
+
+/*
+streamWriter writes the document read by the decoder, the values on the path to the array are written token by token
+*/
+type streamWriter struct {
+	decoder *json.Decoder
+	plan    *Plan
+	path    []string
+	layout  Layout
+	buffer  *bytes.Buffer
+	output  io.Writer
+}
+
+// writeValue writes the next value of the decoder, keys are the keys of the path read so far
+func (stream *streamWriter) writeValue(keys []string, depth int) *types.TransformError {
+	token, err := stream.decoder.Token()
+	if err != nil {
+		return invalidJson()
+	}
+	delim, isDelim := token.(json.Delim)
+	switch {
+	case isDelim && delim == '{' && len(keys) < len(stream.path):
+		return stream.writeObject(keys, depth)
+	case isDelim && delim == '[' && len(keys) == len(stream.path):
+		return stream.writeArray(depth)
+	}
+	// The value isn't the array or an object on the path to it, the rules are applied to it in memory
+	value, err := decodeToken(stream.decoder, token)
+	if err != nil {
+		return invalidJson()
+	}
+	document, transformErr := stream.plan.Execute(nest(keys, value))
+	if transformErr != nil {
+		return transformErr
+	}
+	value, _ = GetPointerNode(keys, document)
+	return stream.write(value, depth)
+}
+
+// writeObject writes an object on the path, the values of the other keys aren't changed by the rules
+func (stream *streamWriter) writeObject(keys []string, depth int) *types.TransformError {
+	stream.buffer.WriteByte('{')
+	count := 0
+	for stream.decoder.More() {
+		keyToken, err := stream.decoder.Token()
+		if err != nil {
+			return invalidJson()
+		}
+		key, isString := keyToken.(string)
+		if !isString {
+			return invalidJson()
+		}
+		if count > 0 {
+			stream.buffer.WriteByte(',')
+		}
+		stream.newline(depth + 1)
+		keyBytes, err := marshal(key)
+		if err != nil {
+			return &types.TransformError{Message: err.Error()}
+		}
+		stream.buffer.Write(keyBytes)
+		stream.buffer.WriteByte(':')
+		if !stream.layout.Compact {
+			stream.buffer.WriteByte(' ')
+		}
+		if key == stream.path[len(keys)] {
+			transformErr := stream.writeValue(append(slices.Clip(keys), key), depth+1)
+			if transformErr != nil {
+				return transformErr
+			}
+		} else {
+			value, err := decodeValue(stream.decoder)
+			if err != nil {
+				return invalidJson()
+			}
+			transformErr := stream.write(value, depth+1)
+			if transformErr != nil {
+				return transformErr
+			}
+		}
+		count++
+		transformErr := stream.flush(streamChunkSize)
+		if transformErr != nil {
+			return transformErr
+		}
+	}
+	// Reading the closing }
+	if _, err := stream.decoder.Token(); err != nil {
+		return invalidJson()
+	}
+	if count > 0 {
+		stream.newline(depth)
+	}
+	stream.buffer.WriteByte('}')
+	return nil
+}
+
+// writeArray transforms the elements of the array in batches, every element is transformed in the document of the path with only this element
+func (stream *streamWriter) writeArray(depth int) *types.TransformError {
+	stream.buffer.WriteByte('[')
+	count := 0
+	for stream.decoder.More() {
+		// Reading the elements of the next chunk, in groups transformed concurrently
+		var groups [][]any
+		start := stream.decoder.InputOffset()
+		for stream.decoder.More() && stream.decoder.InputOffset()-start < streamChunkSize {
+			element, err := decodeValue(stream.decoder)
+			if err != nil {
+				return invalidJson()
+			}
+			if len(groups) == 0 || len(groups[len(groups)-1]) == streamGroupSize {
+				groups = append(groups, make([]any, 0, streamGroupSize))
+			}
+			groups[len(groups)-1] = append(groups[len(groups)-1], element)
+		}
+		formattedGroups, transformErr := concurrent.ForEach(groups, func(group []any, groupIndex int) ([][]byte, *types.TransformError) {
+			formatted := make([][]byte, len(group))
+			for index, element := range group {
+				document, transformErr := stream.plan.Execute(nest(stream.path, []any{element}))
+				if transformErr != nil {
+					return nil, transformErr
+				}
+				array, _ := GetPointerNode(stream.path, document)
+				content, err := stream.format(array.([]any)[0], depth+1)
+				if err != nil {
+					return nil, &types.TransformError{Message: err.Error()}
+				}
+				formatted[index] = content
+			}
+			return formatted, nil
+		})
+		if transformErr != nil {
+			return transformErr
+		}
+		for _, group := range formattedGroups {
+			for _, content := range group {
+				if count > 0 {
+					stream.buffer.WriteByte(',')
+				}
+				stream.newline(depth + 1)
+				stream.buffer.Write(content)
+				count++
+			}
+		}
+		transformErr = stream.flush(streamChunkSize)
+		if transformErr != nil {
+			return transformErr
+		}
+	}
+	// Reading the closing ]
+	if _, err := stream.decoder.Token(); err != nil {
+		return invalidJson()
+	}
+	if count > 0 {
+		stream.newline(depth)
+	}
+	stream.buffer.WriteByte(']')
+	return nil
+}
+
+// write writes the value at the depth in the layout
+func (stream *streamWriter) write(value any, depth int) *types.TransformError {
+	content, err := stream.format(value, depth)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	stream.buffer.Write(content)
+	return nil
+}
+
+// format writes the value like Format writes it when it's nested at the depth of the document
+func (stream *streamWriter) format(value any, depth int) ([]byte, error) {
+	content, err := marshal(value)
+	if err != nil || stream.layout.Compact {
+		return content, err
+	}
+	var indented bytes.Buffer
+	err = json.Indent(&indented, content, strings.Repeat(stream.layout.Indent, depth), stream.layout.Indent)
+	return indented.Bytes(), err
+}
+
+// newline starts the line of a value at the depth, values aren't on their own line when compact
+func (stream *streamWriter) newline(depth int) {
+	if stream.layout.Compact {
+		return
+	}
+	stream.buffer.WriteByte('\n')
+	stream.buffer.WriteString(strings.Repeat(stream.layout.Indent, depth))
+}
+
+// flush writes the buffer to the output once it holds minSize bytes
+func (stream *streamWriter) flush(minSize int) *types.TransformError {
+	if stream.buffer.Len() == 0 || stream.buffer.Len() < minSize {
+		return nil
+	}
+	_, err := stream.output.Write(stream.buffer.Bytes())
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
+	stream.buffer.Reset()
+	return nil
+}
+
+/*
+EncodingWriter encodes the UTF-8 bytes written to it in the encoding of the output, with the byte order mark before the first bytes.
+Every write must end on a complete character
+*/
+type EncodingWriter struct {
+	Output   io.Writer
+	Encoding string
+	written  bool
+}
+
+func (writer *EncodingWriter) Write(content []byte) (int, error) {
+	encoded, err := textencoding.Encode(content, writer.Encoding, !writer.written)
+	if err != nil {
+		return 0, err
+	}
+	writer.written = true
+	if _, err := writer.Output.Write(encoded); err != nil {
+		return 0, err
+	}
+	return len(content), nil
+}
+
+/*
+	Helper functions
+*/
+// sourceReader reads the source of a stream, keeping what the decoder can't tell:
+// whether the source ends with a newline and the error of the storage, which the decoder reports as invalid JSON
+type sourceReader struct {
+	reader io.Reader
+	last   byte
+	err    error
+}
+
+func (source *sourceReader) Read(content []byte) (int, error) {
+	read, err := source.reader.Read(content)
+	if read > 0 {
+		source.last = content[read-1]
+	}
+	if err != nil && err != io.EOF {
+		source.err = err
+	}
+	return read, err
+}
+
+// nest returns the value in the objects of the keys, the document the pointers of the plan are resolved in
+func nest(keys []string, value any) any {
+	for index := len(keys) - 1; index >= 0; index-- {
+		object := NewObject()
+		object.Set(keys[index], value)
+		value = object
+	}
+	return value
+}
+
+func invalidJson() *types.TransformError {
+	return &types.TransformError{Message: "unmarshalling json error, not valid json"}
+}
@@ -0,0 +1,191 @@
+package transformjson
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// transformInMemory is the output of the whole document transformed with the plan
+func transformInMemory(t *testing.T, content string, plan *Plan, layout Layout) string {
+	document, err := ToJson([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse json: %v", err)
+	}
+	document, transformErr := plan.Execute(document)
+	if transformErr != nil {
+		t.Fatalf("Failed to transform json: %v", transformErr.Message)
+	}
+	output, err := Format(document, layout)
+	if err != nil {
+		t.Fatalf("Failed to format json: %v", err)
+	}
+	return string(output)
+}
+
+func TestExecuteStream(t *testing.T) {
+	cardRules := []types.Rule{
+		{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions:     []types.Expressions{{FieldName: "export.items[*].type", Operator: "EQ", Value: "card"}},
+			},
+			Actions:     []types.Action{{ActionType: "REDACT", FieldName: "export.items[*].number"}},
+			ElseActions: []types.Action{{ActionType: "REDACT", FieldName: "export.items[*].type"}},
+		},
+		{Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "export.items[*].tags[*]"}}},
+		{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions:     []types.Expressions{{FieldName: "export.items[*].number", Operator: "EQ", Value: "DE89"}},
+			},
+			Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "export.items[*]"}},
+		},
+	}
+	nested := `{
+  "vendor": "acme <co>",
+  "export": {
+    "count": 3,
+    "items": [
+      {"type": "card", "number": "4111", "tags": ["a"]},
+      {"type": "iban", "number": "DE89"},
+      {"type": "card", "number": 5500.10, "empty": {}}
+    ],
+    "next": null
+  }
+}
+`
+
+	t.Run("nested array streamed like the in-memory transform", func(t *testing.T) {
+		plan, transformErr := Compile(cardRules)
+		if transformErr != nil {
+			t.Fatalf("Failed to compile rules: %v", transformErr.Message)
+		}
+		path, isStreamable := plan.StreamPath()
+		assert.Equal(t, isStreamable, true)
+		assert.Equal(t, path, []string{"export", "items"})
+		for _, layout := range []Layout{DetectLayout([]byte(nested)), {Compact: true}, {Indent: "\t", TrailingNewline: true}} {
+			output := bytes.NewBuffer(nil)
+			transformErr = ExecuteStream(strings.NewReader(nested), plan, path, layout, output)
+			if transformErr != nil {
+				t.Fatalf("Failed to stream json: %v", transformErr.Message)
+			}
+			assert.Equal(t, output.String(), transformInMemory(t, nested, plan, layout))
+		}
+	})
+
+	t.Run("top-level array and values off the path", func(t *testing.T) {
+		plan, _ := Compile([]types.Rule{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "[*].ssn"}}}})
+		path, isStreamable := plan.StreamPath()
+		assert.Equal(t, isStreamable, true)
+		assert.Equal(t, IsStreamed([]byte(" [1]"), path), true)
+		assert.Equal(t, IsStreamed([]byte(`{"ssn": 1}`), path), false)
+
+		content := `[{"ssn": "123", "name": "Ada"}, 42, "x", {"name": "Grace"}]`
+		output := bytes.NewBuffer(nil)
+		transformErr := ExecuteStream(strings.NewReader(content), plan, path, Layout{Compact: true}, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to stream json: %v", transformErr.Message)
+		}
+		assert.Equal(t, output.String(), `[{"ssn":"**redacted**","name":"Ada"},42,"x",{"name":"Grace"}]`)
+
+		// The value at the path isn't an array
+		content = `{"export": {"items": {"number": "4111"}}}`
+		plan, _ = Compile(cardRules)
+		output.Reset()
+		transformErr = ExecuteStream(strings.NewReader(content), plan, []string{"export", "items"}, DefaultLayout, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to stream json: %v", transformErr.Message)
+		}
+		assert.Equal(t, output.String(), transformInMemory(t, content, plan, DefaultLayout))
+	})
+
+	t.Run("rules that need the whole document", func(t *testing.T) {
+		cases := [][]types.Rule{
+			// A field outside of the array
+			{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "items[*].number"}, {ActionType: "EXCLUDE", FieldName: "vendor"}}}},
+			// Two arrays
+			{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "items[*].number"}, {ActionType: "REDACT", FieldName: "refunds[*].number"}}}},
+			// The match of stopProcessing is checked on the whole document
+			{{StopProcessing: true, Actions: []types.Action{{ActionType: "REDACT", FieldName: "items[*].number"}}}},
+			// ALL of the elements are checked before any of them is changed
+			{{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "items[*].type", Operator: "EQ", Value: "card", Quantifier: "ALL"}},
+				},
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "items[*].number"}},
+			}},
+			// A slice needs the indexes of the whole array, a recursive descent any depth of the document
+			{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "items[0:2].number"}}}},
+			{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "..number"}}}},
+		}
+		for _, rules := range cases {
+			plan, transformErr := Compile(rules)
+			if transformErr != nil {
+				t.Fatalf("Failed to compile rules: %v", transformErr.Message)
+			}
+			_, isStreamable := plan.StreamPath()
+			assert.Equal(t, isStreamable, false)
+		}
+	})
+
+	t.Run("quantifier on an array under the elements", func(t *testing.T) {
+		plan, _ := Compile([]types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions:     []types.Expressions{{FieldName: "export.items[*].tags[*]", Operator: "EQ", Value: "a", Quantifier: "ALL"}},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "export.items[*].number"}},
+		}})
+		path, isStreamable := plan.StreamPath()
+		assert.Equal(t, isStreamable, true)
+		output := bytes.NewBuffer(nil)
+		transformErr := ExecuteStream(strings.NewReader(nested), plan, path, DefaultLayout, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to stream json: %v", transformErr.Message)
+		}
+		assert.Equal(t, output.String(), transformInMemory(t, nested, plan, DefaultLayout))
+	})
+
+	t.Run("selectors under the elements", func(t *testing.T) {
+		plan, _ := Compile([]types.Rule{{Actions: []types.Action{
+			{ActionType: "REDACT", FieldName: "export.items[*]..number"},
+			{ActionType: "EXCLUDE", FieldName: "export.items[*].tags[-1]"},
+		}}})
+		path, isStreamable := plan.StreamPath()
+		assert.Equal(t, isStreamable, true)
+		output := bytes.NewBuffer(nil)
+		transformErr := ExecuteStream(strings.NewReader(nested), plan, path, DefaultLayout, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to stream json: %v", transformErr.Message)
+		}
+		assert.Equal(t, output.String(), transformInMemory(t, nested, plan, DefaultLayout))
+	})
+
+	t.Run("source read a few bytes at a time", func(t *testing.T) {
+		plan, _ := Compile(cardRules)
+		output := bytes.NewBuffer(nil)
+		source := &sourceReader{reader: iotest.HalfReader(strings.NewReader(nested))}
+		transformErr := ExecuteStream(source, plan, []string{"export", "items"}, DefaultLayout, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to stream json: %v", transformErr.Message)
+		}
+		assert.Equal(t, output.String(), transformInMemory(t, nested, plan, DefaultLayout))
+		assert.Equal(t, source.last, byte('\n'))
+		assert.Equal(t, source.err, nil)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		plan, _ := Compile(cardRules)
+		for _, content := range []string{`{"export": {"items": [{"type": "card"}`, `{"export": {"items": []}} {}`} {
+			transformErr := ExecuteStream(strings.NewReader(content), plan, []string{"export", "items"}, DefaultLayout, bytes.NewBuffer(nil))
+			assert.NotEqual(t, transformErr, nil)
+		}
+	})
+}
@@ -1,27 +1,92 @@
 package transformjson
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"lazy-lagoon/pkg/textencoding"
 	"lazy-lagoon/pkg/types"
 	"lazy-lagoon/storage"
 )
 
+// sampleSize is the number of bytes read ahead to detect the layout of the source, its first line break is usually in them
+const sampleSize = 64 * 1024
+
 /*
 Step 1: execute transform, and store in output storage
 */
 func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
 	/*
-		Downloading the file from the input storage type
+		Opening the file from the input storage type, decoded to UTF-8 as it's read
 	*/
-	byteContent, err := storage.GetBytes(input)
+	reader, encoding, err := storage.GetTextReader(input)
 	if err != nil {
 		return &types.TransformError{Message: err.Error()}
 	}
+	defer reader.Close()
+	// The output is written in the encoding of the input unless set
+	if output.Encoding != "" {
+		encoding = output.Encoding
+	}
+	plan, transformErr := Compile(rules)
+	if transformErr != nil {
+		return transformErr
+	}
+	// The layout and the array are detected on the first bytes, the rest is read as it's transformed
+	source := bufio.NewReaderSize(reader, sampleSize)
+	sample, err := source.Peek(sampleSize)
+	if err != nil && err != io.EOF {
+		return &types.TransformError{Message: err.Error()}
+	}
+	/*
+		Streaming the elements of the array the rules apply to, only the documents the rules need as a whole are loaded in memory
+	*/
+	if path, isStreamable := plan.StreamPath(); isStreamable && IsStreamed(sample, path) {
+		layout, err := OutputLayout(output.Json, sample)
+		if err != nil {
+			return &types.TransformError{Message: err.Error(), Key: "json"}
+		}
+		// The end of the source is only known once it's read
+		layout.TrailingNewline = false
+		upload, err := storage.NewMultipartWriter(output)
+		if err != nil {
+			return &types.TransformError{Message: err.Error()}
+		}
+		writer := &EncodingWriter{Output: upload, Encoding: encoding}
+		stream := &sourceReader{reader: source}
+		transformErr = ExecuteStream(stream, plan, path, layout, writer)
+		if stream.err != nil {
+			return &types.TransformError{Message: stream.err.Error()}
+		}
+		if transformErr != nil {
+			return transformErr
+		}
+		if stream.last == '\n' {
+			_, err = writer.Write([]byte("\n"))
+			if err != nil {
+				return &types.TransformError{Message: err.Error(), Key: "upload"}
+			}
+		}
+		err = upload.Close()
+		if err != nil {
+			return &types.TransformError{Message: err.Error(), Key: "upload"}
+		}
+		return nil
+	}
 	/*
 		Parsing the JSON document
 	*/
+	byteContent, err := io.ReadAll(source)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	// The output is written in the layout of the input unless set
+	layout, err := OutputLayout(output.Json, byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "json"}
+	}
 	jsonDocument, err := ToJson(byteContent)
 	if err != nil {
 		return &types.TransformError{
@@ -29,21 +94,25 @@ func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output
 		}
 	}
 	/*
-		Transforming the JSON document
+		Transforming the JSON document, nothing else holds on to the parsed document so it's mutated in place
 	*/
-	jsonDocument, transformErr := ExecuteRules(jsonDocument, rules)
+	jsonDocument, transformErr = plan.Execute(jsonDocument)
 	if transformErr != nil {
 		return transformErr
 	}
 	/*
 		Converting the JSON document back to bytes
 	*/
-	byteContent, err = FromJson(jsonDocument)
+	byteContent, err = Format(jsonDocument, layout)
 	if err != nil {
 		return &types.TransformError{
 			Message: err.Error(),
 		}
 	}
+	byteContent, err = textencoding.Encode(byteContent, encoding, true)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
 
 	// Store the transformed JSON bytes in the output storage type
 	err = storage.StoreBytes(output, byteContent)
@@ -56,115 +125,69 @@ func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output
 }
 
 /*
-Step 2: Transform the JSON document based on the rules
+Step 2: Transform the JSON document based on the rules, the given document is not mutated
 */
 func ExecuteRules(jsonDocument any, rules []types.Rule) (any, *types.TransformError) {
-	// Apply the rules to the document
-	for ruleIndex, rule := range rules {
-		for actionIndex, action := range rule.Actions {
-			var transformErr *types.TransformError
-			jsonDocument, transformErr = ExecuteAction(jsonDocument, rule.Expression, action.FieldName, action.ActionType, ruleIndex, actionIndex)
-			if transformErr != nil {
-				return nil, transformErr
-			}
-		}
-	}
-	return jsonDocument, nil
-}
-
-/*
-Step 3: Execute the actions by the actionType if the expressions are met
-*/
-func ExecuteAction(jsonDocument any, expression types.Expression, fieldName string, actionType string, ruleIndex int, actionIndex int) (any, *types.TransformError) {
-	if fieldName == "" {
-		// SKIP the action if the field name is empty
-		return jsonDocument, nil
-	}
-	// Creating a json pointer
-	pointer, err := MakePointer(fieldName)
-	if err != nil {
-		return nil, &types.TransformError{
-			Message:     err.Error(),
-			RuleIndex:   &ruleIndex,
-			ActionIndex: &actionIndex,
-			Key:         "fieldName",
-		}
-	}
-
-	// Creating a copy of the json document so the original is not mutated
-	var documentCopy any
-	if err := DeepCopyJSON(jsonDocument, &documentCopy); err != nil {
-		return nil, &types.TransformError{
-			Message:     err.Error(),
-			RuleIndex:   &ruleIndex,
-			ActionIndex: &actionIndex,
-			Key:         "fieldName",
-		}
-	}
-
-	// Manipulating the json document from the pointer tokens
-	transformErr := Mutate(documentCopy, documentCopy, pointer, expression, actionType, []int{}, ruleIndex, actionIndex)
+	plan, transformErr := Compile(rules)
 	if transformErr != nil {
 		return nil, transformErr
 	}
-
-	// Returning the mutated document
-	return documentCopy, nil
+	// Creating a copy of the json document so the original is not mutated
+	return plan.Execute(CopyJSON(jsonDocument))
 }
 
 /*
 	Helper functions
 */
-// Deep copy the JSON document
-func DeepCopyJSON(src, dst any) error {
-	// 1) Marshal the source into JSON bytes
-	b, err := json.Marshal(src)
-	if err != nil {
-		return fmt.Errorf("marshal failed: %w", err)
-	}
-	// 2) Unmarshal into the destination (which must be a pointer)
-	if err := json.Unmarshal(b, dst); err != nil {
-		return fmt.Errorf("unmarshal failed: %w", err)
+// Deep copy the decoded JSON document (objects, arrays and scalars)
+func CopyJSON(src any) any {
+	switch typedSrc := src.(type) {
+	case *Object:
+		dst := &Object{keys: append([]string{}, typedSrc.keys...), values: make(map[string]any, len(typedSrc.values))}
+		for key, value := range typedSrc.values {
+			dst.values[key] = CopyJSON(value)
+		}
+		return dst
+	case map[string]any:
+		dst := make(map[string]any, len(typedSrc))
+		for key, value := range typedSrc {
+			dst[key] = CopyJSON(value)
+		}
+		return dst
+	case []any:
+		dst := make([]any, len(typedSrc))
+		for index, value := range typedSrc {
+			dst[index] = CopyJSON(value)
+		}
+		return dst
 	}
-	return nil
+	// Scalars are immutable
+	return src
 }
 
-// Convert the bytes to a JSON document
+// Convert the bytes to a JSON document, objects keep the order of their keys and numbers are kept as json.Number so they are written back exactly as they were
 func ToJson(content []byte) (any, error) {
-	var jsonDocument any
-	// Unmarshal root json
-	err := json.Unmarshal(content, &jsonDocument)
+	// Decode root json
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	jsonDocument, err := decodeValue(decoder)
 	if err != nil {
 		return nil, fmt.Errorf("unmarshalling json error, not valid json")
 	}
-	return jsonDocument, nil
-}
-
-// Convert the JSON document to bytes
-func FromJson(jsonDocument any) ([]byte, error) {
-	// marshalling json back together
-	newBytes, err := json.Marshal(jsonDocument)
-	if err != nil {
-		return nil, err
-	}
-	
-	// Fixing json indentation to be pretty :)
-	var prettyJSON bytes.Buffer
-	err = json.Indent(&prettyJSON, newBytes, "", "\t")
+	// Only whitespace may follow the document
+	err = readEnd(decoder)
 	if err != nil {
 		return nil, err
 	}
+	return jsonDocument, nil
+}
 
-	return prettyJSON.Bytes(), nil
+// Convert the JSON document to bytes, indented with tabs
+func FromJson(jsonDocument any) ([]byte, error) {
+	return Format(jsonDocument, DefaultLayout)
 }
 
 // Convert the JSONL document to bytes - basically just not prettifying the json
 func FromJsonl(jsonDocument any) ([]byte, error) {
-	// marshalling json back together
-	newBytes, err := json.Marshal(jsonDocument)
-	if err != nil {
-		return nil, err
-	}
-	
-	return newBytes, nil
+	return Format(jsonDocument, Layout{Compact: true})
 }
\ No newline at end of file
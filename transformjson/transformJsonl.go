@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"lazy-lagoon/pkg/concurrent"
+	"lazy-lagoon/pkg/textencoding"
 	"lazy-lagoon/pkg/types"
 	"lazy-lagoon/storage"
 )
@@ -11,12 +12,21 @@ import (
 // ExecuteTransformJsonl processes JSONL content concurrently and handles multipart uploads
 func ExecuteTransformJsonl(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
 	/*
-		Downloading the file from the input storage type
+		Downloading the file from the input storage type, decoded to UTF-8
 	*/
-	byteContent, err := storage.GetBytes(input)
+	byteContent, encoding, err := storage.GetText(input)
 	if err != nil {
 		return &types.TransformError{Message: err.Error()}
 	}
+	// The output is written in the encoding of the input unless set
+	if output.Encoding != "" {
+		encoding = output.Encoding
+	}
+	// Compile the rules once for every line
+	plan, transformErr := Compile(rules)
+	if transformErr != nil {
+		return transformErr
+	}
 	// Split content into lines
 	lines := bytes.Split(byteContent, []byte("\n"))
 
@@ -48,25 +58,13 @@ func ExecuteTransformJsonl(input types.Input, rules []types.Rule, output types.O
 	}
 
 	// If output is specified, transform and upload the data
-	return processJsonlWithOutput(chunks, rules, output)
+	return processJsonlWithOutput(chunks, plan, encoding, output)
 }
 
 // processJsonlWithOutput transforms the JSONL lines and uploads them to the specified output
-func processJsonlWithOutput(chunks [][][]byte, rules []types.Rule, output types.Output) *types.TransformError {
-	// Create a client for multipart uploads
-	client, uploadId, err := storage.CreateMultiPartClient(output)
-	if err != nil {
-		return &types.TransformError{Message: err.Error()}
-	}
-
-	// Initialize uploadedParts based on storage type
-	uploadedParts, err := storage.InitializeUploadedParts(output)
-	if err != nil {
-		return &types.TransformError{Message: err.Error()}
-	}
-
-	// Process each chunk
-	transformErr := concurrent.ForEachVoid(chunks, func(chunk [][]byte, chunkIndex int) *types.TransformError {
+func processJsonlWithOutput(chunks [][][]byte, plan *Plan, encoding string, output types.Output) *types.TransformError {
+	// Transform the chunks concurrently, in the order of the file
+	transformedChunks, transformErr := concurrent.ForEach(chunks, func(chunk [][]byte, chunkIndex int) ([]byte, *types.TransformError) {
 		var buffer []byte
 
 		// Process each line in the chunk
@@ -74,56 +72,52 @@ func processJsonlWithOutput(chunks [][][]byte, rules []types.Rule, output types.
 			// Parse the JSON line
 			jsonDoc, err := ToJson(line)
 			if err != nil {
-				return &types.TransformError{Message: fmt.Sprintf("error parsing JSON line %d: %v", lineIndex+1, err)}
+				return nil, &types.TransformError{Message: fmt.Sprintf("error parsing JSON line %d: %v", lineIndex+1, err)}
 			}
 
 			// Transform the JSON document
-			transformedDoc, transformErr := ExecuteRules(jsonDoc, rules)
+			transformedDoc, transformErr := plan.Execute(jsonDoc)
 			if transformErr != nil {
-				return transformErr
+				return nil, transformErr
 			}
 
 			// Convert back to bytes
 			transformedBytes, err := FromJsonl(transformedDoc)
 			if err != nil {
-				return &types.TransformError{Message: fmt.Sprintf("error converting transformed JSON to bytes: %v", err)}
+				return nil, &types.TransformError{Message: fmt.Sprintf("error converting transformed JSON to bytes: %v", err)}
 			}
 
-			// Add to buffer with newline
-			if len(buffer) > 0 {
-				buffer = append(buffer, '\n')
-			}
+			// Every line ends with a newline, the chunks are written one after the other
 			buffer = append(buffer, transformedBytes...)
-		}
-
-		// Upload the transformed chunk
-		var partNumber int64 = int64(chunkIndex + 1)
-		isLastChunk := chunkIndex == (len(chunks) - 1)
-
-		// Ensure the last chunk ends with a newline
-		if isLastChunk && len(buffer) > 0 && buffer[len(buffer)-1] != '\n' {
 			buffer = append(buffer, '\n')
 		}
 
-		uploadedPart, err := storage.UploadAndCompleteChunk(client, output, partNumber, uploadId, buffer, isLastChunk, uploadedParts)
+		buffer, err := textencoding.Encode(buffer, encoding, chunkIndex == 0)
 		if err != nil {
-			return &types.TransformError{Message: err.Error()}
+			return nil, &types.TransformError{Message: err.Error()}
 		}
-
-		// Update uploadedParts with the new part
-		uploadedParts, err = storage.UpdateUploadedParts(output, uploadedParts, uploadedPart, partNumber)
-		if err != nil {
-			return &types.TransformError{Message: err.Error()}
-		}
-
-		partNumber++
-		return nil
+		return buffer, nil
 	})
-
 	if transformErr != nil {
 		return transformErr
 	}
 
-	// Return empty byte slice as the data has been uploaded
+	/*
+		Uploading the chunks in order, the multipart writer compresses them and splits them into parts
+	*/
+	upload, err := storage.NewMultipartWriter(output)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	for _, buffer := range transformedChunks {
+		_, err = upload.Write(buffer)
+		if err != nil {
+			return &types.TransformError{Message: err.Error(), Key: "upload"}
+		}
+	}
+	err = upload.Close()
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
 	return nil
 }
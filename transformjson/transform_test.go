@@ -1,6 +1,7 @@
 package transformjson
 
 import (
+	"encoding/json"
 	"testing"
 
 	"lazy-lagoon/pkg/types"
@@ -489,3 +490,66 @@ func TestObscure(t *testing.T) {
 		assert.Equal(t, mutatedJson, redactedJson)
 	})
 }
+
+func TestNumberPrecision(t *testing.T) {
+	content := []byte(`{"accountId": 1234567890123456789, "balance": 0.10000000000000000001, "small": 1e-7, "accounts": [{"id": 9007199254740993, "owner": "Alice"}, {"id": 9007199254740992, "owner": "Bob"}]}`)
+
+	t.Run("numbers are written back exactly", func(t *testing.T) {
+		jsonDocument, err := ToJson(content)
+		if err != nil {
+			t.Fatalf("Failed to convert to json: %v", err)
+		}
+		mutatedJson, transformErr := ExecuteRules(jsonDocument, []types.Rule{{
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "accounts[*].owner"}},
+		}})
+		if transformErr != nil {
+			t.Fatalf("Failed to execute rule: %v", transformErr)
+		}
+		byteContent, err := FromJsonl(mutatedJson)
+		if err != nil {
+			t.Fatalf("Failed to convert json to bytes: %v", err)
+		}
+		assert.Equal(t, string(byteContent), `{"accountId":1234567890123456789,"balance":0.10000000000000000001,"small":1e-7,"accounts":[{"id":9007199254740993,"owner":"**redacted**"},{"id":9007199254740992,"owner":"**redacted**"}]}`)
+	})
+
+	t.Run("large ids are compared exactly", func(t *testing.T) {
+		jsonDocument, err := ToJson(content)
+		if err != nil {
+			t.Fatalf("Failed to convert to json: %v", err)
+		}
+		// 9007199254740993 and 9007199254740992 are the same float64
+		mutatedJson, transformErr := ExecuteRules(jsonDocument, []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions: []types.Expressions{
+					{FieldName: "accounts[*].id", Operator: "EQ", Value: json.Number("9007199254740993")},
+				},
+			},
+			Actions: []types.Action{{ActionType: "REDACT", FieldName: "accounts[*].owner"}},
+		}})
+		if transformErr != nil {
+			t.Fatalf("Failed to execute rule: %v", transformErr)
+		}
+		owners, err := GetPointerArrayValues([]string{"accounts", "*", "owner"}, mutatedJson)
+		if err != nil {
+			t.Fatalf("Failed to get pointer value: %v", err)
+		}
+		assert.Equal(t, owners, []any{"**redacted**", "Bob"})
+
+		met, transformErr := IsExpressionMet(types.Expression{
+			LogicalOperator: "AND",
+			Expressions: []types.Expressions{
+				{FieldName: "balance", Operator: "GT", Value: json.Number("0.1")},
+			},
+		}, []int{}, 0, jsonDocument)
+		if transformErr != nil {
+			t.Fatalf("Failed to check if expression is met: %v", transformErr)
+		}
+		assert.Equal(t, met, true)
+	})
+
+	t.Run("trailing data is not valid json", func(t *testing.T) {
+		_, err := ToJson([]byte(`{"id": 1} {"id": 2}`))
+		assert.NotEqual(t, err, nil)
+	})
+}
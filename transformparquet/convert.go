@@ -0,0 +1,283 @@
+package transformparquet
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/xitongsys/parquet-go/parquet"
+)
+
+/*
+toDocument converts a row decoded by the reader into a JSON like document so the JSON rules can be applied.
+Numbers become json.Number (decimals are scaled), so they are compared exactly.
+*/
+func toDocument(value reflect.Value, node *field) any {
+	switch value.Kind() {
+	case reflect.Ptr:
+		// Optional values
+		if value.IsNil() {
+			return nil
+		}
+		return toDocument(value.Elem(), node)
+	case reflect.Struct:
+		// The struct fields are in the same order as the children
+		document := make(map[string]any, len(node.children))
+		for i, child := range node.children {
+			document[child.name] = toDocument(value.Field(i), child)
+		}
+		return document
+	case reflect.Slice:
+		element := node.elementField()
+		document := make([]any, value.Len())
+		for i := range document {
+			document[i] = toDocument(value.Index(i), element)
+		}
+		return document
+	case reflect.Map:
+		keyValue := node.children[0]
+		document := make(map[string]any, value.Len())
+		iterator := value.MapRange()
+		for iterator.Next() {
+			key := fmt.Sprint(columnToDocument(iterator.Key(), keyValue.children[0].element))
+			document[key] = toDocument(iterator.Value(), keyValue.children[1])
+		}
+		return document
+	}
+	return columnToDocument(value, node.element)
+}
+
+func columnToDocument(value reflect.Value, element *parquet.SchemaElement) any {
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Int32, reflect.Int64:
+		if isDecimal(element) {
+			return json.Number(decimalToString(big.NewInt(value.Int()), element.GetScale()))
+		}
+		return json.Number(strconv.FormatInt(value.Int(), 10))
+	case reflect.Float32:
+		return json.Number(strconv.FormatFloat(value.Float(), 'g', -1, 32))
+	case reflect.Float64:
+		return json.Number(strconv.FormatFloat(value.Float(), 'g', -1, 64))
+	case reflect.String:
+		if isDecimal(element) {
+			return json.Number(decimalToString(fromTwosComplement([]byte(value.String())), element.GetScale()))
+		}
+		return value.String()
+	}
+	return value.Interface()
+}
+
+/*
+fromDocument converts the transformed document back into the row type of the reader, keeping the column types of the schema.
+Values the column can't hold (e.g. **redacted** in a number column) and excluded values become null,
+or the zero value when the column is required (zero bytes of the column length for fixed length columns).
+It returns false when the document doesn't fit the type.
+*/
+func fromDocument(document any, rowType reflect.Type, node *field) (reflect.Value, bool) {
+	switch rowType.Kind() {
+	case reflect.Ptr:
+		if document == nil {
+			return reflect.Zero(rowType), true
+		}
+		value, ok := fromDocument(document, rowType.Elem(), node)
+		if !ok {
+			return reflect.Zero(rowType), true
+		}
+		pointer := reflect.New(rowType.Elem())
+		pointer.Elem().Set(value)
+		return pointer, true
+	case reflect.Struct:
+		object, ok := document.(map[string]any)
+		value := reflect.New(rowType).Elem()
+		for i, child := range node.children {
+			// The value is the placeholder of the column when it doesn't fit
+			childValue, _ := fromDocument(object[child.name], rowType.Field(i).Type, child)
+			value.Field(i).Set(childValue)
+		}
+		return value, ok
+	case reflect.Slice:
+		array, ok := document.([]any)
+		element := node.elementField()
+		value := reflect.MakeSlice(rowType, 0, len(array))
+		elementType := rowType.Elem()
+		for elementType.Kind() == reflect.Ptr {
+			elementType = elementType.Elem()
+		}
+		for _, item := range array {
+			if excluded, isArray := item.([]any); isArray && len(excluded) == 0 && elementType.Kind() != reflect.Slice {
+				// EXCLUDE replaces array elements with an empty array, the element is removed
+				continue
+			}
+			itemValue, _ := fromDocument(item, rowType.Elem(), element)
+			value = reflect.Append(value, itemValue)
+		}
+		return value, ok
+	case reflect.Map:
+		object, ok := document.(map[string]any)
+		keyValue := node.children[0]
+		value := reflect.MakeMapWithSize(rowType, len(object))
+		for key, item := range object {
+			keyResult, keyOk := fromDocument(key, rowType.Key(), keyValue.children[0])
+			itemValue, itemOk := fromDocument(item, rowType.Elem(), keyValue.children[1])
+			if keyOk && itemOk {
+				value.SetMapIndex(keyResult, itemValue)
+			}
+		}
+		return value, ok
+	}
+	return columnFromDocument(document, rowType, node.element)
+}
+
+// columnFromDocument returns the placeholder of the column with false when the value doesn't fit
+func columnFromDocument(document any, columnType reflect.Type, element *parquet.SchemaElement) (reflect.Value, bool) {
+	value := reflect.New(columnType).Elem()
+	if columnType.Kind() == reflect.String {
+		value.SetString(string(make([]byte, fixedLength(element))))
+	}
+	switch columnType.Kind() {
+	case reflect.Bool:
+		boolean, ok := document.(bool)
+		value.SetBool(boolean)
+		return value, ok
+	case reflect.Int32, reflect.Int64:
+		text, ok := numberText(document)
+		if !ok {
+			return value, false
+		}
+		var integer int64
+		if isDecimal(element) {
+			unscaled, ok := decimalFromString(text, element.GetScale())
+			if !ok || !unscaled.IsInt64() {
+				return value, false
+			}
+			integer = unscaled.Int64()
+		} else {
+			var err error
+			if integer, err = strconv.ParseInt(text, 10, 64); err != nil {
+				return value, false
+			}
+		}
+		if value.OverflowInt(integer) {
+			return value, false
+		}
+		value.SetInt(integer)
+		return value, true
+	case reflect.Float32, reflect.Float64:
+		text, ok := numberText(document)
+		if !ok {
+			return value, false
+		}
+		float, err := strconv.ParseFloat(text, columnType.Bits())
+		if err != nil {
+			return value, false
+		}
+		value.SetFloat(float)
+		return value, true
+	case reflect.String:
+		if isDecimal(element) {
+			text, ok := numberText(document)
+			if !ok {
+				return value, false
+			}
+			unscaled, ok := decimalFromString(text, element.GetScale())
+			if !ok {
+				return value, false
+			}
+			binary, ok := toTwosComplement(unscaled, int(element.GetTypeLength()))
+			if !ok {
+				return value, false
+			}
+			value.SetString(string(binary))
+			return value, true
+		}
+		text, ok := document.(string)
+		if !ok {
+			return value, false
+		}
+		// Fixed length columns can't hold a value of another length
+		if element.GetType() == parquet.Type_INT96 && len(text) != 12 {
+			return value, false
+		}
+		if element.GetType() == parquet.Type_FIXED_LEN_BYTE_ARRAY && len(text) != int(element.GetTypeLength()) {
+			return value, false
+		}
+		value.SetString(text)
+		return value, true
+	}
+	return value, false
+}
+
+/*
+	Helper functions
+*/
+func numberText(document any) (string, bool) {
+	switch typedDocument := document.(type) {
+	case json.Number:
+		return typedDocument.String(), true
+	case string:
+		return typedDocument, true
+	}
+	return "", false
+}
+
+func isDecimal(element *parquet.SchemaElement) bool {
+	return element.ConvertedType != nil && *element.ConvertedType == parquet.ConvertedType_DECIMAL
+}
+
+// fixedLength returns the length of the values of INT96 and FIXED_LEN_BYTE_ARRAY columns, 0 for the others
+func fixedLength(element *parquet.SchemaElement) int {
+	switch element.GetType() {
+	case parquet.Type_INT96:
+		return 12
+	case parquet.Type_FIXED_LEN_BYTE_ARRAY:
+		return int(element.GetTypeLength())
+	}
+	return 0
+}
+
+func decimalToString(unscaled *big.Int, scale int32) string {
+	denominator := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	return new(big.Rat).SetFrac(unscaled, denominator).FloatString(int(scale))
+}
+
+// decimalFromString returns the unscaled value, false when the text has more decimals than the scale
+func decimalFromString(text string, scale int32) (*big.Int, bool) {
+	rat, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, false
+	}
+	rat.Mul(rat, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	if !rat.IsInt() {
+		return nil, false
+	}
+	return rat.Num(), true
+}
+
+// fromTwosComplement decodes a big endian two's complement integer (decimal byte arrays)
+func fromTwosComplement(binary []byte) *big.Int {
+	integer := new(big.Int).SetBytes(binary)
+	if len(binary) > 0 && binary[0]&0x80 != 0 {
+		integer.Sub(integer, new(big.Int).Lsh(big.NewInt(1), uint(len(binary)*8)))
+	}
+	return integer
+}
+
+// toTwosComplement encodes the integer on length bytes, or the fewest bytes when length is 0
+func toTwosComplement(integer *big.Int, length int) ([]byte, bool) {
+	if length == 0 {
+		length = integer.BitLen()/8 + 1
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(length*8-1))
+	if integer.Cmp(limit) >= 0 || integer.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return nil, false
+	}
+	encoded := new(big.Int).Set(integer)
+	if encoded.Sign() < 0 {
+		encoded.Add(encoded, new(big.Int).Lsh(limit, 1))
+	}
+	return encoded.FillBytes(make([]byte, length)), true
+}
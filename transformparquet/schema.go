@@ -0,0 +1,93 @@
+package transformparquet
+
+import (
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/schema"
+)
+
+/*
+field is a node of the Parquet schema tree. Groups have children, columns don't.
+*/
+type field struct {
+	// Name as written in the file (the reader renames the footer schema to go field names)
+	name     string
+	element  *parquet.SchemaElement
+	children []*field
+}
+
+// readSchema rebuilds the schema tree from the flat (depth first) schema list of the file
+func readSchema(schemaHandler *schema.SchemaHandler) *field {
+	position := 0
+	return buildField(schemaHandler, &position)
+}
+
+func buildField(schemaHandler *schema.SchemaHandler, position *int) *field {
+	element := schemaHandler.SchemaElements[*position]
+	node := &field{name: schemaHandler.Infos[*position].ExName, element: element}
+	*position++
+	for i := 0; i < int(element.GetNumChildren()); i++ {
+		node.children = append(node.children, buildField(schemaHandler, position))
+	}
+	return node
+}
+
+// schemaList flattens the tree back into a schema list with the original names, used to write the output with the input schema
+func (node *field) schemaList() []*parquet.SchemaElement {
+	element := *node.element
+	element.Name = node.name
+	list := []*parquet.SchemaElement{&element}
+	for _, child := range node.children {
+		list = append(list, child.schemaList()...)
+	}
+	return list
+}
+
+// isList checks for the LIST annotated group (group (LIST) { repeated group list { element } }), the reader decodes it as a slice
+func (node *field) isList() bool {
+	return node.element.ConvertedType != nil && *node.element.ConvertedType == parquet.ConvertedType_LIST &&
+		len(node.children) == 1 && common.StringToVariableName(node.children[0].name) == "List" &&
+		len(node.children[0].children) == 1 && common.StringToVariableName(node.children[0].children[0].name) == "Element"
+}
+
+// isMap checks for the MAP annotated group (group (MAP) { repeated group key_value { key, value } }), the reader decodes it as a map
+func (node *field) isMap() bool {
+	return node.element.ConvertedType != nil && *node.element.ConvertedType == parquet.ConvertedType_MAP &&
+		len(node.children) == 1 && common.StringToVariableName(node.children[0].name) == "Key_value" &&
+		len(node.children[0].children) == 2 &&
+		common.StringToVariableName(node.children[0].children[0].name) == "Key" &&
+		common.StringToVariableName(node.children[0].children[1].name) == "Value"
+}
+
+// elementField returns the field of the array elements, repeated fields are their own element
+func (node *field) elementField() *field {
+	if node.isList() {
+		return node.children[0].children[0]
+	}
+	return node
+}
+
+/*
+paths lists the paths of the columns and groups in the same notation as the JSON paths, arrays (LIST and repeated fields) use [*]
+*/
+func (node *field) paths(currentPath string, paths []string) []string {
+	for _, child := range node.children {
+		path := child.name
+		if currentPath != "" {
+			path = currentPath + "." + child.name
+		}
+		paths = append(paths, path)
+
+		switch {
+		case child.isMap():
+			// Map keys are data, only the map itself has a path
+		case child.isList() || child.element.GetRepetitionType() == parquet.FieldRepetitionType_REPEATED:
+			arrayPath := path + "[*]"
+			paths = append(paths, arrayPath)
+			paths = child.elementField().paths(arrayPath, paths)
+		default:
+			paths = child.paths(path, paths)
+		}
+	}
+	return paths
+}
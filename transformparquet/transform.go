@@ -0,0 +1,187 @@
+package transformparquet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+	"lazy-lagoon/transformjson"
+	"reflect"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	// Number of goroutines used by the reader and writer
+	parallelism = 4
+	// Rows decoded at a time
+	batchSize = 1000
+	// Rows are buffered until a row group is full, 64MB keeps the memory bounded and gives a few multipart upload parts per row group
+	rowGroupSize = 64 * 1024 * 1024
+)
+
+/*
+Step 1: execute transform, and store in output storage
+*/
+func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
+	/*
+		Downloading the file from the input storage type
+	*/
+	byteContent, err := storage.GetBytes(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	/*
+		The rows are transformed as JSON documents, the rules are compiled once for every row
+	*/
+	plan, transformErr := transformjson.Compile(rules)
+	if transformErr != nil {
+		return transformErr
+	}
+	/*
+		Writing the rows into a multipart upload as the row groups are flushed
+	*/
+	upload, err := storage.NewMultipartWriter(output)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	transformErr = ExecuteRows(byteContent, plan, upload)
+	if transformErr != nil {
+		return transformErr
+	}
+	err = upload.Close()
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
+	return nil
+}
+
+/*
+Step 2: Transform every row of the Parquet content and write it to the writer with the schema and compression of the input
+*/
+func ExecuteRows(byteContent []byte, plan *transformjson.Plan, output io.Writer) *types.TransformError {
+	parquetReader, root, err := newReader(byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	defer parquetReader.ReadStop()
+
+	parquetWriter, err := newWriter(output, root, compressionCodec(parquetReader))
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+
+	numRows := parquetReader.GetNumRows()
+	for read := int64(0); read < numRows; read += batchSize {
+		rows, err := parquetReader.ReadByNumber(int(min(batchSize, numRows-read)))
+		if err != nil {
+			return &types.TransformError{Message: fmt.Sprintf("error reading parquet rows: %v", err)}
+		}
+		for _, row := range rows {
+			rowValue := reflect.ValueOf(row)
+			// The document isn't shared so it's mutated in place
+			document, transformErr := plan.Execute(toDocument(rowValue, root))
+			if transformErr != nil {
+				return transformErr
+			}
+			transformed, _ := fromDocument(document, rowValue.Type(), root)
+			if err := parquetWriter.Write(transformed.Interface()); err != nil {
+				return &types.TransformError{Message: fmt.Sprintf("error writing parquet row: %v", err)}
+			}
+		}
+	}
+	if err := parquetWriter.WriteStop(); err != nil {
+		return &types.TransformError{Message: fmt.Sprintf("error writing parquet footer: %v", err)}
+	}
+	return nil
+}
+
+/*
+Paths returns the paths of the columns of the Parquet content, nested groups included
+*/
+func Paths(byteContent []byte) ([]string, error) {
+	parquetReader, root, err := newReader(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	defer parquetReader.ReadStop()
+	return root.paths("", []string{}), nil
+}
+
+/*
+Pages splits the Parquet content into Parquet files of rowsPerPage rows with the same schema - used for preview
+*/
+func Pages(byteContent []byte, rowsPerPage int) ([][]byte, error) {
+	parquetReader, root, err := newReader(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	defer parquetReader.ReadStop()
+
+	var pages [][]byte
+	numRows := parquetReader.GetNumRows()
+	for read := int64(0); read < numRows; read += int64(rowsPerPage) {
+		rows, err := parquetReader.ReadByNumber(int(min(int64(rowsPerPage), numRows-read)))
+		if err != nil {
+			return nil, fmt.Errorf("error reading parquet rows: %v", err)
+		}
+		page := bytes.NewBuffer(nil)
+		parquetWriter, err := newWriter(page, root, compressionCodec(parquetReader))
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if err := parquetWriter.Write(row); err != nil {
+				return nil, fmt.Errorf("error writing parquet row: %v", err)
+			}
+		}
+		if err := parquetWriter.WriteStop(); err != nil {
+			return nil, fmt.Errorf("error writing parquet footer: %v", err)
+		}
+		pages = append(pages, page.Bytes())
+	}
+	return pages, nil
+}
+
+/*
+	Helper functions
+*/
+// newReader opens the Parquet content with the schema of the file
+func newReader(byteContent []byte) (*reader.ParquetReader, *field, error) {
+	file, err := buffer.NewBufferFile(byteContent)
+	if err != nil {
+		return nil, nil, err
+	}
+	parquetReader, err := reader.NewParquetReader(file, nil, parallelism)
+	if err != nil {
+		return nil, nil, fmt.Errorf("file is not a valid parquet file: %v", err)
+	}
+	return parquetReader, readSchema(parquetReader.SchemaHandler), nil
+}
+
+// newWriter writes Parquet with the schema of the input
+func newWriter(output io.Writer, root *field, codec parquet.CompressionCodec) (*writer.ParquetWriter, error) {
+	parquetWriter, err := writer.NewParquetWriterFromWriter(output, root.schemaList(), parallelism)
+	if err != nil {
+		return nil, err
+	}
+	parquetWriter.RowGroupSize = rowGroupSize
+	parquetWriter.CompressionType = codec
+	return parquetWriter, nil
+}
+
+// compressionCodec returns the codec of the first column chunk of the input, snappy for empty files
+func compressionCodec(parquetReader *reader.ParquetReader) parquet.CompressionCodec {
+	for _, rowGroup := range parquetReader.Footer.RowGroups {
+		for _, column := range rowGroup.Columns {
+			if column.MetaData != nil {
+				return column.MetaData.Codec
+			}
+		}
+	}
+	return parquet.CompressionCodec_SNAPPY
+}
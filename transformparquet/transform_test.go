@@ -0,0 +1,193 @@
+package transformparquet
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/transformjson"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type account struct {
+	Id      int64    `parquet:"name=id, type=INT64"`
+	Email   *string  `parquet:"name=email, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Balance int64    `parquet:"name=balance, type=INT64, convertedtype=DECIMAL, scale=2, precision=18"`
+	Score   *float64 `parquet:"name=score, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Tags    []string `parquet:"name=tags, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+}
+
+func writeAccounts(t *testing.T, accounts []account) []byte {
+	content := bytes.NewBuffer(nil)
+	parquetWriter, err := writer.NewParquetWriterFromWriter(content, new(account), 1)
+	if err != nil {
+		t.Fatalf("Failed to create parquet writer: %v", err)
+	}
+	for _, row := range accounts {
+		if err := parquetWriter.Write(row); err != nil {
+			t.Fatalf("Failed to write parquet row: %v", err)
+		}
+	}
+	if err := parquetWriter.WriteStop(); err != nil {
+		t.Fatalf("Failed to close parquet writer: %v", err)
+	}
+	return content.Bytes()
+}
+
+func readDocuments(t *testing.T, content []byte) []any {
+	parquetReader, root, err := newReader(content)
+	if err != nil {
+		t.Fatalf("Failed to read parquet: %v", err)
+	}
+	defer parquetReader.ReadStop()
+	rows, err := parquetReader.ReadByNumber(int(parquetReader.GetNumRows()))
+	if err != nil {
+		t.Fatalf("Failed to read parquet rows: %v", err)
+	}
+	documents := []any{}
+	for _, row := range rows {
+		documents = append(documents, toDocument(reflect.ValueOf(row), root))
+	}
+	return documents
+}
+
+func TestExecuteRows(t *testing.T) {
+	email := "ada@example.com"
+	high, low := 80.5, 10.0
+	content := writeAccounts(t, []account{
+		{Id: 1, Email: &email, Balance: 1234, Score: &high, Tags: []string{"vip", "beta"}},
+		{Id: 2, Balance: -5, Score: &low, Tags: []string{}},
+	})
+
+	t.Run("paths of the columns", func(t *testing.T) {
+		paths, err := Paths(content)
+		if err != nil {
+			t.Fatalf("Failed to get paths: %v", err)
+		}
+		assert.Equal(t, paths, []string{"id", "email", "balance", "score", "tags", "tags[*]"})
+	})
+
+	t.Run("schema and types are kept after the actions", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "score", Operator: "GT", Value: 50}},
+				},
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "email"}},
+			},
+			{
+				// Decimals are compared with their scale
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "balance", Operator: "LT", Value: "0"}},
+				},
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "id"}},
+			},
+			{Actions: []types.Action{{ActionType: "REDACT", FieldName: "balance"}}},
+			{Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "score"}}},
+			{Actions: []types.Action{{ActionType: "REDACT", FieldName: "tags[*]"}}},
+		}
+		plan, transformErr := transformjson.Compile(rules)
+		if transformErr != nil {
+			t.Fatalf("Failed to compile rules: %v", transformErr)
+		}
+		output := bytes.NewBuffer(nil)
+		transformErr = ExecuteRows(content, plan, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform parquet: %v", transformErr)
+		}
+
+		// Number columns can't hold **redacted**, required ones get the zero value and optional ones null
+		assert.Equal(t, readDocuments(t, output.Bytes()), []any{
+			map[string]any{
+				"id":      json.Number("1"),
+				"email":   "**redacted**",
+				"balance": json.Number("0.00"),
+				"score":   nil,
+				"tags":    []any{"**redacted**", "**redacted**"},
+			},
+			map[string]any{
+				"id":      json.Number("0"),
+				"email":   nil,
+				"balance": json.Number("0.00"),
+				"score":   nil,
+				"tags":    []any{},
+			},
+		})
+	})
+
+	t.Run("pages keep the schema", func(t *testing.T) {
+		pages, err := Pages(content, 1)
+		if err != nil {
+			t.Fatalf("Failed to paginate parquet: %v", err)
+		}
+		assert.Equal(t, len(pages), 2)
+		assert.Equal(t, readDocuments(t, pages[1])[0].(map[string]any)["balance"], json.Number("-0.05"))
+	})
+}
+
+func TestDecimals(t *testing.T) {
+	for _, value := range []int64{0, 5, -5, 127, 128, -128, -129, 1 << 40} {
+		encoded, ok := toTwosComplement(big.NewInt(value), 0)
+		assert.Equal(t, ok, true)
+		assert.Equal(t, fromTwosComplement(encoded).Int64(), value)
+	}
+	_, ok := toTwosComplement(big.NewInt(128), 1)
+	assert.Equal(t, ok, false)
+
+	unscaled, ok := decimalFromString("-12.5", 2)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, unscaled.Int64(), int64(-1250))
+	assert.Equal(t, decimalToString(unscaled, 2), "-12.50")
+	_, ok = decimalFromString("1.005", 2)
+	assert.Equal(t, ok, false)
+}
+
+type card struct {
+	Code   string `parquet:"name=code, type=FIXED_LEN_BYTE_ARRAY, length=4"`
+	Amount string `parquet:"name=amount, type=FIXED_LEN_BYTE_ARRAY, convertedtype=DECIMAL, scale=2, precision=9, length=4"`
+}
+
+func TestFixedLengthColumns(t *testing.T) {
+	content := bytes.NewBuffer(nil)
+	parquetWriter, err := writer.NewParquetWriterFromWriter(content, new(card), 1)
+	if err != nil {
+		t.Fatalf("Failed to create parquet writer: %v", err)
+	}
+	amount, _ := toTwosComplement(big.NewInt(1250), 4)
+	if err := parquetWriter.Write(card{Code: "ABCD", Amount: string(amount)}); err != nil {
+		t.Fatalf("Failed to write parquet row: %v", err)
+	}
+	if err := parquetWriter.WriteStop(); err != nil {
+		t.Fatalf("Failed to close parquet writer: %v", err)
+	}
+
+	plan, transformErr := transformjson.Compile([]types.Rule{{
+		Actions: []types.Action{
+			{ActionType: "REDACT", FieldName: "code"},
+			{ActionType: "REDACT", FieldName: "amount"},
+		},
+	}})
+	if transformErr != nil {
+		t.Fatalf("Failed to compile rules: %v", transformErr)
+	}
+	output := bytes.NewBuffer(nil)
+	transformErr = ExecuteRows(content.Bytes(), plan, output)
+	if transformErr != nil {
+		t.Fatalf("Failed to transform parquet: %v", transformErr)
+	}
+
+	// **redacted** doesn't fit the columns, the values keep the length of the column
+	assert.Equal(t, readDocuments(t, output.Bytes()), []any{
+		map[string]any{
+			"code":   "\x00\x00\x00\x00",
+			"amount": json.Number("0.00"),
+		},
+	})
+}
@@ -0,0 +1,68 @@
+package transformprotobuf
+
+import (
+	"encoding/base64"
+	"fmt"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+/*
+MessageDescriptor returns the descriptor of the message of the input, from the descriptor set of the request or the descriptor set file it references
+*/
+func MessageDescriptor(input types.Input) (protoreflect.MessageDescriptor, error) {
+	options := input.Protobuf
+	if options == nil || options.Message == "" {
+		return nil, fmt.Errorf("protobuf input requires the message name and a descriptor set")
+	}
+	var content []byte
+	var err error
+	if options.DescriptorSet != "" {
+		content, err = base64.StdEncoding.DecodeString(options.DescriptorSet)
+		if err != nil {
+			return nil, fmt.Errorf("descriptor set is not valid base64: %v", err)
+		}
+	} else if options.DescriptorSetReference != nil {
+		// The descriptor set is read from the storage of the input, with its credential
+		content, err = storage.GetBytes(types.Input{
+			StorageType: input.StorageType,
+			Reference:   *options.DescriptorSetReference,
+			Credential:  input.Credential,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading the descriptor set: %v", err)
+		}
+	} else {
+		return nil, fmt.Errorf("protobuf input requires the message name and a descriptor set")
+	}
+	return ParseDescriptor(content, options.Message)
+}
+
+/*
+ParseDescriptor finds the message in the serialized FileDescriptorSet, the set must include the imports of the file of the message
+*/
+func ParseDescriptor(content []byte, message string) (protoreflect.MessageDescriptor, error) {
+	descriptorSet := &descriptorpb.FileDescriptorSet{}
+	err := proto.Unmarshal(content, descriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor set is not a valid FileDescriptorSet: %v", err)
+	}
+	files, err := protodesc.NewFiles(descriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor set could not be resolved, it must include the imports (--include_imports): %v", err)
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		return nil, fmt.Errorf("message %s not found in the descriptor set", message)
+	}
+	messageDescriptor, isMessage := descriptor.(protoreflect.MessageDescriptor)
+	if !isMessage {
+		return nil, fmt.Errorf("%s is not a message of the descriptor set", message)
+	}
+	return messageDescriptor, nil
+}
@@ -0,0 +1,221 @@
+package transformprotobuf
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"lazy-lagoon/transformjson"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+/*
+toDocument converts the message into a JSON like document so the JSON rules can be applied.
+The keys are the field names of the .proto file in the order of the fields, only the fields that are set are in the document.
+Numbers are json.Number, enums are the names of their values, bytes are base64 and the keys of maps are strings.
+*/
+func toDocument(message protoreflect.Message) *transformjson.Object {
+	object := transformjson.NewObject()
+	fields := message.Descriptor().Fields()
+	for index := 0; index < fields.Len(); index++ {
+		field := fields.Get(index)
+		if !message.Has(field) {
+			continue
+		}
+		value := message.Get(field)
+		switch {
+		case field.IsList():
+			list := value.List()
+			array := make([]any, list.Len())
+			for element := range array {
+				array[element] = toValue(field, list.Get(element))
+			}
+			object.Set(string(field.Name()), array)
+		case field.IsMap():
+			entries := transformjson.NewObject()
+			for _, key := range mapKeys(value.Map()) {
+				entries.Set(key.String(), toValue(field.MapValue(), value.Map().Get(key)))
+			}
+			object.Set(string(field.Name()), entries)
+		default:
+			object.Set(string(field.Name()), toValue(field, value))
+		}
+	}
+	return object
+}
+
+/*
+applyDocument writes the transformed document back into the message, the fields the rules didn't change (and the unknown fields) are kept as they were decoded.
+The original is the document before the rules. Excluded fields, elements and map entries are removed, values replaced by the actions (e.g. **redacted**) are written
+in the string and bytes fields, the fields of the other kinds are reset to their default value.
+*/
+func applyDocument(message protoreflect.Message, object *transformjson.Object, original *transformjson.Object) {
+	fields := message.Descriptor().Fields()
+	for _, key := range original.Keys() {
+		field := fields.ByName(protoreflect.Name(key))
+		if field == nil {
+			continue
+		}
+		originalValue, _ := original.Get(key)
+		value, exists := object.Get(key)
+		switch {
+		case !exists:
+			message.Clear(field)
+		case reflect.DeepEqual(value, originalValue):
+		case field.IsList():
+			applyList(message, field, value, originalValue)
+		case field.IsMap():
+			applyMap(message, field, value, originalValue)
+		default:
+			current := message.Get(field)
+			if field.Message() != nil {
+				current = message.Mutable(field)
+			}
+			applied, isApplied := applyValue(field, current, value, originalValue)
+			if isApplied {
+				message.Set(field, applied)
+			} else {
+				message.Clear(field)
+			}
+		}
+	}
+}
+
+/*
+	Helper functions
+*/
+// toValue converts a singular value, an element of a list or a value of a map
+func toValue(field protoreflect.FieldDescriptor, value protoreflect.Value) any {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return toDocument(value.Message())
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+			return string(enumValue.Name())
+		}
+		return json.Number(strconv.Itoa(int(value.Enum())))
+	case protoreflect.BoolKind:
+		return value.Bool()
+	case protoreflect.StringKind:
+		return value.String()
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(value.Bytes())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return json.Number(strconv.FormatInt(value.Int(), 10))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return json.Number(strconv.FormatUint(value.Uint(), 10))
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		number := value.Float()
+		if math.IsInf(number, 0) || math.IsNaN(number) {
+			return strconv.FormatFloat(number, 'g', -1, 64)
+		}
+		return json.Number(strconv.FormatFloat(number, 'g', -1, 64))
+	}
+	return value.Interface()
+}
+
+// applyValue returns the singular value, list element or map value after the rules, false when it was replaced by a value its kind can't hold
+func applyValue(field protoreflect.FieldDescriptor, current protoreflect.Value, value any, original any) (protoreflect.Value, bool) {
+	if reflect.DeepEqual(value, original) {
+		return current, true
+	}
+	if field.Message() != nil {
+		object, isObject := value.(*transformjson.Object)
+		originalObject, isOriginalObject := original.(*transformjson.Object)
+		if isObject && isOriginalObject {
+			applyDocument(current.Message(), object, originalObject)
+			return current, true
+		}
+		return protoreflect.Value{}, false
+	}
+	text := ""
+	if value != nil {
+		text = fmt.Sprint(value)
+	}
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(text), true
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(text)), true
+	}
+	return protoreflect.Value{}, false
+}
+
+// applyList rebuilds the repeated field without the excluded elements, a replaced list is cleared
+func applyList(message protoreflect.Message, field protoreflect.FieldDescriptor, value any, original any) {
+	list := message.Mutable(field).List()
+	array, isArray := value.([]any)
+	originalArray, _ := original.([]any)
+	if !isArray || len(array) != list.Len() || len(originalArray) != list.Len() {
+		message.Clear(field)
+		return
+	}
+	applied := message.NewField(field).List()
+	for index := range array {
+		if isExcluded(array[index], originalArray[index]) {
+			continue
+		}
+		element, isApplied := applyValue(field, list.Get(index), array[index], originalArray[index])
+		if !isApplied {
+			element = list.NewElement()
+		}
+		applied.Append(element)
+	}
+	message.Set(field, protoreflect.ValueOfList(applied))
+}
+
+// applyMap removes the excluded entries of the map field and applies the changed values, a replaced map is cleared
+func applyMap(message protoreflect.Message, field protoreflect.FieldDescriptor, value any, original any) {
+	entries := message.Mutable(field).Map()
+	object, isObject := value.(*transformjson.Object)
+	originalObject, _ := original.(*transformjson.Object)
+	if !isObject || originalObject == nil {
+		message.Clear(field)
+		return
+	}
+	for _, key := range mapKeys(entries) {
+		entryValue, exists := object.Get(key.String())
+		if !exists {
+			entries.Clear(key)
+			continue
+		}
+		entryOriginal, _ := originalObject.Get(key.String())
+		current := entries.Get(key)
+		if field.MapValue().Message() != nil {
+			current = entries.Mutable(key)
+		}
+		applied, isApplied := applyValue(field.MapValue(), current, entryValue, entryOriginal)
+		if !isApplied {
+			applied = entries.NewValue()
+		}
+		entries.Set(key, applied)
+	}
+}
+
+// mapKeys returns the keys of the map sorted by their string, the order of a map isn't kept by the encoding
+func mapKeys(entries protoreflect.Map) []protoreflect.MapKey {
+	keys := make([]protoreflect.MapKey, 0, entries.Len())
+	entries.Range(func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+// isExcluded checks for the empty array left in place of an excluded element
+func isExcluded(value any, original any) bool {
+	array, isArray := value.([]any)
+	if !isArray || len(array) > 0 {
+		return false
+	}
+	originalArray, isOriginalArray := original.([]any)
+	return !isOriginalArray || len(originalArray) > 0
+}
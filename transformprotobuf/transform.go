@@ -0,0 +1,182 @@
+package transformprotobuf
+
+import (
+	"fmt"
+	"io"
+	"lazy-lagoon/pkg/concurrent"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+	"lazy-lagoon/transformjson"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Size of the chunks of messages transformed concurrently
+const chunkSize = 5 * 1024 * 1024 // 5MB in bytes
+
+/*
+Step 1: execute transform, and store in output storage
+*/
+func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
+	/*
+		Downloading the file from the input storage type
+	*/
+	byteContent, err := storage.GetBytes(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	descriptor, err := MessageDescriptor(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	/*
+		Writing the messages into a multipart upload
+	*/
+	upload, err := storage.NewMultipartWriter(output)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	transformErr := ExecuteRules(byteContent, descriptor, rules, upload)
+	if transformErr != nil {
+		return transformErr
+	}
+	err = upload.Close()
+	if err != nil {
+		return &types.TransformError{Message: err.Error(), Key: "upload"}
+	}
+	return nil
+}
+
+/*
+Step 2: Transform every message of the length-delimited stream as a JSON document, like the lines of a JSONL file,
+and write it back length-delimited. The chunks of messages are transformed concurrently and written in the order of the stream.
+*/
+func ExecuteRules(byteContent []byte, descriptor protoreflect.MessageDescriptor, rules []types.Rule, output io.Writer) *types.TransformError {
+	frames, err := readFrames(byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	plan, transformErr := transformjson.Compile(rules)
+	if transformErr != nil {
+		return transformErr
+	}
+
+	// Splitting the messages into chunks, with the index of their first message for the errors
+	type chunk struct {
+		start  int
+		frames [][]byte
+	}
+	var chunks []chunk
+	currentSize := 0
+	for index, frame := range frames {
+		if len(chunks) == 0 || currentSize+len(frame) > chunkSize {
+			chunks = append(chunks, chunk{start: index})
+			currentSize = 0
+		}
+		chunks[len(chunks)-1].frames = append(chunks[len(chunks)-1].frames, frame)
+		currentSize += len(frame)
+	}
+
+	transformedChunks, transformErr := concurrent.ForEach(chunks, func(messages chunk, chunkIndex int) ([]byte, *types.TransformError) {
+		var buffer []byte
+		for index, frame := range messages.frames {
+			message := dynamicpb.NewMessage(descriptor)
+			err := proto.Unmarshal(frame, message)
+			if err != nil {
+				return nil, &types.TransformError{Message: fmt.Sprintf("error decoding protobuf message %d: %v", messages.start+index+1, err)}
+			}
+			original := toDocument(message)
+			jsonDocument, transformErr := plan.Execute(transformjson.CopyJSON(original))
+			if transformErr != nil {
+				return nil, transformErr
+			}
+			object, isObject := jsonDocument.(*transformjson.Object)
+			if !isObject {
+				object = transformjson.NewObject()
+			}
+			applyDocument(message, object, original)
+			encoded, err := proto.Marshal(message)
+			if err != nil {
+				return nil, &types.TransformError{Message: fmt.Sprintf("error encoding protobuf message %d: %v", messages.start+index+1, err)}
+			}
+			buffer = protowire.AppendVarint(buffer, uint64(len(encoded)))
+			buffer = append(buffer, encoded...)
+		}
+		return buffer, nil
+	})
+	if transformErr != nil {
+		return transformErr
+	}
+
+	for _, buffer := range transformedChunks {
+		_, err = output.Write(buffer)
+		if err != nil {
+			return &types.TransformError{Message: err.Error(), Key: "upload"}
+		}
+	}
+	return nil
+}
+
+/*
+ToDocuments decodes every message of the length-delimited stream into the JSON like document the rules are applied to
+*/
+func ToDocuments(byteContent []byte, descriptor protoreflect.MessageDescriptor) ([]any, error) {
+	frames, err := readFrames(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	documents := make([]any, len(frames))
+	for index, frame := range frames {
+		message := dynamicpb.NewMessage(descriptor)
+		err := proto.Unmarshal(frame, message)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding protobuf message %d: %v", index+1, err)
+		}
+		documents[index] = toDocument(message)
+	}
+	return documents, nil
+}
+
+/*
+Pages splits the length-delimited stream into streams of messagesPerPage messages, the messages are copied without decoding them - used for preview
+*/
+func Pages(byteContent []byte, messagesPerPage int) ([][]byte, error) {
+	frames, err := readFrames(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	var pages [][]byte
+	for start := 0; start < len(frames); start += messagesPerPage {
+		var page []byte
+		for _, frame := range frames[start:min(start+messagesPerPage, len(frames))] {
+			page = protowire.AppendVarint(page, uint64(len(frame)))
+			page = append(page, frame...)
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+/*
+	Helper functions
+*/
+// readFrames splits the stream into the encoded messages, every message is preceded by its size as a varint
+func readFrames(byteContent []byte) ([][]byte, error) {
+	frames := [][]byte{}
+	for offset := 0; offset < len(byteContent); {
+		size, length := protowire.ConsumeVarint(byteContent[offset:])
+		if length < 0 {
+			return nil, fmt.Errorf("file is not a length-delimited protobuf stream: invalid size of message %d", len(frames)+1)
+		}
+		offset += length
+		if size > uint64(len(byteContent)-offset) {
+			return nil, fmt.Errorf("file is not a length-delimited protobuf stream: message %d is truncated", len(frames)+1)
+		}
+		frames = append(frames, byteContent[offset:offset+int(size)])
+		offset += int(size)
+	}
+	return frames, nil
+}
@@ -0,0 +1,167 @@
+package transformprotobuf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/transformjson"
+
+	"github.com/go-playground/assert/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// field describes a field of the test messages
+func field(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, repeated bool, typeName string) *descriptorpb.FieldDescriptorProto {
+	label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	if repeated {
+		label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	}
+	descriptor := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: kind.Enum(), Label: label.Enum()}
+	if typeName != "" {
+		descriptor.TypeName = proto.String(typeName)
+	}
+	return descriptor
+}
+
+// eventsDescriptorSet is the serialized descriptor set of events.Event, with its cards and status
+func eventsDescriptorSet(t *testing.T) string {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("events.proto"),
+		Package: proto.String("events"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("ACTIVE"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Card"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("type", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+					field("number", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+				},
+			},
+			{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, false, ""),
+					field("email", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+					field("cards", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, true, ".events.Card"),
+					field("amount", 4, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, false, ""),
+					field("status", 5, descriptorpb.FieldDescriptorProto_TYPE_ENUM, false, ".events.Status"),
+				},
+			},
+		},
+	}
+	content, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		t.Fatalf("Failed to encode descriptor set: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(content)
+}
+
+// writeEvents encodes the events as a length-delimited stream
+func writeEvents(t *testing.T, descriptor protoreflect.MessageDescriptor, emails ...string) []byte {
+	var content []byte
+	for index, email := range emails {
+		event := dynamicpb.NewMessage(descriptor)
+		fields := descriptor.Fields()
+		event.Set(fields.ByName("id"), protoreflect.ValueOfInt64(int64(index+1)))
+		event.Set(fields.ByName("email"), protoreflect.ValueOfString(email))
+		event.Set(fields.ByName("amount"), protoreflect.ValueOfFloat64(12.5))
+		event.Set(fields.ByName("status"), protoreflect.ValueOfEnum(1))
+		cards := event.Mutable(fields.ByName("cards")).List()
+		for _, cardType := range []string{"card", "iban"} {
+			card := cards.NewElement()
+			card.Message().Set(card.Message().Descriptor().Fields().ByName("type"), protoreflect.ValueOfString(cardType))
+			card.Message().Set(card.Message().Descriptor().Fields().ByName("number"), protoreflect.ValueOfString("4111"))
+			cards.Append(card)
+		}
+		encoded, err := proto.Marshal(event)
+		if err != nil {
+			t.Fatalf("Failed to encode event: %v", err)
+		}
+		content = protowire.AppendVarint(content, uint64(len(encoded)))
+		content = append(content, encoded...)
+	}
+	return content
+}
+
+func TestExecuteRules(t *testing.T) {
+	descriptor, err := MessageDescriptor(types.Input{Protobuf: &types.ProtobufOptions{Message: "events.Event", DescriptorSet: eventsDescriptorSet(t)}})
+	if err != nil {
+		t.Fatalf("Failed to resolve descriptor: %v", err)
+	}
+
+	t.Run("fields redacted and excluded with paths", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "cards[*].type", Operator: "EQ", Value: "card"}},
+				},
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "cards[*].number"}},
+			},
+			{Actions: []types.Action{
+				{ActionType: "EXCLUDE", FieldName: "email"},
+				{ActionType: "REDACT", FieldName: "amount"},
+			}},
+		}
+		output := bytes.NewBuffer(nil)
+		transformErr := ExecuteRules(writeEvents(t, descriptor, "ada@example.com", "grace@example.com"), descriptor, rules, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform protobuf: %v", transformErr.Message)
+		}
+		documents, err := ToDocuments(output.Bytes(), descriptor)
+		if err != nil {
+			t.Fatalf("Failed to decode output: %v", err)
+		}
+		assert.Equal(t, len(documents), 2)
+		content, _ := transformjson.FromJsonl(documents[1])
+		// The redacted double is reset to its default value, which isn't encoded
+		assert.Equal(t, string(content), `{"id":2,"cards":[{"type":"card","number":"**redacted**"},{"type":"iban","number":"4111"}],"status":"ACTIVE"}`)
+	})
+
+	t.Run("excluded elements removed from repeated fields", func(t *testing.T) {
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions:     []types.Expressions{{FieldName: "cards[*].type", Operator: "EQ", Value: "iban"}},
+			},
+			Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "cards[*]"}},
+		}}
+		output := bytes.NewBuffer(nil)
+		transformErr := ExecuteRules(writeEvents(t, descriptor, "ada@example.com"), descriptor, rules, output)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform protobuf: %v", transformErr.Message)
+		}
+		documents, _ := ToDocuments(output.Bytes(), descriptor)
+		content, _ := transformjson.FromJsonl(documents[0])
+		assert.Equal(t, string(content), `{"id":1,"email":"ada@example.com","cards":[{"type":"card","number":"4111"}],"amount":12.5,"status":"ACTIVE"}`)
+	})
+
+	t.Run("pages and invalid streams", func(t *testing.T) {
+		pages, err := Pages(writeEvents(t, descriptor, "a", "b", "c"), 2)
+		if err != nil {
+			t.Fatalf("Failed to paginate: %v", err)
+		}
+		assert.Equal(t, len(pages), 2)
+		documents, _ := ToDocuments(pages[1], descriptor)
+		assert.Equal(t, len(documents), 1)
+
+		content := writeEvents(t, descriptor, "a")
+		_, err = Pages(content[:len(content)-1], 2)
+		assert.NotEqual(t, err, nil)
+		_, err = ParseDescriptor([]byte("not a descriptor"), "events.Event")
+		assert.NotEqual(t, err, nil)
+	})
+}
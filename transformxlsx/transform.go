@@ -0,0 +1,256 @@
+package transformxlsx
+
+import (
+	"bytes"
+	"fmt"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+	"lazy-lagoon/transformcsv"
+
+	"github.com/xuri/excelize/v2"
+)
+
+/*
+Step 1: execute transform, and store in output storage
+*/
+func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
+	/*
+		Downloading the file from the input storage type
+	*/
+	byteContent, err := storage.GetBytes(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	/*
+		Transforming the rows of the sheet
+	*/
+	byteContent, transformErr := ExecuteRules(byteContent, input.Xlsx, rules)
+	if transformErr != nil {
+		return transformErr
+	}
+	// Store the workbook in the output storage type
+	err = storage.StoreBytes(output, byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	return nil
+}
+
+/*
+Step 2: Transform the rows under the header row of the sheet as CSV rows, and write them back into the workbook.
+The other sheets, the rows above the header and the cells the rules don't change are left untouched.
+*/
+func ExecuteRules(byteContent []byte, options *types.XlsxOptions, rules []types.Rule) ([]byte, *types.TransformError) {
+	workbook, sheet, err := openSheet(byteContent, options)
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error()}
+	}
+	defer workbook.Close()
+
+	rows, err := workbook.GetRows(sheet)
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error()}
+	}
+	headerRow := headerRow(options)
+	if len(rows) < headerRow {
+		return byteContent, nil
+	}
+	plan, transformErr := transformcsv.Compile(rows[headerRow-1], rules)
+	if transformErr != nil {
+		return nil, transformErr
+	}
+	// The columns excluded from every row are removed from the header row too
+	err = writeRow(workbook, sheet, headerRow, rows[headerRow-1], plan.Header(rows[headerRow-1]))
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error()}
+	}
+	for index := headerRow; index < len(rows); index++ {
+		row := make([]string, len(rows[index]))
+		copy(row, rows[index])
+		row, transformErr = plan.ExecuteRow(row)
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		err = writeRow(workbook, sheet, index+1, rows[index], row)
+		if err != nil {
+			return nil, &types.TransformError{Message: err.Error()}
+		}
+	}
+
+	buffer, err := workbook.WriteToBuffer()
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error()}
+	}
+	return buffer.Bytes(), nil
+}
+
+/*
+Paths returns the cells of the header row of the sheet
+*/
+func Paths(byteContent []byte, options *types.XlsxOptions) ([]string, error) {
+	workbook, sheet, err := openSheet(byteContent, options)
+	if err != nil {
+		return nil, err
+	}
+	defer workbook.Close()
+
+	rows, err := workbook.GetRows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	if len(rows) < headerRow(options) {
+		return paths, nil
+	}
+	for _, header := range rows[headerRow(options)-1] {
+		if !contains(paths, header) {
+			paths = append(paths, header)
+		}
+	}
+	return paths, nil
+}
+
+/*
+Pages splits the sheet into workbooks of the header row and rowsPerPage rows - used for preview.
+The pages only keep the values of the sheet, not the styles or the other sheets.
+*/
+func Pages(byteContent []byte, options *types.XlsxOptions, rowsPerPage int) ([][]byte, error) {
+	workbook, sheet, err := openSheet(byteContent, options)
+	if err != nil {
+		return nil, err
+	}
+	defer workbook.Close()
+
+	rows, err := workbook.GetRows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	headerRow := headerRow(options)
+	if len(rows) < headerRow {
+		return nil, nil
+	}
+	header := rows[headerRow-1]
+	rows = rows[headerRow:]
+
+	var pages [][]byte
+	for start := 0; start < len(rows); start += rowsPerPage {
+		end := min(start+rowsPerPage, len(rows))
+		page, err := writePage(sheet, header, rows[start:end])
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+/*
+	Helper functions
+*/
+// openSheet opens the workbook and returns the name of the sheet chosen by name or by index
+func openSheet(byteContent []byte, options *types.XlsxOptions) (*excelize.File, string, error) {
+	workbook, err := excelize.OpenReader(bytes.NewReader(byteContent))
+	if err != nil {
+		return nil, "", err
+	}
+	sheets := workbook.GetSheetList()
+	if options != nil && options.Sheet != "" {
+		for _, sheet := range sheets {
+			if sheet == options.Sheet {
+				return workbook, sheet, nil
+			}
+		}
+		workbook.Close()
+		return nil, "", fmt.Errorf("sheet %s not found", options.Sheet)
+	}
+	sheetIndex := 0
+	if options != nil {
+		sheetIndex = options.SheetIndex
+	}
+	if sheetIndex < 0 || sheetIndex >= len(sheets) {
+		workbook.Close()
+		return nil, "", fmt.Errorf("sheet index %d not found, the workbook has %d sheets", sheetIndex, len(sheets))
+	}
+	return workbook, sheets[sheetIndex], nil
+}
+
+// headerRow returns the 1 based number of the header row, the first row by default
+func headerRow(options *types.XlsxOptions) int {
+	if options == nil || options.HeaderRow < 1 {
+		return 1
+	}
+	return options.HeaderRow
+}
+
+/*
+writeRow writes the cells the rules changed, keeping their style.
+Formulas of the changed cells are removed so the values aren't computed again, and the cells left over when columns are excluded are emptied.
+*/
+func writeRow(workbook *excelize.File, sheet string, rowNumber int, original []string, row []string) error {
+	for column := 0; column < max(len(original), len(row)); column++ {
+		value := ""
+		if column < len(row) {
+			value = row[column]
+		}
+		if (column < len(original) && value == original[column]) || (column >= len(original) && value == "") {
+			continue
+		}
+		cell, err := excelize.CoordinatesToCellName(column+1, rowNumber)
+		if err != nil {
+			return err
+		}
+		formula, err := workbook.GetCellFormula(sheet, cell)
+		if err != nil {
+			return err
+		}
+		if formula != "" {
+			err = workbook.SetCellFormula(sheet, cell, "")
+			if err != nil {
+				return err
+			}
+		}
+		err = workbook.SetCellStr(sheet, cell, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePage writes the header and the rows into a new workbook with a single sheet
+func writePage(sheet string, header []string, rows [][]string) ([]byte, error) {
+	page := excelize.NewFile()
+	defer page.Close()
+	err := page.SetSheetName(page.GetSheetName(0), sheet)
+	if err != nil {
+		return nil, err
+	}
+	for index, row := range append([][]string{header}, rows...) {
+		cell, err := excelize.CoordinatesToCellName(1, index+1)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, len(row))
+		for column, value := range row {
+			values[column] = value
+		}
+		err = page.SetSheetRow(sheet, cell, &values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	buffer, err := page.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
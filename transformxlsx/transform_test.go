@@ -0,0 +1,115 @@
+package transformxlsx
+
+import (
+	"bytes"
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/xuri/excelize/v2"
+)
+
+// newWorkbook returns a workbook with a title row above the header of the customers sheet, and a summary sheet
+func newWorkbook(t *testing.T) []byte {
+	workbook := excelize.NewFile()
+	defer workbook.Close()
+	workbook.SetSheetName("Sheet1", "Summary")
+	workbook.SetCellStr("Summary", "A1", "Total")
+	workbook.SetCellFormula("Summary", "B1", "COUNTA(Customers!A3:A10)")
+	workbook.NewSheet("Customers")
+	rows := [][]any{
+		{"Customer export"},
+		{"name", "email", "country"},
+		{"Ada", "ada@example.com", "UK"},
+		{"Grace", "grace@example.com", "US"},
+	}
+	for index, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, index+1)
+		workbook.SetSheetRow("Customers", cell, &row)
+	}
+	buffer, err := workbook.WriteToBuffer()
+	if err != nil {
+		t.Fatalf("Failed to write workbook: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func readRows(t *testing.T, content []byte, sheet string) [][]string {
+	workbook, err := excelize.OpenReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to open workbook: %v", err)
+	}
+	defer workbook.Close()
+	rows, err := workbook.GetRows(sheet)
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	return rows
+}
+
+func TestExecuteRules(t *testing.T) {
+	options := &types.XlsxOptions{Sheet: "Customers", HeaderRow: 2}
+
+	t.Run("paths of the header row", func(t *testing.T) {
+		paths, err := Paths(newWorkbook(t), options)
+		if err != nil {
+			t.Fatalf("Failed to read paths: %v", err)
+		}
+		assert.Equal(t, paths, []string{"name", "email", "country"})
+
+		paths, err = Paths(newWorkbook(t), &types.XlsxOptions{SheetIndex: 1, HeaderRow: 2})
+		if err != nil {
+			t.Fatalf("Failed to read paths: %v", err)
+		}
+		assert.Equal(t, paths, []string{"name", "email", "country"})
+	})
+
+	t.Run("rules applied to the rows under the header", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "country", Operator: "EQ", Value: "US"}},
+				},
+				Actions: []types.Action{{ActionType: "REDACT", FieldName: "name"}},
+			},
+			{Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "email"}}},
+		}
+		output, transformErr := ExecuteRules(newWorkbook(t), options, rules)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform workbook: %v", transformErr)
+		}
+		assert.Equal(t, readRows(t, output, "Customers"), [][]string{
+			{"Customer export"},
+			{"name", "country"},
+			{"Ada", "UK"},
+			{"**redacted**", "US"},
+		})
+		// The other sheets are left untouched
+		workbook, _ := excelize.OpenReader(bytes.NewReader(output))
+		defer workbook.Close()
+		formula, _ := workbook.GetCellFormula("Summary", "B1")
+		assert.Equal(t, formula, "COUNTA(Customers!A3:A10)")
+	})
+
+	t.Run("unknown sheet", func(t *testing.T) {
+		_, transformErr := ExecuteRules(newWorkbook(t), &types.XlsxOptions{Sheet: "Orders"}, nil)
+		assert.NotEqual(t, transformErr, nil)
+
+		_, transformErr = ExecuteRules(newWorkbook(t), &types.XlsxOptions{SheetIndex: 2}, nil)
+		assert.NotEqual(t, transformErr, nil)
+	})
+
+	t.Run("pages with the header row", func(t *testing.T) {
+		pages, err := Pages(newWorkbook(t), options, 1)
+		if err != nil {
+			t.Fatalf("Failed to paginate workbook: %v", err)
+		}
+		assert.Equal(t, len(pages), 2)
+		assert.Equal(t, readRows(t, pages[1], "Customers"), [][]string{
+			{"name", "email", "country"},
+			{"Grace", "grace@example.com", "US"},
+		})
+	})
+}
@@ -0,0 +1,196 @@
+package transformxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/transformjson"
+)
+
+const textKey = "#text"
+
+/*
+document converts the element into a JSON like document so the JSON rules can be applied.
+Attributes are keys prefixed with @, repeated elements (and the elements used as arrays by the rules) are arrays,
+elements with only text are strings and the text of the other elements is the #text key.
+*/
+func (node *element) document(path string, arrayPaths map[string]bool) any {
+	if len(node.attributes) == 0 && !node.hasElements() {
+		return node.text()
+	}
+	document := map[string]any{}
+	for _, attribute := range node.attributes {
+		document["@"+qualifiedName(attribute.Name)] = attribute.Value
+	}
+	counts := node.countElements()
+	for _, child := range node.children {
+		childElement, ok := child.(*element)
+		if !ok {
+			continue
+		}
+		childPath := path + "." + childElement.name
+		value := childElement.document(childPath, arrayPaths)
+		if counts[childElement.name] > 1 || arrayPaths[childPath] {
+			array, _ := document[childElement.name].([]any)
+			document[childElement.name] = append(array, value)
+		} else {
+			document[childElement.name] = value
+		}
+	}
+	if text := strings.TrimSpace(node.text()); text != "" {
+		document[textKey] = text
+	}
+	return document
+}
+
+/*
+write writes the element with the transformed document, in the order of the input.
+Excluded keys are left out, and values replaced by the actions (e.g. **redacted**) become the text of the element.
+*/
+func (node *element) write(out *bytes.Buffer, value any, path string, arrayPaths map[string]bool) {
+	object, isObject := value.(map[string]any)
+	if !isObject {
+		text := ""
+		if value != nil {
+			text = fmt.Sprint(value)
+		}
+		if len(node.attributes) == 0 && !node.hasElements() && text == node.text() {
+			node.writeOriginal(out)
+			return
+		}
+		node.writeStart(out, nil)
+		escape(out, text, false)
+		node.writeEnd(out)
+		return
+	}
+
+	attributes := []xml.Attr{}
+	for _, attribute := range node.attributes {
+		if attributeValue, ok := object["@"+qualifiedName(attribute.Name)]; ok {
+			attributes = append(attributes, xml.Attr{Name: attribute.Name, Value: fmt.Sprint(attributeValue)})
+		}
+	}
+	node.writeStart(out, attributes)
+
+	counts := node.countElements()
+	positions := map[string]int{}
+	text, hasText := object[textKey]
+	textChanged := hasText && fmt.Sprint(text) != strings.TrimSpace(node.text())
+	textWritten := false
+	// Whitespace before an excluded element is left out with it
+	var pending []byte
+	writeChild := func(token any) {
+		out.Write(pending)
+		pending = nil
+		writeToken(out, token)
+	}
+	for _, child := range node.children {
+		switch typedChild := child.(type) {
+		case *element:
+			position := positions[typedChild.name]
+			positions[typedChild.name]++
+			childValue, ok := object[typedChild.name]
+			childPath := path + "." + typedChild.name
+			if ok && (counts[typedChild.name] > 1 || arrayPaths[childPath]) {
+				array, isArray := childValue.([]any)
+				switch {
+				case !isArray:
+					// The whole array was replaced, the value is written once
+					ok = position == 0
+				case position >= len(array) || isExcluded(array[position]):
+					ok = false
+				default:
+					childValue = array[position]
+				}
+			}
+			if !ok {
+				pending = nil
+				continue
+			}
+			out.Write(pending)
+			pending = nil
+			typedChild.write(out, childValue, childPath, arrayPaths)
+		case xml.CharData:
+			// Whitespace is formatting, kept as it was
+			if isWhitespace(typedChild) {
+				pending = append(pending, typedChild...)
+				continue
+			}
+			if !hasText || (textChanged && textWritten) {
+				continue
+			}
+			textWritten = true
+			if textChanged {
+				out.Write(pending)
+				pending = nil
+				escape(out, fmt.Sprint(text), false)
+			} else {
+				writeChild(typedChild)
+			}
+		default:
+			writeChild(typedChild)
+		}
+	}
+	out.Write(pending)
+	node.writeEnd(out)
+}
+
+/*
+arrayPaths returns the paths of the elements the rules use as arrays ([*], an index, a slice or a filter), without the indexes.
+Those elements are arrays even when they appear once.
+*/
+func arrayPaths(rules []types.Rule) map[string]bool {
+	paths := map[string]bool{}
+	addPath := func(fieldName string) {
+		tokens, err := transformjson.MakePointer(fieldName)
+		if err != nil {
+			return
+		}
+		var names []string
+		for _, token := range tokens {
+			if transformjson.IsSelector(token) || isIndex(strings.TrimPrefix(token, "-")) {
+				if len(names) > 0 {
+					paths[strings.Join(names, ".")] = true
+				}
+				continue
+			}
+			names = append(names, token)
+		}
+	}
+	for _, rule := range rules {
+		for _, expression := range rule.Expression.Expressions {
+			addPath(expression.FieldName)
+		}
+		for _, action := range rule.Actions {
+			addPath(action.FieldName)
+		}
+		for _, action := range rule.ElseActions {
+			addPath(action.FieldName)
+		}
+	}
+	return paths
+}
+
+/*
+	Helper functions
+*/
+// isExcluded checks for the empty array EXCLUDE puts in place of array elements
+func isExcluded(value any) bool {
+	array, ok := value.([]any)
+	return ok && len(array) == 0
+}
+
+func isIndex(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, character := range token {
+		if character < '0' || character > '9' {
+			return false
+		}
+	}
+	return true
+}
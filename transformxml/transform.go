@@ -0,0 +1,178 @@
+package transformxml
+
+import (
+	"bytes"
+	"fmt"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+	"lazy-lagoon/transformjson"
+	"strings"
+)
+
+/*
+Step 1: execute transform, and store in output storage
+*/
+func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
+	/*
+		Downloading the file from the input storage type
+	*/
+	byteContent, err := storage.GetBytes(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	/*
+		Transforming the XML document
+	*/
+	byteContent, transformErr := ExecuteRules(byteContent, rules)
+	if transformErr != nil {
+		return transformErr
+	}
+	// Store the transformed XML bytes in the output storage type
+	err = storage.StoreBytes(output, byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	return nil
+}
+
+/*
+Step 2: Transform the XML document as a JSON document, and write it back in the order and formatting of the input
+*/
+func ExecuteRules(byteContent []byte, rules []types.Rule) ([]byte, *types.TransformError) {
+	document, err := parseTree(byteContent)
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error()}
+	}
+	plan, transformErr := transformjson.Compile(rules)
+	if transformErr != nil {
+		return nil, transformErr
+	}
+	paths := arrayPaths(rules)
+	jsonDocument, transformErr := plan.Execute(map[string]any{
+		document.root.name: document.root.document(document.root.name, paths),
+	})
+	if transformErr != nil {
+		return nil, transformErr
+	}
+
+	out := bytes.NewBuffer(nil)
+	for _, token := range document.prolog {
+		writeToken(out, token)
+	}
+	// The root element is kept (empty) when it's excluded, a document needs one
+	rootDocument, _ := jsonDocument.(map[string]any)
+	document.root.write(out, rootDocument[document.root.name], document.root.name, paths)
+	for _, token := range document.epilog {
+		writeToken(out, token)
+	}
+	return out.Bytes(), nil
+}
+
+/*
+ToDocument converts the XML content into the JSON like document the rules are applied to
+*/
+func ToDocument(byteContent []byte) (any, error) {
+	document, err := parseTree(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		document.root.name: document.root.document(document.root.name, map[string]bool{}),
+	}, nil
+}
+
+/*
+Pages splits the XML content on the repeating record element into XML documents of recordsPerPage records - used for preview.
+Every page keeps the declaration and the elements around the records. Without a record element the first repeated child of the root is used.
+*/
+func Pages(byteContent []byte, recordElement string, recordsPerPage int) ([][]byte, error) {
+	document, err := parseTree(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	if recordElement == "" {
+		recordElement = defaultRecordElement(document.root)
+	}
+	ancestors := findParent(document.root, recordElement)
+	if ancestors == nil {
+		return nil, fmt.Errorf("record element %s not found", recordElement)
+	}
+	parent := ancestors[len(ancestors)-1]
+	var records []*element
+	for _, child := range parent.children {
+		if childElement, ok := child.(*element); ok && matchesName(childElement.name, recordElement) {
+			records = append(records, childElement)
+		}
+	}
+
+	var pages [][]byte
+	for start := 0; start < len(records); start += recordsPerPage {
+		end := min(start+recordsPerPage, len(records))
+		page := bytes.NewBuffer(nil)
+		for _, token := range document.prolog {
+			writeToken(page, token)
+		}
+		for _, ancestor := range ancestors {
+			ancestor.writeStart(page, ancestor.attributes)
+			page.WriteString("\n")
+		}
+		for _, record := range records[start:end] {
+			record.writeOriginal(page)
+			page.WriteString("\n")
+		}
+		for i := len(ancestors) - 1; i >= 0; i-- {
+			ancestors[i].writeEnd(page)
+			if i > 0 {
+				page.WriteString("\n")
+			}
+		}
+		pages = append(pages, page.Bytes())
+	}
+	return pages, nil
+}
+
+/*
+	Helper functions
+*/
+// findParent returns the elements from the root to the parent of the first record element, depth first
+func findParent(node *element, recordElement string) []*element {
+	for _, child := range node.children {
+		if childElement, ok := child.(*element); ok && matchesName(childElement.name, recordElement) {
+			return []*element{node}
+		}
+	}
+	for _, child := range node.children {
+		if childElement, ok := child.(*element); ok {
+			if ancestors := findParent(childElement, recordElement); ancestors != nil {
+				return append([]*element{node}, ancestors...)
+			}
+		}
+	}
+	return nil
+}
+
+// defaultRecordElement returns the first child element of the root that is repeated, or the first child element
+func defaultRecordElement(root *element) string {
+	counts := root.countElements()
+	first := ""
+	for _, child := range root.children {
+		if childElement, ok := child.(*element); ok {
+			if counts[childElement.name] > 1 {
+				return childElement.name
+			}
+			if first == "" {
+				first = childElement.name
+			}
+		}
+	}
+	return first
+}
+
+// matchesName compares the element name with or without its namespace prefix
+func matchesName(name string, recordElement string) bool {
+	if name == recordElement {
+		return true
+	}
+	_, local, found := strings.Cut(name, ":")
+	return found && local == recordElement
+}
@@ -0,0 +1,106 @@
+package transformxml
+
+import (
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+
+	"github.com/go-playground/assert/v2"
+)
+
+const invoice = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- exported invoice -->
+<order id="42" status="open">
+  <customer id="C-7" vip="true">
+    <name>Ada &amp; Co</name>
+    <email>ada@example.com</email>
+  </customer>
+  <items>
+    <item sku="A1"><price>10.50</price><qty>1</qty></item>
+    <item sku="B2"><price>99.00</price><qty>3</qty></item>
+  </items>
+  <note>Deliver <b>before</b> noon</note>
+</order>
+`
+
+func TestExecuteRules(t *testing.T) {
+	t.Run("document of the elements and attributes", func(t *testing.T) {
+		document, err := ToDocument([]byte(invoice))
+		if err != nil {
+			t.Fatalf("Failed to parse xml: %v", err)
+		}
+		order := document.(map[string]any)["order"].(map[string]any)
+		assert.Equal(t, order["@id"], "42")
+		assert.Equal(t, order["customer"].(map[string]any)["name"], "Ada & Co")
+		assert.Equal(t, order["items"].(map[string]any)["item"].([]any)[1].(map[string]any)["price"], "99.00")
+		assert.Equal(t, order["note"], map[string]any{"b": "before", "#text": "Deliver  noon"})
+	})
+
+	t.Run("actions on element and attribute paths", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "order.customer.@vip", Operator: "EQ", Value: "true"}},
+				},
+				Actions: []types.Action{
+					{ActionType: "REDACT", FieldName: "order.customer.@id"},
+					{ActionType: "EXCLUDE", FieldName: "order.customer.email"},
+				},
+			},
+			{
+				// Numbers in the text are compared as numbers
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "order.items.item[*].price", Operator: "GT", Value: 50}},
+				},
+				Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "order.items.item[*]"}},
+			},
+			{Actions: []types.Action{{ActionType: "REDACT", FieldName: "order.@status"}}},
+		}
+		output, transformErr := ExecuteRules([]byte(invoice), rules)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform xml: %v", transformErr)
+		}
+		assert.Equal(t, string(output), `<?xml version="1.0" encoding="UTF-8"?>
+<!-- exported invoice -->
+<order id="42" status="**redacted**">
+  <customer id="**redacted**" vip="true">
+    <name>Ada &amp; Co</name>
+  </customer>
+  <items>
+    <item sku="A1"><price>10.50</price><qty>1</qty></item>
+  </items>
+  <note>Deliver <b>before</b> noon</note>
+</order>
+`)
+	})
+
+	t.Run("single elements are arrays for the rules using them as arrays", func(t *testing.T) {
+		content := `<order><items><item><price>5</price></item></items></order>`
+		rules := []types.Rule{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "order.items.item[*].price"}}}}
+		output, transformErr := ExecuteRules([]byte(content), rules)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform xml: %v", transformErr)
+		}
+		assert.Equal(t, string(output), `<order><items><item><price>**redacted**</price></item></items></order>`)
+	})
+
+	t.Run("pages split on the record element", func(t *testing.T) {
+		pages, err := Pages([]byte(invoice), "item", 1)
+		if err != nil {
+			t.Fatalf("Failed to paginate xml: %v", err)
+		}
+		assert.Equal(t, len(pages), 2)
+		assert.Equal(t, string(pages[1]), `<?xml version="1.0" encoding="UTF-8"?>
+<!-- exported invoice -->
+<order id="42" status="open">
+<items>
+<item sku="B2"><price>99.00</price><qty>3</qty></item>
+</items>
+</order>`)
+
+		_, err = Pages([]byte(invoice), "missing", 1)
+		assert.NotEqual(t, err, nil)
+	})
+}
@@ -0,0 +1,201 @@
+package transformxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+element is a node of the XML tree. The names are kept as written (prefix:local) so the output has the same namespaces as the input.
+*/
+type element struct {
+	name       string
+	attributes []xml.Attr
+	// *element, xml.CharData, xml.Comment, xml.ProcInst or xml.Directive in document order
+	children []any
+}
+
+/*
+tree is the parsed XML document, the declaration, comments and doctype around the root element are kept
+*/
+type tree struct {
+	prolog []any
+	root   *element
+	epilog []any
+}
+
+// parseTree reads the XML content into a tree
+func parseTree(content []byte) (*tree, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = true
+	document := &tree{}
+	var stack []*element
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("file is not a valid xml file: %v", err)
+		}
+		switch typedToken := token.(type) {
+		case xml.StartElement:
+			node := &element{name: qualifiedName(typedToken.Name), attributes: typedToken.Copy().Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if document.root == nil {
+				document.root = node
+			} else {
+				return nil, fmt.Errorf("file is not a valid xml file: more than one root element")
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1].name != qualifiedName(typedToken.Name) {
+				return nil, fmt.Errorf("file is not a valid xml file: unexpected end element %s", qualifiedName(typedToken.Name))
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			token = xml.CopyToken(token)
+			switch {
+			case len(stack) > 0:
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, token)
+			case document.root == nil:
+				document.prolog = append(document.prolog, token)
+			default:
+				document.epilog = append(document.epilog, token)
+			}
+		}
+	}
+	if document.root == nil || len(stack) > 0 {
+		return nil, fmt.Errorf("file is not a valid xml file: missing root element")
+	}
+	return document, nil
+}
+
+// hasElements checks for child elements, elements without them (and without attributes) are only text
+func (node *element) hasElements() bool {
+	for _, child := range node.children {
+		if _, ok := child.(*element); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// text joins the character data of the element
+func (node *element) text() string {
+	var text strings.Builder
+	for _, child := range node.children {
+		if charData, ok := child.(xml.CharData); ok {
+			text.Write(charData)
+		}
+	}
+	return text.String()
+}
+
+// countElements counts the child elements by name, repeated elements are arrays
+func (node *element) countElements() map[string]int {
+	counts := map[string]int{}
+	for _, child := range node.children {
+		if childElement, ok := child.(*element); ok {
+			counts[childElement.name]++
+		}
+	}
+	return counts
+}
+
+/*
+	Writing the tree back
+*/
+func (node *element) writeStart(out *bytes.Buffer, attributes []xml.Attr) {
+	out.WriteString("<" + node.name)
+	for _, attribute := range attributes {
+		out.WriteString(" " + qualifiedName(attribute.Name) + `="`)
+		escape(out, attribute.Value, true)
+		out.WriteString(`"`)
+	}
+	out.WriteString(">")
+}
+
+func (node *element) writeEnd(out *bytes.Buffer) {
+	out.WriteString("</" + node.name + ">")
+}
+
+// writeOriginal writes the element as it was read
+func (node *element) writeOriginal(out *bytes.Buffer) {
+	node.writeStart(out, node.attributes)
+	for _, child := range node.children {
+		writeToken(out, child)
+	}
+	node.writeEnd(out)
+}
+
+func writeToken(out *bytes.Buffer, token any) {
+	switch typedToken := token.(type) {
+	case *element:
+		typedToken.writeOriginal(out)
+	case xml.CharData:
+		escape(out, string(typedToken), false)
+	case xml.Comment:
+		out.WriteString("<!--")
+		out.Write(typedToken)
+		out.WriteString("-->")
+	case xml.ProcInst:
+		out.WriteString("<?" + typedToken.Target)
+		if len(typedToken.Inst) > 0 {
+			out.WriteString(" ")
+			out.Write(typedToken.Inst)
+		}
+		out.WriteString("?>")
+	case xml.Directive:
+		out.WriteString("<!")
+		out.Write(typedToken)
+		out.WriteString(">")
+	}
+}
+
+/*
+	Helper functions
+*/
+func qualifiedName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// escape writes the text with the markup characters escaped, attribute values also escape quotes and whitespace
+func escape(out *bytes.Buffer, text string, isAttribute bool) {
+	for _, character := range text {
+		switch {
+		case character == '&':
+			out.WriteString("&amp;")
+		case character == '<':
+			out.WriteString("&lt;")
+		case character == '>':
+			out.WriteString("&gt;")
+		case isAttribute && character == '"':
+			out.WriteString("&quot;")
+		case isAttribute && character == '\n':
+			out.WriteString("&#xA;")
+		case isAttribute && character == '\r':
+			out.WriteString("&#xD;")
+		case isAttribute && character == '\t':
+			out.WriteString("&#x9;")
+		case character == '\r':
+			out.WriteString("&#xD;")
+		default:
+			out.WriteRune(character)
+		}
+	}
+}
+
+func isWhitespace(token any) bool {
+	charData, ok := token.(xml.CharData)
+	return ok && len(bytes.TrimSpace(charData)) == 0
+}
@@ -0,0 +1,173 @@
+package transformyaml
+
+import (
+	"encoding/json"
+	"fmt"
+	"lazy-lagoon/transformjson"
+	"math"
+	"reflect"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+toDocument converts the YAML node into a JSON like document so the JSON rules can be applied.
+Mappings keep the order of their keys, numbers are json.Number and aliases are the value of their anchor.
+*/
+func toDocument(node *yaml.Node) any {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return toDocument(node.Content[0])
+	case yaml.AliasNode:
+		return toDocument(node.Alias)
+	case yaml.MappingNode:
+		object := transformjson.NewObject()
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			object.Set(node.Content[index].Value, toDocument(node.Content[index+1]))
+		}
+		return object
+	case yaml.SequenceNode:
+		array := make([]any, 0, len(node.Content))
+		for _, child := range node.Content {
+			array = append(array, toDocument(child))
+		}
+		return array
+	}
+	return scalarValue(node)
+}
+
+/*
+applyDocument writes the transformed document back into the node, so the comments, styles and anchors of the input are kept.
+The original is the document before the rules. Excluded keys and elements are removed, values replaced by the actions (e.g. **redacted**) become strings,
+and aliases are replaced by a copy of their anchor when the rules changed them.
+*/
+func applyDocument(node *yaml.Node, value any, original any) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) > 0 {
+			applyDocument(node.Content[0], value, original)
+		}
+		return
+	case yaml.AliasNode:
+		if reflect.DeepEqual(value, original) {
+			return
+		}
+		headComment, lineComment, footComment := node.HeadComment, node.LineComment, node.FootComment
+		*node = *copyNode(node.Alias)
+		node.HeadComment, node.LineComment, node.FootComment = headComment, lineComment, footComment
+		applyDocument(node, value, original)
+		return
+	case yaml.MappingNode:
+		object, isObject := value.(*transformjson.Object)
+		originalObject, _ := original.(*transformjson.Object)
+		if isObject && originalObject != nil {
+			content := make([]*yaml.Node, 0, len(node.Content))
+			for index := 0; index+1 < len(node.Content); index += 2 {
+				key := node.Content[index].Value
+				childValue, exists := object.Get(key)
+				if !exists {
+					continue
+				}
+				childOriginal, _ := originalObject.Get(key)
+				applyDocument(node.Content[index+1], childValue, childOriginal)
+				content = append(content, node.Content[index], node.Content[index+1])
+			}
+			node.Content = content
+			return
+		}
+	case yaml.SequenceNode:
+		array, isArray := value.([]any)
+		originalArray, _ := original.([]any)
+		if isArray && len(array) == len(node.Content) && len(originalArray) == len(node.Content) {
+			content := make([]*yaml.Node, 0, len(node.Content))
+			for index, child := range node.Content {
+				if isExcluded(array[index], originalArray[index]) {
+					continue
+				}
+				applyDocument(child, array[index], originalArray[index])
+				content = append(content, child)
+			}
+			node.Content = content
+			return
+		}
+	default:
+		if reflect.DeepEqual(value, original) {
+			return
+		}
+	}
+	// The value was replaced, the node becomes a string keeping its comments
+	setString(node, value)
+}
+
+/*
+	Helper functions
+*/
+// scalarValue returns the value of the scalar: numbers, booleans and null are typed, the other scalars (e.g. timestamps) are strings
+func scalarValue(node *yaml.Node) any {
+	switch node.ShortTag() {
+	case "!!null":
+		return nil
+	case "!!bool":
+		var value bool
+		if node.Decode(&value) == nil {
+			return value
+		}
+	case "!!int", "!!float":
+		var value any
+		if node.Decode(&value) != nil {
+			break
+		}
+		switch number := value.(type) {
+		case int:
+			return json.Number(strconv.Itoa(number))
+		case int64:
+			return json.Number(strconv.FormatInt(number, 10))
+		case uint64:
+			return json.Number(strconv.FormatUint(number, 10))
+		case float64:
+			if !math.IsInf(number, 0) && !math.IsNaN(number) {
+				return json.Number(strconv.FormatFloat(number, 'g', -1, 64))
+			}
+		}
+	}
+	return node.Value
+}
+
+// setString replaces the node with a string scalar, the quotes are added when the string needs them
+func setString(node *yaml.Node, value any) {
+	text := ""
+	if value != nil {
+		text = fmt.Sprint(value)
+	}
+	node.Kind = yaml.ScalarNode
+	node.Tag = "!!str"
+	node.Value = text
+	node.Style = 0
+	node.Content = nil
+	node.Alias = nil
+}
+
+// isExcluded checks for the empty array left in place of an excluded element
+func isExcluded(value any, original any) bool {
+	array, isArray := value.([]any)
+	if !isArray || len(array) > 0 {
+		return false
+	}
+	originalArray, isOriginalArray := original.([]any)
+	return !isOriginalArray || len(originalArray) > 0
+}
+
+// copyNode copies the node and its children, the copy of an anchor isn't an anchor
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Anchor = ""
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for index, child := range node.Content {
+		copied.Content[index] = copyNode(child)
+	}
+	return &copied
+}
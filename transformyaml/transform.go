@@ -0,0 +1,196 @@
+package transformyaml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"lazy-lagoon/pkg/textencoding"
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/storage"
+	"lazy-lagoon/transformjson"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Indentation used when the input has no nested mappings to take it from
+const defaultIndent = 2
+
+/*
+Step 1: execute transform, and store in output storage
+*/
+func ExecuteTransform(input types.Input, rules []types.Rule, output types.Output) *types.TransformError {
+	/*
+		Downloading the file from the input storage type, decoded to UTF-8
+	*/
+	byteContent, encoding, err := storage.GetText(input)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	// The output is written in the encoding of the input unless set
+	if output.Encoding != "" {
+		encoding = output.Encoding
+	}
+	/*
+		Transforming every document of the YAML stream
+	*/
+	byteContent, transformErr := ExecuteRules(byteContent, rules)
+	if transformErr != nil {
+		return transformErr
+	}
+	byteContent, err = textencoding.Encode(byteContent, encoding, true)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	// Store the transformed YAML bytes in the output storage type
+	err = storage.StoreBytes(output, byteContent)
+	if err != nil {
+		return &types.TransformError{Message: err.Error()}
+	}
+	return nil
+}
+
+/*
+Step 2: Transform every document of the YAML stream as a JSON document, like the lines of a JSONL file,
+and write it back with the comments, key order and anchors of the input
+*/
+func ExecuteRules(byteContent []byte, rules []types.Rule) ([]byte, *types.TransformError) {
+	nodes, err := decodeNodes(byteContent)
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error()}
+	}
+	plan, transformErr := transformjson.Compile(rules)
+	if transformErr != nil {
+		return nil, transformErr
+	}
+	for _, node := range nodes {
+		original := toDocument(node)
+		jsonDocument, transformErr := plan.Execute(transformjson.CopyJSON(original))
+		if transformErr != nil {
+			return nil, transformErr
+		}
+		applyDocument(node, jsonDocument, original)
+	}
+	content, err := encodeNodes(nodes, byteContent)
+	if err != nil {
+		return nil, &types.TransformError{Message: err.Error()}
+	}
+	return content, nil
+}
+
+/*
+ToDocuments converts every document of the YAML stream into the JSON like document the rules are applied to
+*/
+func ToDocuments(byteContent []byte) ([]any, error) {
+	nodes, err := decodeNodes(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	documents := make([]any, len(nodes))
+	for index, node := range nodes {
+		documents[index] = toDocument(node)
+	}
+	return documents, nil
+}
+
+/*
+Pages splits the YAML stream into streams of documentsPerPage documents - used for preview
+*/
+func Pages(byteContent []byte, documentsPerPage int) ([][]byte, error) {
+	nodes, err := decodeNodes(byteContent)
+	if err != nil {
+		return nil, err
+	}
+	var pages [][]byte
+	for start := 0; start < len(nodes); start += documentsPerPage {
+		end := min(start+documentsPerPage, len(nodes))
+		page, err := encodeNodes(nodes[start:end], byteContent)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+/*
+	Helper functions
+*/
+// decodeNodes reads the documents of the stream, the documents without content (e.g. after a trailing ---) are left out
+func decodeNodes(byteContent []byte) ([]*yaml.Node, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(byteContent))
+	nodes := []*yaml.Node{}
+	for {
+		node := &yaml.Node{}
+		err := decoder.Decode(node)
+		if errors.Is(err, io.EOF) {
+			return nodes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not decode your yaml input: %v", err)
+		}
+		if len(node.Content) > 0 {
+			nodes = append(nodes, node)
+		}
+	}
+}
+
+// encodeNodes writes the documents separated by ---, with the indentation of the input and its --- before the first document
+func encodeNodes(nodes []*yaml.Node, source []byte) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+	if startsWithSeparator(source) {
+		buffer.WriteString("---\n")
+	}
+	encoder := yaml.NewEncoder(buffer)
+	encoder.SetIndent(detectIndent(nodes))
+	for _, node := range nodes {
+		err := encoder.Encode(node)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode the yaml output: %v", err)
+		}
+	}
+	err := encoder.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not encode the yaml output: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// detectIndent returns the columns between a key and the keys of its nested block mapping
+func detectIndent(nodes []*yaml.Node) int {
+	var find func(node *yaml.Node) int
+	find = func(node *yaml.Node) int {
+		if node.Kind == yaml.MappingNode && node.Style&yaml.FlowStyle == 0 {
+			for index := 0; index+1 < len(node.Content); index += 2 {
+				key, value := node.Content[index], node.Content[index+1]
+				if value.Kind == yaml.MappingNode && value.Style&yaml.FlowStyle == 0 && len(value.Content) > 0 && value.Content[0].Column > key.Column {
+					return value.Content[0].Column - key.Column
+				}
+			}
+		}
+		for _, child := range node.Content {
+			if indent := find(child); indent > 0 {
+				return indent
+			}
+		}
+		return 0
+	}
+	for _, node := range nodes {
+		if indent := find(node); indent > 0 {
+			return indent
+		}
+	}
+	return defaultIndent
+}
+
+// startsWithSeparator checks the first line that isn't a comment or empty is ---
+func startsWithSeparator(source []byte) bool {
+	for _, line := range bytes.Split(source, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' || line[0] == '%' {
+			continue
+		}
+		return bytes.Equal(line, []byte("---")) || bytes.HasPrefix(line, []byte("--- "))
+	}
+	return false
+}
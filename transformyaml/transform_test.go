@@ -0,0 +1,108 @@
+package transformyaml
+
+import (
+	"encoding/json"
+	"testing"
+
+	"lazy-lagoon/pkg/types"
+	"lazy-lagoon/transformjson"
+
+	"github.com/go-playground/assert/v2"
+)
+
+const manifests = `# exported secrets
+kind: Secret
+metadata:
+  name: api
+data:
+  password: hunter2 # rotate monthly
+  replicas: 3
+---
+kind: Secret
+metadata:
+  name: worker
+data:
+  password: s3cr3t
+  replicas: 1
+`
+
+func TestExecuteRules(t *testing.T) {
+	t.Run("documents of the stream", func(t *testing.T) {
+		documents, err := ToDocuments([]byte(manifests))
+		if err != nil {
+			t.Fatalf("Failed to parse yaml: %v", err)
+		}
+		assert.Equal(t, len(documents), 2)
+		data, _ := documents[0].(*transformjson.Object).Get("data")
+		replicas, _ := data.(*transformjson.Object).Get("replicas")
+		assert.Equal(t, replicas, json.Number("3"))
+		assert.Equal(t, documents[1].(*transformjson.Object).Keys(), []string{"kind", "metadata", "data"})
+	})
+
+	t.Run("actions on every document keep the comments", func(t *testing.T) {
+		rules := []types.Rule{
+			{
+				Expression: types.Expression{
+					LogicalOperator: "AND",
+					Expressions:     []types.Expressions{{FieldName: "data.replicas", Operator: "GT", Value: 2}},
+				},
+				Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "metadata.name"}},
+			},
+			{Actions: []types.Action{{ActionType: "REDACT", FieldName: "data.password"}}},
+		}
+		output, transformErr := ExecuteRules([]byte(manifests), rules)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform yaml: %v", transformErr.Message)
+		}
+		assert.Equal(t, string(output), `# exported secrets
+kind: Secret
+metadata: {}
+data:
+  password: '**redacted**' # rotate monthly
+  replicas: 3
+---
+kind: Secret
+metadata:
+  name: worker
+data:
+  password: '**redacted**'
+  replicas: 1
+`)
+	})
+
+	t.Run("aliases changed by the rules are copies of their anchor", func(t *testing.T) {
+		content := "base: &token hunter2\ncopy: *token\n"
+		rules := []types.Rule{{Actions: []types.Action{{ActionType: "REDACT", FieldName: "copy"}}}}
+		output, transformErr := ExecuteRules([]byte(content), rules)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform yaml: %v", transformErr.Message)
+		}
+		assert.Equal(t, string(output), "base: &token hunter2\ncopy: '**redacted**'\n")
+	})
+
+	t.Run("excluded sequence elements are removed", func(t *testing.T) {
+		content := "env:\n  - name: USER\n    value: admin\n  - name: TOKEN\n    value: abc\n"
+		rules := []types.Rule{{
+			Expression: types.Expression{
+				LogicalOperator: "AND",
+				Expressions:     []types.Expressions{{FieldName: "env[*].name", Operator: "EQ", Value: "TOKEN"}},
+			},
+			Actions: []types.Action{{ActionType: "EXCLUDE", FieldName: "env[*]"}},
+		}}
+		output, transformErr := ExecuteRules([]byte(content), rules)
+		if transformErr != nil {
+			t.Fatalf("Failed to transform yaml: %v", transformErr.Message)
+		}
+		assert.Equal(t, string(output), "env:\n  - name: USER\n    value: admin\n")
+	})
+
+	t.Run("pages of documents", func(t *testing.T) {
+		pages, err := Pages([]byte("a: 1\n---\nb: 2\n---\nc: 3\n"), 2)
+		if err != nil {
+			t.Fatalf("Failed to paginate: %v", err)
+		}
+		assert.Equal(t, len(pages), 2)
+		assert.Equal(t, string(pages[0]), "a: 1\n---\nb: 2\n")
+		assert.Equal(t, string(pages[1]), "c: 3\n")
+	})
+}